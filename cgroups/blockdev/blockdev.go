@@ -0,0 +1,156 @@
+// Package blockdev resolves block device paths (such as /dev/nvme0n1) to
+// the major:minor numbers the blkio (cgroup v1) and io (cgroup v2)
+// controllers use, and the numbers back to device names.
+package blockdev
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+// Device is a block device, as known to sysfs.
+type Device struct {
+	Major uint64
+	Minor uint64
+	// Name is the kernel name of the device, e.g. "nvme0n1".
+	Name string
+}
+
+// Resolver resolves block devices using sysfs.
+type Resolver struct {
+	// SysfsRoot is the mount point of sysfs, "/sys" if empty.
+	SysfsRoot string
+}
+
+// Lookup returns the block device at path or, if it is a partition, the
+// disk it is on, as the controllers only accept whole disks.
+func (r *Resolver) Lookup(path string) (Device, error) {
+	var st unix.Stat_t
+	if err := unix.Stat(path, &st); err != nil {
+		return Device{}, &os.PathError{Op: "stat", Path: path, Err: err}
+	}
+	if st.Mode&unix.S_IFMT != unix.S_IFBLK {
+		return Device{}, fmt.Errorf("%s is not a block device", path)
+	}
+	rdev := uint64(st.Rdev) //nolint:unconvert // Rdev is uint32 on e.g. MIPS.
+	return r.Disk(uint64(unix.Major(rdev)), uint64(unix.Minor(rdev)))
+}
+
+// Disk returns the block device major:minor or, if it is a partition,
+// the disk it is on.
+func (r *Resolver) Disk(major, minor uint64) (Device, error) {
+	dir, err := r.sysfsDir(major, minor)
+	if err != nil {
+		return Device{}, err
+	}
+	if _, err := os.Stat(filepath.Join(dir, "partition")); err == nil {
+		// The directory of a partition is in the one of its disk.
+		dir = filepath.Dir(dir)
+		data, err := os.ReadFile(filepath.Join(dir, "dev"))
+		if err != nil {
+			return Device{}, err
+		}
+		if major, minor, err = parseDev(strings.TrimSpace(string(data))); err != nil {
+			return Device{}, fmt.Errorf("%s: %w", filepath.Join(dir, "dev"), err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return Device{}, err
+	}
+	return Device{Major: major, Minor: minor, Name: filepath.Base(dir)}, nil
+}
+
+// Name returns the kernel name of the block device major:minor.
+func (r *Resolver) Name(major, minor uint64) (string, error) {
+	dir, err := r.sysfsDir(major, minor)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Base(dir), nil
+}
+
+// sysfsDir returns the sysfs directory of the block device major:minor.
+func (r *Resolver) sysfsDir(major, minor uint64) (string, error) {
+	root := r.SysfsRoot
+	if root == "" {
+		root = "/sys"
+	}
+	link := filepath.Join(root, "dev/block", strconv.FormatUint(major, 10)+":"+strconv.FormatUint(minor, 10))
+	dir, err := filepath.EvalSymlinks(link)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("no block device %d:%d: %w", major, minor, err)
+		}
+		return "", err
+	}
+	return dir, nil
+}
+
+func parseDev(s string) (major, minor uint64, err error) {
+	ma, mi, ok := strings.Cut(s, ":")
+	if !ok {
+		return 0, 0, fmt.Errorf("invalid device number %q", s)
+	}
+	if major, err = strconv.ParseUint(ma, 10, 32); err != nil {
+		return 0, 0, err
+	}
+	if minor, err = strconv.ParseUint(mi, 10, 32); err != nil {
+		return 0, 0, err
+	}
+	return major, minor, nil
+}
+
+// ThrottleDevice returns a throttle entry of rate for the block device
+// at path (or its disk, see Lookup).
+func (r *Resolver) ThrottleDevice(path string, rate uint64) (*configs.ThrottleDevice, error) {
+	d, err := r.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return configs.NewThrottleDevice(int64(d.Major), int64(d.Minor), rate), nil
+}
+
+// WeightDevice returns a weight entry for the block device at path (or
+// its disk, see Lookup).
+func (r *Resolver) WeightDevice(path string, weight, leafWeight uint16) (*configs.WeightDevice, error) {
+	d, err := r.Lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return configs.NewWeightDevice(int64(d.Major), int64(d.Minor), weight, leafWeight), nil
+}
+
+// Decorate sets the Device field of the block I/O statistics entries to
+// the names of the devices. The devices which are gone are left unnamed.
+func (r *Resolver) Decorate(stats *cgroups.BlkioStats) {
+	names := make(map[[2]uint64]string)
+	for _, entries := range [][]cgroups.BlkioStatEntry{
+		stats.IoServiceBytesRecursive,
+		stats.IoServicedRecursive,
+		stats.IoQueuedRecursive,
+		stats.IoServiceTimeRecursive,
+		stats.IoWaitTimeRecursive,
+		stats.IoMergedRecursive,
+		stats.IoTimeRecursive,
+		stats.SectorsRecursive,
+	} {
+		for i := range entries {
+			e := &entries[i]
+			key := [2]uint64{e.Major, e.Minor}
+			name, ok := names[key]
+			if !ok {
+				name, _ = r.Name(e.Major, e.Minor)
+				names[key] = name
+			}
+			e.Device = name
+		}
+	}
+}
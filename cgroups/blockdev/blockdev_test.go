@@ -0,0 +1,129 @@
+package blockdev
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+)
+
+// fakeSysfs creates a sysfs with disk sda (8:0), which has partition
+// sda1 (8:1), and disk nvme0n1 (259:0).
+func fakeSysfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"devices/pci0000:00/host0/block/sda/dev":            "8:0\n",
+		"devices/pci0000:00/host0/block/sda/sda1/dev":       "8:1\n",
+		"devices/pci0000:00/host0/block/sda/sda1/partition": "1\n",
+		"devices/pci0000:00/nvme/block/nvme0n1/dev":         "259:0\n",
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"8:0":   "../../devices/pci0000:00/host0/block/sda",
+		"8:1":   "../../devices/pci0000:00/host0/block/sda/sda1",
+		"259:0": "../../devices/pci0000:00/nvme/block/nvme0n1",
+	}
+	if err := os.MkdirAll(filepath.Join(root, "dev/block"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, "dev/block", name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDisk(t *testing.T) {
+	r := &Resolver{SysfsRoot: fakeSysfs(t)}
+
+	for _, tc := range []struct {
+		major, minor uint64
+		expected     Device
+	}{
+		{8, 0, Device{Major: 8, Minor: 0, Name: "sda"}},
+		// A partition maps to its disk.
+		{8, 1, Device{Major: 8, Minor: 0, Name: "sda"}},
+		{259, 0, Device{Major: 259, Minor: 0, Name: "nvme0n1"}},
+	} {
+		d, err := r.Disk(tc.major, tc.minor)
+		if err != nil {
+			t.Errorf("%d:%d: %v", tc.major, tc.minor, err)
+			continue
+		}
+		if d != tc.expected {
+			t.Errorf("%d:%d: expected %+v, got %+v", tc.major, tc.minor, tc.expected, d)
+		}
+	}
+	if _, err := r.Disk(8, 16); err == nil {
+		t.Error("expected error for a nonexistent device, got nil")
+	}
+	if name, err := r.Name(8, 1); err != nil || name != "sda1" {
+		t.Errorf("expected name sda1, got %q (%v)", name, err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	r := &Resolver{SysfsRoot: fakeSysfs(t)}
+	if _, err := r.Lookup("/dev/null"); err == nil {
+		t.Error("expected error for a character device, got nil")
+	}
+
+	path := filepath.Join(t.TempDir(), "sda1")
+	if err := unix.Mknod(path, unix.S_IFBLK|0o600, int(unix.Mkdev(8, 1))); err != nil {
+		t.Skipf("unable to create a block device node: %v", err)
+	}
+	td, err := r.ThrottleDevice(path, 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if td.String() != "8:0 1000" {
+		t.Errorf("expected throttle entry %q, got %q", "8:0 1000", td.String())
+	}
+	wd, err := r.WeightDevice(path, 500, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wd.WeightString() != "8:0 500" {
+		t.Errorf("expected weight entry %q, got %q", "8:0 500", wd.WeightString())
+	}
+}
+
+func TestDecorate(t *testing.T) {
+	r := &Resolver{SysfsRoot: fakeSysfs(t)}
+	stats := cgroups.BlkioStats{
+		IoServiceBytesRecursive: []cgroups.BlkioStatEntry{
+			{Major: 259, Minor: 0, Op: "Read", Value: 1},
+			{Major: 8, Minor: 16, Op: "Read", Value: 2},
+		},
+		IoServicedRecursive: []cgroups.BlkioStatEntry{
+			{Major: 8, Minor: 0, Op: "Write", Value: 3},
+		},
+	}
+	r.Decorate(&stats)
+	for _, e := range []struct {
+		entry    cgroups.BlkioStatEntry
+		expected string
+	}{
+		{stats.IoServiceBytesRecursive[0], "nvme0n1"},
+		// The device is gone.
+		{stats.IoServiceBytesRecursive[1], ""},
+		{stats.IoServicedRecursive[0], "sda"},
+	} {
+		if e.entry.Device != e.expected {
+			t.Errorf("%d:%d: expected device %q, got %q", e.entry.Major, e.entry.Minor, e.expected, e.entry.Device)
+		}
+	}
+}
@@ -1,6 +1,10 @@
 package cgroups
 
 import (
+	"context"
+
+	"golang.org/x/sys/unix"
+
 	"github.com/dims/libcontainer/configs"
 )
 
@@ -20,12 +24,24 @@ type Manager interface {
 	// GetStats returns cgroups statistics.
 	GetStats() (*Stats, error)
 
+	// GetStatsTree returns the statistics of the cgroup and every one
+	// of its sub-cgroups (see StatsTree).
+	GetStatsTree() (StatsTree, error)
+
 	// Freeze sets the freezer cgroup to the specified state.
 	Freeze(state configs.FreezerState) error
 
-	// Destroy removes cgroup.
+	// Destroy removes cgroup, along with its sub-cgroups
+	// (such as the ones created by NewChild).
 	Destroy() error
 
+	// Kill sends the specified signal to all processes in the cgroup,
+	// including its sub-cgroups, in a way that prevents them from
+	// escaping by forking. SIGKILL is sent by writing to cgroup.kill
+	// where available (cgroup v2, kernel 5.14+); otherwise, the cgroup
+	// is frozen while being signalled (see FreezeAndKill).
+	Kill(sig unix.Signal) error
+
 	// Path returns a cgroup path to the specified controller/subsystem.
 	// For cgroupv2, the argument is unused and can be empty.
 	Path(string) string
@@ -35,6 +51,28 @@ type Manager interface {
 	// to Set) are used.
 	Set(r *configs.Resources) error
 
+	// PlanApply returns the operations Apply would perform for the pid,
+	// without changing anything.
+	PlanApply(pid int) (*Plan, error)
+
+	// PlanSet returns the operations Set would perform for the resources
+	// r (file writes, unit properties and device filter programs), without
+	// changing anything. The plan is based on the current state of the
+	// cgroup, so it can be different from what a later Set does.
+	PlanSet(r *configs.Resources) (*Plan, error)
+
+	// NewChild creates a sub-cgroup called name (which must be a single
+	// path element) and returns a manager for it, with the resources r
+	// set. The controllers needed for r are enabled for the sub-cgroups;
+	// on cgroup v2, processes in this cgroup are moved into a "leaf"
+	// sub-cgroup first, as a cgroup with controllers enabled for its
+	// children can not have processes of its own. From then on, GetPids
+	// of this cgroup does not return them (GetAllPids does), and Apply
+	// adds processes to the leaf; "leaf" can not be used as name there.
+	// If r is nil or has no device rules, r.SkipDevices is assumed, so
+	// that the sub-cgroup is subject to the device rules of this cgroup.
+	NewChild(name string, r *configs.Resources) (Manager, error)
+
 	// GetPaths returns cgroup path(s) to save in a state file in order to
 	// restore later.
 	//
@@ -48,6 +86,24 @@ type Manager interface {
 	// GetCgroups returns the cgroup data as configured.
 	GetCgroups() (*configs.Cgroup, error)
 
+	// GetResources returns the resource limits currently in effect,
+	// as read back from the cgroup filesystem. Unlike GetCgroups, it
+	// reflects any changes made outside of the manager.
+	GetResources() (*configs.Resources, error)
+
+	// Reclaim makes the kernel reclaim up to bytes of the memory charged
+	// to the cgroup, overriding its swappiness (0 to 200 on cgroup v2,
+	// 0 to 100 on cgroup v1) if swappiness is not nil. It returns the
+	// amount of memory actually reclaimed, measured as the decrease of
+	// the memory usage of the cgroup, which can be less than bytes (or
+	// 0 if the usage grew in the meantime). Cgroup v2 uses memory.reclaim
+	// (kernel 5.19+). Cgroup v1 has no such interface, so it is emulated
+	// by writing memory.force_empty, which reclaims the whole memory of
+	// the cgroup. As reclaiming more than asked for can hurt the workload,
+	// a partial reclaim (bytes less than the memory usage) is rejected
+	// with ErrV1NoReclaim there, rather than done in full (see fs.Reclaim).
+	Reclaim(bytes uint64, swappiness *int) (uint64, error)
+
 	// GetFreezerState retrieves the current FreezerState of the cgroup.
 	GetFreezerState() (configs.FreezerState, error)
 
@@ -56,4 +112,28 @@ type Manager interface {
 
 	// OOMKillCount reports OOM kill count for the cgroup.
 	OOMKillCount() (uint64, error)
+
+	// NotifyOOM returns a channel which receives an event every time
+	// an OOM condition occurs in the cgroup. The channel is closed once
+	// ctx is done, or the cgroup is removed.
+	NotifyOOM(ctx context.Context) (<-chan OOMEvent, error)
+}
+
+// ThreadManager is implemented by the managers which can place individual
+// threads in the cgroup (cgroup v2 only), such as the ones of a threaded
+// cgroup (see configs.Cgroup.Threaded).
+type ThreadManager interface {
+	// GetThreads returns the thread IDs in the cgroup.
+	GetThreads() ([]int, error)
+
+	// AddThread moves the thread tid into the cgroup. Unless the cgroup
+	// is threaded, the thread's process must be in the cgroup already.
+	AddThread(tid int) error
+}
+
+// OOMEvent is sent by Manager.NotifyOOM when an OOM condition occurs.
+type OOMEvent struct {
+	// OOMKill is the number of processes killed by the OOM killer
+	// in the cgroup so far, or 0 if the kernel does not report it.
+	OOMKill uint64
 }
@@ -0,0 +1,116 @@
+package cgroups
+
+import (
+	"os"
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// DirOpener is implemented by the managers which can provide a file
+// descriptor of the cgroup directory (cgroup v2 only), so that processes
+// can be created in the cgroup directly (see PrepareCommand).
+type DirOpener interface {
+	// OpenDir opens the cgroup directory with O_PATH. The cgroup must
+	// exist (e.g. be created using Apply(-1)). The caller is responsible
+	// for closing the file.
+	OpenDir() (*os.File, error)
+}
+
+// cloneArgs is struct clone_args from linux/sched.h, up to the cgroup
+// field (added in Linux 5.7).
+type cloneArgs struct {
+	flags      uint64
+	pidFD      uint64
+	childTID   uint64
+	parentTID  uint64
+	exitSignal uint64
+	stack      uint64
+	stackSize  uint64
+	tls        uint64
+	setTID     uint64
+	setTIDSize uint64
+	cgroup     uint64
+}
+
+var (
+	cloneIntoCgroupOnce sync.Once
+	cloneIntoCgroup     bool
+)
+
+// CloneIntoCgroupSupported returns whether the kernel supports creating
+// processes in a given cgroup, i.e. clone3 with CLONE_INTO_CGROUP.
+func CloneIntoCgroupSupported() bool {
+	cloneIntoCgroupOnce.Do(func() {
+		// Call clone3 with a file descriptor which is not a cgroup
+		// directory, so that it fails in any case: the kernels which
+		// support CLONE_INTO_CGROUP return EBADF, while the older ones
+		// return E2BIG (unknown clone_args field) or ENOSYS (no clone3).
+		fd, err := unix.Open("/dev/null", unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return
+		}
+		defer unix.Close(fd)
+		args := cloneArgs{
+			flags:      unix.CLONE_INTO_CGROUP,
+			exitSignal: uint64(unix.SIGCHLD),
+			cgroup:     uint64(fd),
+		}
+		_, _, errno := unix.Syscall(unix.SYS_CLONE3, uintptr(unsafe.Pointer(&args)), unsafe.Sizeof(args), 0)
+		cloneIntoCgroup = errno == unix.EBADF
+	})
+	return cloneIntoCgroup
+}
+
+// PrepareCommand prepares cmd to be started in the cgroup managed by m.
+// If m implements DirOpener and the kernel supports CLONE_INTO_CGROUP,
+// cmd is set up to create the process in the cgroup directly, so that
+// it is never charged to the caller's cgroup and does not need to be
+// migrated. Otherwise, the process is to be moved into the cgroup using
+// m.Apply once started.
+//
+// The returned function must be called after cmd.Start, whether it
+// succeeded or not. It releases the cgroup file descriptor or, in case
+// of the fallback, calls m.Apply for the started process.
+func PrepareCommand(m Manager, cmd *exec.Cmd) (func() error, error) {
+	apply := func() error {
+		if cmd.Process == nil {
+			return nil
+		}
+		return m.Apply(cmd.Process.Pid)
+	}
+	d, ok := m.(DirOpener)
+	if !ok || !CloneIntoCgroupSupported() {
+		return apply, nil
+	}
+	dir, err := d.OpenDir()
+	if err != nil {
+		return nil, err
+	}
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(dir.Fd())
+	return dir.Close, nil
+}
+
+// StartCommand starts cmd in the cgroup managed by m, as prepared by
+// PrepareCommand. If the process can not be moved into the cgroup after
+// it is started, it is killed.
+func StartCommand(m Manager, cmd *exec.Cmd) error {
+	done, err := PrepareCommand(m, cmd)
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if doneErr := done(); doneErr != nil && err == nil {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		return doneErr
+	}
+	return err
+}
@@ -0,0 +1,63 @@
+package cgroups
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+// testManager is a Manager which records the pids passed to Apply.
+type testManager struct {
+	Manager
+	pids []int
+}
+
+func (m *testManager) Apply(pid int) error {
+	m.pids = append(m.pids, pid)
+	return nil
+}
+
+// testDirManager is a testManager which implements DirOpener.
+type testDirManager struct {
+	testManager
+	dir string
+}
+
+func (m *testDirManager) OpenDir() (*os.File, error) {
+	return os.Open(m.dir)
+}
+
+func TestStartCommandFallback(t *testing.T) {
+	m := &testManager{}
+	cmd := exec.Command("true")
+	if err := StartCommand(m, cmd); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.pids) != 1 || m.pids[0] != cmd.ProcessState.Pid() {
+		t.Errorf("expected Apply to be called with pid %d, got %v", cmd.ProcessState.Pid(), m.pids)
+	}
+}
+
+func TestPrepareCommand(t *testing.T) {
+	if !CloneIntoCgroupSupported() {
+		t.Skip("CLONE_INTO_CGROUP is not supported")
+	}
+	m := &testDirManager{dir: t.TempDir()}
+	cmd := exec.Command("true")
+	done, err := PrepareCommand(m, cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr := cmd.SysProcAttr; attr == nil || !attr.UseCgroupFD || attr.CgroupFD <= 0 {
+		t.Errorf("expected cmd to use the cgroup fd, got %+v", attr)
+	}
+	if err := done(); err != nil {
+		t.Fatal(err)
+	}
+	if len(m.pids) != 0 {
+		t.Errorf("expected Apply not to be called, got %v", m.pids)
+	}
+}
@@ -0,0 +1,259 @@
+package cpuset
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/dims/libcontainer/configs"
+)
+
+// ErrNotEnoughCPUs is returned by Allocator.Allocate when there are
+// not enough free CPUs.
+var ErrNotEnoughCPUs = errors.New("not enough free cpus")
+
+// Assignment is the cpuset allocated to a container.
+type Assignment struct {
+	// CPUs are the CPUs exclusive to the container.
+	CPUs Set
+	// Mems are the NUMA nodes of the CPUs.
+	Mems Set
+}
+
+// Apply sets the cpuset of the resources r to the assignment.
+func (a Assignment) Apply(r *configs.Resources) {
+	r.CpusetCpus = a.CPUs.String()
+	r.CpusetMems = a.Mems.String()
+}
+
+// state is the content of the state file of an Allocator.
+type state struct {
+	Reserved    Set            `json:"reserved"`
+	Assignments map[string]Set `json:"assignments"`
+}
+
+// Allocator allocates exclusive cpusets to containers, out of the CPUs of
+// the host which are not reserved (e.g. for the system daemons). The CPUs
+// of an allocation are in a single NUMA node when possible, or else in as
+// few nodes as possible, and are whole physical cores when possible.
+//
+// The assignments are kept in a state file, so that they survive the
+// restarts of the process using the allocator. An Allocator is safe for
+// concurrent use, but there must be a single one using a state file.
+type Allocator struct {
+	mu          sync.Mutex
+	topo        *Topology
+	reserved    Set
+	stateFile   string
+	assignments map[string]Set
+}
+
+// NewAllocator returns an allocator of the CPUs in the topology topo, other
+// than the reserved ones. The assignments are loaded from stateFile, if
+// it exists, and saved to it on every change. If stateFile is empty, the
+// assignments are not persisted.
+//
+// The state file must have been written using the same reserved CPUs, and
+// its assignments must be valid for topo (e.g. the CPUs must still be
+// online), otherwise an error is returned.
+func NewAllocator(topo *Topology, reserved Set, stateFile string) (*Allocator, error) {
+	all := topo.CPUSet()
+	if !reserved.IsSubsetOf(all) {
+		return nil, fmt.Errorf("reserved cpus %s are not all online (%s)", reserved, all)
+	}
+	a := &Allocator{
+		topo:        topo,
+		reserved:    reserved,
+		stateFile:   stateFile,
+		assignments: make(map[string]Set),
+	}
+	if stateFile == "" {
+		return a, nil
+	}
+	data, err := os.ReadFile(stateFile)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return a, nil
+		}
+		return nil, err
+	}
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("invalid cpuset state file %s: %w", stateFile, err)
+	}
+	if !st.Reserved.Equal(reserved) {
+		return nil, fmt.Errorf("cpuset state file %s has reserved cpus %s, not %s", stateFile, st.Reserved, reserved)
+	}
+	used := reserved
+	for id, cpus := range st.Assignments {
+		if !cpus.IsSubsetOf(all) {
+			return nil, fmt.Errorf("cpuset state file %s: cpus %s of %s are not all online (%s)", stateFile, cpus, id, all)
+		}
+		if overlap := cpus.Intersection(used); !overlap.IsEmpty() {
+			return nil, fmt.Errorf("cpuset state file %s: cpus %s of %s are reserved or assigned twice", stateFile, overlap, id)
+		}
+		used = used.Union(cpus)
+		a.assignments[id] = cpus
+	}
+	return a, nil
+}
+
+// Allocate allocates n CPUs to the container id.
+func (a *Allocator) Allocate(id string, n int) (Assignment, error) {
+	if n <= 0 {
+		return Assignment{}, fmt.Errorf("invalid number of cpus: %d", n)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if cpus, ok := a.assignments[id]; ok {
+		return Assignment{}, fmt.Errorf("cpus %s are already allocated to %s", cpus, id)
+	}
+	free := a.free()
+	if free.Size() < n {
+		return Assignment{}, fmt.Errorf("%w: %d requested, %d available", ErrNotEnoughCPUs, n, free.Size())
+	}
+	cpus := a.allocate(free, n)
+	a.assignments[id] = cpus
+	if err := a.save(); err != nil {
+		delete(a.assignments, id)
+		return Assignment{}, err
+	}
+	return a.assignment(cpus), nil
+}
+
+// Release frees the CPUs allocated to the container id, if any.
+func (a *Allocator) Release(id string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cpus, ok := a.assignments[id]
+	if !ok {
+		return nil
+	}
+	delete(a.assignments, id)
+	if err := a.save(); err != nil {
+		a.assignments[id] = cpus
+		return err
+	}
+	return nil
+}
+
+// Assignment returns the cpuset allocated to the container id.
+func (a *Allocator) Assignment(id string) (Assignment, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	cpus, ok := a.assignments[id]
+	if !ok {
+		return Assignment{}, false
+	}
+	return a.assignment(cpus), true
+}
+
+// Free returns the CPUs which are neither reserved nor allocated.
+func (a *Allocator) Free() Set {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.free()
+}
+
+func (a *Allocator) free() Set {
+	free := a.topo.CPUSet().Difference(a.reserved)
+	for _, cpus := range a.assignments {
+		free = free.Difference(cpus)
+	}
+	return free
+}
+
+func (a *Allocator) assignment(cpus Set) Assignment {
+	return Assignment{CPUs: cpus, Mems: a.topo.NodesOf(cpus)}
+}
+
+// allocate picks n out of the free CPUs, from a single NUMA node if
+// possible (the one with the fewest free CPUs, to keep the larger ones
+// for larger allocations). Otherwise, the nodes with the most free CPUs
+// are used, so that the CPUs span as few nodes as possible.
+func (a *Allocator) allocate(free Set, n int) Set {
+	nodes := a.topo.Nodes().List()
+	nodeFree := make(map[int]Set, len(nodes))
+	best := -1
+	for _, node := range nodes {
+		nodeFree[node] = free.Intersection(a.topo.NodeCPUs(node))
+		size := nodeFree[node].Size()
+		if size >= n && (best == -1 || size < nodeFree[best].Size()) {
+			best = node
+		}
+	}
+	if best != -1 {
+		return a.take(nodeFree[best], n)
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodeFree[nodes[i]].Size() > nodeFree[nodes[j]].Size()
+	})
+	cpus := New()
+	for _, node := range nodes {
+		cpus = cpus.Union(a.take(nodeFree[node], min(n-cpus.Size(), nodeFree[node].Size())))
+		if cpus.Size() == n {
+			break
+		}
+	}
+	return cpus
+}
+
+// take picks n out of the free CPUs, as whole physical cores as long as
+// possible, so that the containers do not share cores. The rest are the
+// CPUs of the cores with the fewest free CPUs, to keep the whole cores
+// free for the later allocations.
+func (a *Allocator) take(free Set, n int) Set {
+	taken := New()
+	for _, cpu := range free.List() {
+		if taken.Size() == n {
+			return taken
+		}
+		info := a.topo.CPUs[cpu]
+		if info.Core != cpu {
+			continue
+		}
+		core := a.topo.CoreCPUs(info.Core)
+		if core.IsSubsetOf(free) && taken.Size()+core.Size() <= n {
+			taken = taken.Union(core)
+		}
+	}
+
+	left := free.Difference(taken)
+	siblings := func(cpu int) int {
+		return a.topo.CoreCPUs(a.topo.CPUs[cpu].Core).Intersection(left).Size()
+	}
+	rest := left.List()
+	sort.SliceStable(rest, func(i, j int) bool {
+		return siblings(rest[i]) < siblings(rest[j])
+	})
+	return taken.Union(New(rest[:n-taken.Size()]...))
+}
+
+// save writes the assignments to the state file, atomically.
+func (a *Allocator) save() error {
+	if a.stateFile == "" {
+		return nil
+	}
+	data, err := json.Marshal(state{Reserved: a.reserved, Assignments: a.assignments})
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(a.stateFile), filepath.Base(a.stateFile)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), a.stateFile)
+}
@@ -0,0 +1,129 @@
+package cpuset
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// fakeSysfs creates a sysfs with 2 sockets (and NUMA nodes), each having
+// 2 cores of 2 threads. The siblings of CPU n are n and n+4, and node 0
+// has CPUs 0, 1, 4 and 5.
+func fakeSysfs(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	files := map[string]string{
+		"devices/system/cpu/online":         "0-7\n",
+		"devices/system/node/online":        "0-1\n",
+		"devices/system/node/node0/cpulist": "0-1,4-5\n",
+		"devices/system/node/node1/cpulist": "2-3,6-7\n",
+	}
+	for cpu := 0; cpu < 8; cpu++ {
+		dir := "devices/system/cpu/cpu" + strconv.Itoa(cpu) + "/topology/"
+		core := cpu % 4
+		files[dir+"thread_siblings_list"] = strconv.Itoa(core) + "," + strconv.Itoa(core+4) + "\n"
+		files[dir+"physical_package_id"] = strconv.Itoa(core/2) + "\n"
+	}
+	for name, data := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestDiscover(t *testing.T) {
+	topo, err := Discover(fakeSysfs(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := topo.CPUSet().String(); s != "0-7" {
+		t.Errorf("expected cpus 0-7, got %s", s)
+	}
+	if s := topo.NodeCPUs(1).String(); s != "2-3,6-7" {
+		t.Errorf("expected node 1 cpus 2-3,6-7, got %s", s)
+	}
+	if s := topo.CoreCPUs(1).String(); s != "1,5" {
+		t.Errorf("expected core 1 cpus 1,5, got %s", s)
+	}
+	if info := topo.CPUs[6]; info != (CPUInfo{Core: 2, Socket: 1, Node: 1}) {
+		t.Errorf("unexpected cpu 6 info: %+v", info)
+	}
+}
+
+func TestAllocator(t *testing.T) {
+	topo, err := Discover(fakeSysfs(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateFile := filepath.Join(t.TempDir(), "cpuset_state")
+	a, err := NewAllocator(topo, New(0), stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Node 0 has the fewest free CPUs, and only a CPU
+	// of core 0 (sibling of the reserved CPU 0) is left.
+	as, err := a.Allocate("a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if as.CPUs.String() != "4" || as.Mems.String() != "0" {
+		t.Errorf("expected cpu 4 on node 0, got %+v", as)
+	}
+	// A whole core.
+	if as, err = a.Allocate("b", 2); err != nil {
+		t.Fatal(err)
+	}
+	if as.CPUs.String() != "1,5" || as.Mems.String() != "0" {
+		t.Errorf("expected cpus 1,5 on node 0, got %+v", as)
+	}
+	// Two whole cores of node 1.
+	if as, err = a.Allocate("c", 4); err != nil {
+		t.Fatal(err)
+	}
+	if as.CPUs.String() != "2-3,6-7" || as.Mems.String() != "1" {
+		t.Errorf("expected cpus 2-3,6-7 on node 1, got %+v", as)
+	}
+	if _, err := a.Allocate("d", 1); !errors.Is(err, ErrNotEnoughCPUs) {
+		t.Errorf("expected ErrNotEnoughCPUs, got %v", err)
+	}
+	if _, err := a.Allocate("a", 1); err == nil {
+		t.Error("expected error for a second allocation, got nil")
+	}
+
+	if err := a.Release("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Release("b"); err != nil {
+		t.Fatal(err)
+	}
+	// Spanning both nodes.
+	if as, err = a.Allocate("d", 6); err != nil {
+		t.Fatal(err)
+	}
+	if as.CPUs.String() != "1-3,5-7" || as.Mems.String() != "0-1" {
+		t.Errorf("expected cpus 1-3,5-7 on nodes 0-1, got %+v", as)
+	}
+
+	// The assignments are persisted.
+	b, err := NewAllocator(topo, New(0), stateFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if as, ok := b.Assignment("d"); !ok || as.CPUs.String() != "1-3,5-7" {
+		t.Errorf("expected assignment of d to be loaded, got %+v", as)
+	}
+	if free := b.Free(); !free.IsEmpty() {
+		t.Errorf("expected no free cpus, got %s", free)
+	}
+	if _, err := NewAllocator(topo, New(1), stateFile); err == nil {
+		t.Error("expected error for different reserved cpus, got nil")
+	}
+}
@@ -0,0 +1,192 @@
+// Package cpuset provides the CPU (and memory node) list handling, and an
+// allocator of exclusive, NUMA-aligned cpusets based on the CPU topology
+// of the host.
+package cpuset
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MaxCPUs is the maximum number of CPUs (and memory nodes) in a set,
+// i.e. the largest NR_CPUS the kernel can be configured with. Larger
+// CPU numbers are rejected by Parse.
+const MaxCPUs = 8192
+
+// Set is an immutable set of CPUs (or memory nodes). The zero value
+// is an empty set.
+type Set struct {
+	elems map[int]struct{}
+}
+
+// New returns a set of the given CPUs.
+func New(cpus ...int) Set {
+	s := Set{elems: make(map[int]struct{}, len(cpus))}
+	for _, c := range cpus {
+		s.elems[c] = struct{}{}
+	}
+	return s
+}
+
+// Parse parses a list in the format of the cpuset.cpus and cpuset.mems
+// files, e.g. "0-3,8". Spaces around the elements, and empty elements,
+// are allowed. CPU numbers must be lower than MaxCPUs.
+func Parse(str string) (Set, error) {
+	s := New()
+	for _, r := range strings.Split(str, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+		first, last, isRange := strings.Cut(r, "-")
+		start, err := strconv.ParseUint(first, 10, 32)
+		if err != nil {
+			return Set{}, fmt.Errorf("invalid cpu list %q: %w", str, err)
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.ParseUint(last, 10, 32); err != nil {
+				return Set{}, fmt.Errorf("invalid cpu list %q: %w", str, err)
+			}
+			if start > end {
+				return Set{}, errors.New("invalid range: " + r)
+			}
+		}
+		if end >= MaxCPUs {
+			return Set{}, fmt.Errorf("invalid cpu list %q: cpu %d out of range (max %d)", str, end, MaxCPUs-1)
+		}
+		for i := start; i <= end; i++ {
+			s.elems[int(i)] = struct{}{}
+		}
+	}
+	return s, nil
+}
+
+// MustParse is like Parse, but panics if str can not be parsed.
+func MustParse(str string) Set {
+	s, err := Parse(str)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// String returns the set in the format of the cpuset.cpus file, with the
+// consecutive CPUs as ranges, e.g. "0-3,8". An empty set results in "".
+func (s Set) String() string {
+	var b strings.Builder
+	list := s.List()
+	for i := 0; i < len(list); {
+		j := i
+		for j+1 < len(list) && list[j+1] == list[j]+1 {
+			j++
+		}
+		if b.Len() > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.Itoa(list[i]))
+		if j > i {
+			b.WriteByte('-')
+			b.WriteString(strconv.Itoa(list[j]))
+		}
+		i = j + 1
+	}
+	return b.String()
+}
+
+// MarshalText implements encoding.TextMarshaler, using String.
+func (s Set) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, using Parse.
+func (s *Set) UnmarshalText(text []byte) error {
+	set, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+	*s = set
+	return nil
+}
+
+// List returns the CPUs in the set, sorted.
+func (s Set) List() []int {
+	list := make([]int, 0, len(s.elems))
+	for c := range s.elems {
+		list = append(list, c)
+	}
+	sort.Ints(list)
+	return list
+}
+
+// Size returns the number of CPUs in the set.
+func (s Set) Size() int {
+	return len(s.elems)
+}
+
+// IsEmpty returns whether the set has no CPUs.
+func (s Set) IsEmpty() bool {
+	return len(s.elems) == 0
+}
+
+// Contains returns whether cpu is in the set.
+func (s Set) Contains(cpu int) bool {
+	_, ok := s.elems[cpu]
+	return ok
+}
+
+// Equal returns whether s and other have the same CPUs.
+func (s Set) Equal(other Set) bool {
+	return len(s.elems) == len(other.elems) && s.IsSubsetOf(other)
+}
+
+// IsSubsetOf returns whether all the CPUs of s are in other.
+func (s Set) IsSubsetOf(other Set) bool {
+	for c := range s.elems {
+		if !other.Contains(c) {
+			return false
+		}
+	}
+	return true
+}
+
+// Union returns the CPUs which are in s or any of others.
+func (s Set) Union(others ...Set) Set {
+	u := New(s.List()...)
+	for _, o := range others {
+		for c := range o.elems {
+			u.elems[c] = struct{}{}
+		}
+	}
+	return u
+}
+
+// Intersection returns the CPUs which are in both s and other.
+func (s Set) Intersection(other Set) Set {
+	return s.filter(other.Contains)
+}
+
+// Difference returns the CPUs which are in s but not in any of others.
+func (s Set) Difference(others ...Set) Set {
+	return s.filter(func(c int) bool {
+		for _, o := range others {
+			if o.Contains(c) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func (s Set) filter(keep func(int) bool) Set {
+	f := New()
+	for c := range s.elems {
+		if keep(c) {
+			f.elems[c] = struct{}{}
+		}
+	}
+	return f
+}
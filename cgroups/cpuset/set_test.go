@@ -0,0 +1,97 @@
+package cpuset
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		in    string
+		out   string
+		isErr bool
+	}{
+		{in: "", out: ""},
+		{in: "0", out: "0"},
+		{in: "0-3", out: "0-3"},
+		{in: "3,0-2", out: "0-3"},
+		{in: "0,2,4-5,7", out: "0,2,4-5,7"},
+		{in: " 1, 3 ,,5-6,", out: "1,3,5-6"},
+		{in: "-", isErr: true},
+		{in: "1-", isErr: true},
+		{in: "-3", isErr: true},
+		{in: "5-3", isErr: true},
+		{in: "1 - 2", isErr: true},
+		{in: "a", isErr: true},
+		{in: "8191", out: "8191"},
+		{in: "8192", isErr: true},
+		{in: "0-2000000000", isErr: true},
+		{in: "4294967295", isErr: true},
+	}
+	for _, tc := range testCases {
+		s, err := Parse(tc.in)
+		if tc.isErr {
+			if err == nil {
+				t.Errorf("case %q: expected error, got nil", tc.in)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("case %q: unexpected error: %v", tc.in, err)
+			continue
+		}
+		if s.String() != tc.out {
+			t.Errorf("case %q: expected %q, got %q", tc.in, tc.out, s.String())
+		}
+	}
+}
+
+func TestSetAlgebra(t *testing.T) {
+	a := MustParse("0-5")
+	b := MustParse("4-7")
+
+	if s := a.Union(b); s.String() != "0-7" {
+		t.Errorf("expected union 0-7, got %s", s)
+	}
+	if s := a.Intersection(b); s.String() != "4-5" {
+		t.Errorf("expected intersection 4-5, got %s", s)
+	}
+	if s := a.Difference(b); s.String() != "0-3" {
+		t.Errorf("expected difference 0-3, got %s", s)
+	}
+	if s := a.Difference(New(0), New(5)); s.String() != "1-4" {
+		t.Errorf("expected difference 1-4, got %s", s)
+	}
+	if !New(1, 2).IsSubsetOf(a) || b.IsSubsetOf(a) {
+		t.Error("unexpected IsSubsetOf result")
+	}
+	if !a.Equal(New(5, 4, 3, 2, 1, 0)) || a.Equal(b) {
+		t.Error("unexpected Equal result")
+	}
+	// The operands are not modified.
+	if a.String() != "0-5" || b.String() != "4-7" {
+		t.Errorf("operands modified: %s, %s", a, b)
+	}
+	var empty Set
+	if !empty.IsEmpty() || empty.Union(b).String() != "4-7" || empty.Contains(0) {
+		t.Error("unexpected zero value behavior")
+	}
+}
+
+func TestSetJSON(t *testing.T) {
+	in := map[string]Set{"a": MustParse("0-3,8")}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"a":"0-3,8"}` {
+		t.Fatalf("unexpected JSON: %s", data)
+	}
+	var out map[string]Set
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatal(err)
+	}
+	if !out["a"].Equal(in["a"]) {
+		t.Fatalf("expected %s, got %s", in["a"], out["a"])
+	}
+}
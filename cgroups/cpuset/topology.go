@@ -0,0 +1,149 @@
+package cpuset
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// CPUInfo is the location of a CPU in the topology of the host.
+type CPUInfo struct {
+	// Core identifies the physical core the CPU is a hardware thread
+	// of, as the lowest numbered CPU of the core (so that, unlike the
+	// core ID of the kernel, it is unique across sockets).
+	Core int
+	// Socket is the physical package ID.
+	Socket int
+	// Node is the NUMA node, 0 if the host has no NUMA support.
+	Node int
+}
+
+// Topology is the CPU topology of a host.
+type Topology struct {
+	// CPUs are the online CPUs, by number.
+	CPUs map[int]CPUInfo
+}
+
+// Discover reads the CPU topology of the host from sysfsRoot (the mount
+// point of sysfs, "/sys" if empty).
+func Discover(sysfsRoot string) (*Topology, error) {
+	if sysfsRoot == "" {
+		sysfsRoot = "/sys"
+	}
+	cpuDir := filepath.Join(sysfsRoot, "devices/system/cpu")
+	online, err := readList(filepath.Join(cpuDir, "online"))
+	if err != nil {
+		return nil, err
+	}
+	t := &Topology{CPUs: make(map[int]CPUInfo, online.Size())}
+	for _, cpu := range online.List() {
+		info := CPUInfo{Core: cpu}
+		dir := filepath.Join(cpuDir, "cpu"+strconv.Itoa(cpu), "topology")
+		siblings, err := readList(filepath.Join(dir, "thread_siblings_list"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		if list := siblings.List(); len(list) > 0 {
+			info.Core = list[0]
+		}
+		if info.Socket, err = readInt(filepath.Join(dir, "physical_package_id")); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		t.CPUs[cpu] = info
+	}
+
+	// The node directory is absent if the kernel has no NUMA support.
+	nodeDir := filepath.Join(sysfsRoot, "devices/system/node")
+	nodes, err := readList(filepath.Join(nodeDir, "online"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return t, nil
+		}
+		return nil, err
+	}
+	for _, node := range nodes.List() {
+		cpus, err := readList(filepath.Join(nodeDir, "node"+strconv.Itoa(node), "cpulist"))
+		if err != nil {
+			return nil, err
+		}
+		for _, cpu := range cpus.List() {
+			if info, ok := t.CPUs[cpu]; ok {
+				info.Node = node
+				t.CPUs[cpu] = info
+			}
+		}
+	}
+	return t, nil
+}
+
+func readList(path string) (Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Set{}, err
+	}
+	s, err := Parse(strings.TrimSpace(string(data)))
+	if err != nil {
+		return Set{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return s, nil
+}
+
+func readInt(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", path, err)
+	}
+	return n, nil
+}
+
+// CPUSet returns all the CPUs of the host.
+func (t *Topology) CPUSet() Set {
+	return t.filter(func(CPUInfo) bool { return true })
+}
+
+// Nodes returns the NUMA nodes which have CPUs.
+func (t *Topology) Nodes() Set {
+	s := New()
+	for _, info := range t.CPUs {
+		s.elems[info.Node] = struct{}{}
+	}
+	return s
+}
+
+// NodeCPUs returns the CPUs of the NUMA node.
+func (t *Topology) NodeCPUs(node int) Set {
+	return t.filter(func(info CPUInfo) bool { return info.Node == node })
+}
+
+// CoreCPUs returns the CPUs of the physical core (see CPUInfo.Core).
+func (t *Topology) CoreCPUs(core int) Set {
+	return t.filter(func(info CPUInfo) bool { return info.Core == core })
+}
+
+// NodesOf returns the NUMA nodes the CPUs in s are in.
+func (t *Topology) NodesOf(s Set) Set {
+	nodes := New()
+	for cpu := range s.elems {
+		if info, ok := t.CPUs[cpu]; ok {
+			nodes.elems[info.Node] = struct{}{}
+		}
+	}
+	return nodes
+}
+
+func (t *Topology) filter(keep func(CPUInfo) bool) Set {
+	s := New()
+	for cpu, info := range t.CPUs {
+		if keep(info) {
+			s.elems[cpu] = struct{}{}
+		}
+	}
+	return s
+}
@@ -0,0 +1,279 @@
+package cgroups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// EventType is a type of cgroup v2 event, as reported by WatchEvents.
+type EventType int
+
+const (
+	// EventPopulated is sent when the "populated" field of cgroup.events
+	// changes. Value is 1 if the cgroup or any of its descendants has
+	// live processes, and 0 if the cgroup became empty.
+	EventPopulated EventType = iota + 1
+	// EventFrozen is sent when the "frozen" field of cgroup.events
+	// changes. Value is 1 once the cgroup is fully frozen, and 0 once
+	// it is thawed.
+	EventFrozen
+	// EventPidsMax is sent when a fork fails because of pids.max.
+	// Value is the "max" counter from pids.events.
+	EventPidsMax
+	// EventMemoryHigh is sent when the cgroup is throttled because of
+	// memory.high. Value is the "high" counter from memory.events.
+	EventMemoryHigh
+	// EventMemoryMax is sent when the cgroup is about to go over
+	// memory.max. Value is the "max" counter from memory.events.
+	EventMemoryMax
+	// EventOOM is sent when an allocation fails because of memory.max.
+	// Value is the "oom" counter from memory.events.
+	EventOOM
+	// EventOOMKill is sent when a process in the cgroup is killed by the
+	// OOM killer. Value is the "oom_kill" counter from memory.events.
+	EventOOMKill
+)
+
+// eventSources maps event types to the cgroup file and key they are read from.
+var eventSources = map[EventType]struct{ file, key string }{
+	EventPopulated:  {"cgroup.events", "populated"},
+	EventFrozen:     {"cgroup.events", "frozen"},
+	EventPidsMax:    {"pids.events", "max"},
+	EventMemoryHigh: {"memory.events", "high"},
+	EventMemoryMax:  {"memory.events", "max"},
+	EventOOM:        {"memory.events", "oom"},
+	EventOOMKill:    {"memory.events", "oom_kill"},
+}
+
+func (t EventType) String() string {
+	switch t {
+	case EventPopulated:
+		return "populated"
+	case EventFrozen:
+		return "frozen"
+	case EventPidsMax:
+		return "pids.max"
+	case EventMemoryHigh:
+		return "memory.high"
+	case EventMemoryMax:
+		return "memory.max"
+	case EventOOM:
+		return "oom"
+	case EventOOMKill:
+		return "oom_kill"
+	}
+	return "unknown(" + strconv.Itoa(int(t)) + ")"
+}
+
+// isState returns true if the event value is a state (0 or 1)
+// rather than a monotonically increasing counter.
+func (t EventType) isState() bool {
+	return t == EventPopulated || t == EventFrozen
+}
+
+// Event is a cgroup v2 event, as reported by WatchEvents.
+type Event struct {
+	Type EventType
+	// Value is the new state for EventPopulated and EventFrozen,
+	// or the new counter value for other event types.
+	Value uint64
+}
+
+type watchedFile struct {
+	name  string
+	types []EventType
+	last  map[string]uint64
+}
+
+// WatchEvents watches the cgroup v2 *.events files in dirPath, which are
+// needed for the specified event types, using inotify(7), and returns a
+// channel to which events are sent as they happen. A state event
+// (EventPopulated, EventFrozen) is sent when its state changes, and any
+// other event is sent when its counter is incremented.
+//
+// The channel is closed once ctx is done, or the cgroup is removed.
+func WatchEvents(ctx context.Context, dirPath string, types ...EventType) (<-chan Event, error) {
+	return watchEvents(ctx, nil, dirPath, types...)
+}
+
+func watchEvents(ctx context.Context, b Backend, dirPath string, types ...EventType) (<-chan Event, error) {
+	if len(types) == 0 {
+		return nil, errors.New("no event types specified")
+	}
+
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// A non-blocking fd is handled by the runtime poller,
+	// so a pending Read is interrupted by Close.
+	inotify := os.NewFile(uintptr(fd), "inotify")
+
+	byName := make(map[string]*watchedFile)
+	watches := make(map[int]*watchedFile)
+	for _, t := range types {
+		src, ok := eventSources[t]
+		if !ok {
+			inotify.Close()
+			return nil, fmt.Errorf("unknown cgroup event type %v", t)
+		}
+		if f := byName[src.file]; f != nil {
+			f.types = append(f.types, t)
+			continue
+		}
+		path := filepath.Join(dirPath, src.file)
+		wd, err := unix.InotifyAddWatch(fd, path, unix.IN_MODIFY)
+		if err != nil {
+			inotify.Close()
+			return nil, &os.PathError{Op: "inotify_add_watch", Path: path, Err: err}
+		}
+		f := &watchedFile{name: src.file, types: []EventType{t}}
+		byName[src.file] = f
+		watches[wd] = f
+	}
+	// Read the initial values after adding the watches, so that no
+	// change can be missed, and only the changes from now on are reported.
+	for _, f := range watches {
+		if f.last, err = readEventsFile(b, dirPath, f.name); err != nil {
+			inotify.Close()
+			return nil, err
+		}
+	}
+
+	ch := make(chan Event)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		inotify.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer close(done)
+
+		send := func(ev Event) bool {
+			select {
+			case ch <- ev:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		buf := make([]byte, unix.SizeofInotifyEvent+unix.PathMax+1)
+		for len(watches) > 0 {
+			n, err := inotify.Read(buf)
+			if err != nil {
+				return
+			}
+			for off := 0; off+unix.SizeofInotifyEvent <= n; {
+				ev := (*unix.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				off += unix.SizeofInotifyEvent + int(ev.Len)
+
+				f := watches[int(ev.Wd)]
+				if f == nil {
+					continue
+				}
+				// IN_IGNORED is sent once the watched file is gone,
+				// i.e. the cgroup is removed.
+				if ev.Mask&unix.IN_IGNORED != 0 {
+					delete(watches, int(ev.Wd))
+					continue
+				}
+				cur, err := readEventsFile(b, dirPath, f.name)
+				if err != nil {
+					delete(watches, int(ev.Wd))
+					continue
+				}
+				for _, t := range f.types {
+					key := eventSources[t].key
+					val, ok := cur[key]
+					if !ok {
+						// Partially written file (can only
+						// happen with a fake cgroupfs).
+						continue
+					}
+					old := f.last[key]
+					f.last[key] = val
+					if val == old || (!t.isState() && val < old) {
+						continue
+					}
+					if !send(Event{Type: t, Value: val}) {
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
+
+// WaitEmpty waits until the cgroup v2 at dirPath, and all its descendants,
+// have no live processes (i.e. cgroup.events reports "populated 0"). It
+// returns ctx.Err() if ctx is done before that.
+func WaitEmpty(ctx context.Context, dirPath string) error {
+	return waitEmpty(ctx, nil, dirPath)
+}
+
+func waitEmpty(ctx context.Context, b Backend, dirPath string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	events, err := watchEvents(ctx, b, dirPath, EventPopulated)
+	if err != nil {
+		return err
+	}
+	// Check the current state after setting up the watch, so that
+	// a change in between can not be missed.
+	cur, err := readEventsFile(b, dirPath, "cgroup.events")
+	if err != nil {
+		return err
+	}
+	if cur["populated"] == 0 {
+		return nil
+	}
+	for ev := range events {
+		if ev.Value == 0 {
+			return nil
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	// The channel was closed because the cgroup was removed,
+	// which is only possible once it is empty.
+	return nil
+}
+
+// readEventsFile parses a "key value" kind of cgroup file, such as
+// cgroup.events or memory.events.
+func readEventsFile(b Backend, dirPath, file string) (map[string]uint64, error) {
+	data, err := readFile(b, dirPath, file)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]uint64)
+	for _, line := range strings.Split(data, "\n") {
+		parts := strings.Fields(line)
+		if len(parts) != 2 {
+			continue
+		}
+		v, err := strconv.ParseUint(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse %s: %w", filepath.Join(dirPath, file), err)
+		}
+		values[parts[0]] = v
+	}
+	return values, nil
+}
@@ -0,0 +1,150 @@
+package cgroups
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeEventsFile(t *testing.T, dir, file, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, file), []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func expectEvent(t *testing.T, ch <-chan Event, expected Event) {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatalf("channel closed, expected %v event", expected.Type)
+		}
+		if ev != expected {
+			t.Fatalf("expected event %+v, got %+v", expected, ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %v event", expected.Type)
+	}
+}
+
+func expectClosed(t *testing.T, ch <-chan Event) {
+	t.Helper()
+	select {
+	case ev, ok := <-ch:
+		if ok {
+			t.Fatalf("expected channel to be closed, got %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the channel to be closed")
+	}
+}
+
+func TestWatchEvents(t *testing.T) {
+	// We're using a fake cgroupfs.
+	TestMode = true
+	dir := t.TempDir()
+	writeEventsFile(t, dir, "cgroup.events", "populated 1\nfrozen 0\n")
+	writeEventsFile(t, dir, "pids.events", "max 0\n")
+	writeEventsFile(t, dir, "memory.events", "low 0\nhigh 3\nmax 0\noom 0\noom_kill 0\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := WatchEvents(ctx, dir, EventPopulated, EventFrozen, EventPidsMax, EventMemoryHigh)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeEventsFile(t, dir, "cgroup.events", "populated 1\nfrozen 1\n")
+	expectEvent(t, ch, Event{Type: EventFrozen, Value: 1})
+
+	writeEventsFile(t, dir, "pids.events", "max 2\n")
+	expectEvent(t, ch, Event{Type: EventPidsMax, Value: 2})
+
+	// oom_kill is not watched, so only memory.high is reported.
+	writeEventsFile(t, dir, "memory.events", "low 0\nhigh 4\nmax 0\noom 1\noom_kill 1\n")
+	expectEvent(t, ch, Event{Type: EventMemoryHigh, Value: 4})
+
+	writeEventsFile(t, dir, "cgroup.events", "populated 0\nfrozen 0\n")
+	expectEvent(t, ch, Event{Type: EventPopulated, Value: 0})
+	expectEvent(t, ch, Event{Type: EventFrozen, Value: 0})
+
+	// Once all the files are gone, the channel is closed.
+	for _, f := range []string{"cgroup.events", "pids.events", "memory.events"} {
+		if err := os.Remove(filepath.Join(dir, f)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expectClosed(t, ch)
+}
+
+func TestWatchEventsCancel(t *testing.T) {
+	TestMode = true
+	dir := t.TempDir()
+	writeEventsFile(t, dir, "cgroup.events", "populated 1\nfrozen 0\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := WatchEvents(ctx, dir, EventPopulated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	expectClosed(t, ch)
+}
+
+func TestWatchEventsErrors(t *testing.T) {
+	TestMode = true
+	dir := t.TempDir()
+
+	if _, err := WatchEvents(context.Background(), dir); err == nil {
+		t.Error("expected an error with no event types, got nil")
+	}
+	if _, err := WatchEvents(context.Background(), dir, EventType(100)); err == nil {
+		t.Error("expected an error with an unknown event type, got nil")
+	}
+	if _, err := WatchEvents(context.Background(), dir, EventPidsMax); err == nil {
+		t.Error("expected an error for a missing pids.events, got nil")
+	}
+}
+
+func TestWaitEmpty(t *testing.T) {
+	TestMode = true
+	dir := t.TempDir()
+	writeEventsFile(t, dir, "cgroup.events", "populated 1\nfrozen 0\n")
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- WaitEmpty(context.Background(), dir)
+	}()
+
+	// Make sure WaitEmpty is still waiting.
+	select {
+	case err := <-errCh:
+		t.Fatalf("WaitEmpty returned early: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	writeEventsFile(t, dir, "cgroup.events", "populated 0\nfrozen 0\n")
+	select {
+	case err := <-errCh:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for WaitEmpty to return")
+	}
+}
+
+func TestWaitEmptyTimeout(t *testing.T) {
+	TestMode = true
+	dir := t.TempDir()
+	writeEventsFile(t, dir, "cgroup.events", "populated 1\nfrozen 0\n")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := WaitEmpty(ctx, dir); err != context.DeadlineExceeded { //nolint:errorlint // ctx.Err() is not wrapped
+		t.Fatalf("expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
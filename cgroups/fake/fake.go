@@ -0,0 +1,521 @@
+// Package fake provides an in-memory implementation of cgroups.Manager,
+// for the unit tests of the code using cgroup managers.
+package fake
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+	"github.com/dims/libcontainer/utils"
+)
+
+// Root is the fake cgroup root the paths of the managers are under.
+const Root = "/sys/fs/cgroup"
+
+// Call is a recorded call of a Manager method.
+type Call struct {
+	// Method is the name of the method, e.g. "Apply".
+	Method string
+	// Args are the arguments of the call.
+	Args []interface{}
+}
+
+// Manager is a fake cgroups.Manager which keeps the state of the cgroup
+// in memory: whether it exists, its processes, resources, freezer state
+// and sub-cgroups. It simulates the effects of the methods on the state,
+// such as Apply adding a process, in the way the cgroup v2 managers do.
+//
+// The errors returned by the methods can be injected using SetError, and
+// the statistics returned by GetStats using SetStats. All the calls are
+// recorded (see Calls).
+type Manager struct {
+	// mu is shared by a manager and its sub-cgroups.
+	mu *sync.Mutex
+
+	config    *configs.Cgroup
+	path      string
+	parent    *Manager
+	exists    bool
+	pids      []int
+	resources *configs.Resources
+	state     configs.FreezerState
+	noFreezer bool
+	children  map[string]*Manager
+	stats     *cgroups.Stats
+	oomKills  uint64
+	oomCh     []chan cgroups.OOMEvent
+	errs      map[string]error
+	calls     []Call
+}
+
+var _ cgroups.Manager = (*Manager)(nil)
+
+// New returns a fake manager for config. Like the real managers, it does
+// not create the cgroup until Apply is called. The cgroup path is set
+// from config (see Path), and is always under Root.
+func New(config *configs.Cgroup) *Manager {
+	inner := utils.CleanPath(config.Path)
+	if inner == "" {
+		inner = filepath.Join(utils.CleanPath(config.Parent), utils.CleanPath(config.Name))
+	}
+	return newManager(&sync.Mutex{}, config, filepath.Join(Root, inner), nil)
+}
+
+func newManager(mu *sync.Mutex, config *configs.Cgroup, path string, parent *Manager) *Manager {
+	return &Manager{
+		mu:        mu,
+		config:    config,
+		path:      path,
+		parent:    parent,
+		resources: config.Resources.Clone(),
+		children:  make(map[string]*Manager),
+		errs:      make(map[string]error),
+	}
+}
+
+// SetError makes method (e.g. "Set") return err, or, if err is nil,
+// succeed again. The state is not changed by the failing calls.
+func (m *Manager) SetError(method string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err == nil {
+		delete(m.errs, method)
+		return
+	}
+	m.errs[method] = err
+}
+
+// DisableFreezer makes the cgroup behave as if the kernel had no freezer
+// support: GetFreezerState returns Undefined, and Freeze fails.
+func (m *Manager) DisableFreezer() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.noFreezer = true
+}
+
+// SetStats sets the statistics returned by GetStats. The pids statistics
+// are always filled in from the state of the cgroup.
+func (m *Manager) SetStats(stats *cgroups.Stats) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.stats = stats
+}
+
+// Calls returns the calls of the methods made so far, in order.
+func (m *Manager) Calls() []Call {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Call(nil), m.calls...)
+}
+
+// OOM simulates an OOM kill in the cgroup: the OOM kill count is
+// increased, and an event is sent to the channels returned by NotifyOOM.
+func (m *Manager) OOM() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.oomKills++
+	for _, ch := range m.oomCh {
+		select {
+		case ch <- cgroups.OOMEvent{OOMKill: m.oomKills}:
+		default:
+		}
+	}
+}
+
+// call records the call of method, returning the injected error, if any.
+// It must be called with m.mu held.
+func (m *Manager) call(method string, args ...interface{}) error {
+	m.calls = append(m.calls, Call{Method: method, Args: args})
+	return m.errs[method]
+}
+
+func (m *Manager) notExist() error {
+	return &os.PathError{Op: "open", Path: m.path, Err: os.ErrNotExist}
+}
+
+// allPids returns the processes in the cgroup and its sub-cgroups.
+func (m *Manager) allPids() []int {
+	pids := append([]int(nil), m.pids...)
+	for _, c := range m.children {
+		pids = append(pids, c.allPids()...)
+	}
+	return pids
+}
+
+// removePid removes pid from the cgroup tree m is in,
+// as a process can only be in a single cgroup.
+func (m *Manager) removePid(pid int) {
+	root := m
+	for root.parent != nil {
+		root = root.parent
+	}
+	root.walk(func(c *Manager) {
+		for i, p := range c.pids {
+			if p == pid {
+				c.pids = append(c.pids[:i], c.pids[i+1:]...)
+				break
+			}
+		}
+	})
+}
+
+func (m *Manager) walk(fn func(*Manager)) {
+	fn(m)
+	for _, c := range m.children {
+		c.walk(fn)
+	}
+}
+
+func (m *Manager) Apply(pid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("Apply", pid); err != nil {
+		return err
+	}
+	m.exists = true
+	if pid != -1 {
+		m.removePid(pid)
+		m.pids = append(m.pids, pid)
+	}
+	return nil
+}
+
+func (m *Manager) GetPids() ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("GetPids"); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	return append([]int{}, m.pids...), nil
+}
+
+func (m *Manager) GetAllPids() ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("GetAllPids"); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	return m.allPids(), nil
+}
+
+func (m *Manager) GetStats() (*cgroups.Stats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("GetStats"); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	return m.getStats(), nil
+}
+
+func (m *Manager) getStats() *cgroups.Stats {
+	stats := cgroups.NewStats()
+	if m.stats != nil {
+		*stats = *m.stats
+	}
+	stats.PidsStats.Current = uint64(len(m.allPids()))
+	if m.resources != nil && m.resources.PidsLimit > 0 {
+		stats.PidsStats.Limit = uint64(m.resources.PidsLimit)
+	}
+	return stats
+}
+
+// GetStatsTree returns the statistics of the cgroup and of its
+// sub-cgroups (created by NewChild), each as returned by its GetStats.
+func (m *Manager) GetStatsTree() (cgroups.StatsTree, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("GetStatsTree"); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	tree := make(cgroups.StatsTree)
+	m.walk(func(c *Manager) {
+		rel, _ := filepath.Rel(m.path, c.path)
+		tree[rel] = c.getStats()
+	})
+	return tree, nil
+}
+
+func (m *Manager) Freeze(state configs.FreezerState) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("Freeze", state); err != nil {
+		return err
+	}
+	if !m.exists {
+		return m.notExist()
+	}
+	if m.noFreezer {
+		return errors.New("freezer not supported")
+	}
+	switch state {
+	case configs.Frozen, configs.Thawed:
+		m.state = state
+	default:
+		return fmt.Errorf("invalid freezer state %q", state)
+	}
+	return nil
+}
+
+func (m *Manager) Destroy() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("Destroy"); err != nil {
+		return err
+	}
+	if !m.exists {
+		return nil
+	}
+	// As with rmdir(2), a cgroup with processes can not be removed.
+	if len(m.allPids()) > 0 {
+		return &os.PathError{Op: "rmdir", Path: m.path, Err: unix.EBUSY}
+	}
+	m.walk(func(c *Manager) {
+		c.exists = false
+		c.state = configs.Undefined
+		for _, ch := range c.oomCh {
+			close(ch)
+		}
+		c.oomCh = nil
+	})
+	m.children = make(map[string]*Manager)
+	if m.parent != nil {
+		delete(m.parent.children, filepath.Base(m.path))
+	}
+	return nil
+}
+
+func (m *Manager) Kill(sig unix.Signal) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("Kill", sig); err != nil {
+		return err
+	}
+	if !m.exists {
+		return m.notExist()
+	}
+	// Only SIGKILL is sure to terminate the processes.
+	if sig == unix.SIGKILL {
+		m.walk(func(c *Manager) {
+			c.pids = nil
+		})
+	}
+	return nil
+}
+
+func (m *Manager) Path(subsys string) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_ = m.call("Path", subsys)
+	return m.path
+}
+
+func (m *Manager) Set(r *configs.Resources) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("Set", r); err != nil {
+		return err
+	}
+	if r == nil {
+		r = m.resources
+	}
+	if !m.exists {
+		return m.notExist()
+	}
+	m.resources = r.Clone()
+	return nil
+}
+
+// PlanApply returns the plan to create the cgroup and add the process
+// to it, without changing anything.
+func (m *Manager) PlanApply(pid int) (*cgroups.Plan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("PlanApply", pid); err != nil {
+		return nil, err
+	}
+	p := &cgroups.Plan{}
+	if !m.exists {
+		p.Add(cgroups.Op{Type: cgroups.OpMkdir, Path: m.path})
+	}
+	if pid != -1 {
+		p.Add(cgroups.Op{Type: cgroups.OpWriteFile, Path: m.path, File: cgroups.CgroupProcesses, Value: fmt.Sprint(pid)})
+	}
+	return p, nil
+}
+
+// PlanSet returns an empty plan, as the fake manager has no files.
+func (m *Manager) PlanSet(r *configs.Resources) (*cgroups.Plan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("PlanSet", r); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	return &cgroups.Plan{}, nil
+}
+
+func (m *Manager) NewChild(name string, r *configs.Resources) (cgroups.Manager, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("NewChild", name, r); err != nil {
+		return nil, err
+	}
+	if err := cgroups.CheckChildName(name); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	if r == nil {
+		r = &configs.Resources{}
+	}
+	child, ok := m.children[name]
+	if !ok {
+		child = newManager(m.mu, &configs.Cgroup{Rootless: m.config.Rootless}, filepath.Join(m.path, name), m)
+		child.exists = true
+		m.children[name] = child
+	}
+	child.resources = r.Clone()
+	return child, nil
+}
+
+func (m *Manager) GetPaths() map[string]string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_ = m.call("GetPaths")
+	return map[string]string{"": m.path}
+}
+
+func (m *Manager) GetCgroups() (*configs.Cgroup, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("GetCgroups"); err != nil {
+		return nil, err
+	}
+	return m.config, nil
+}
+
+// GetResources returns the resources last set by Set (or NewChild),
+// or the ones from the config.
+func (m *Manager) GetResources() (*configs.Resources, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("GetResources"); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	if m.resources == nil {
+		return &configs.Resources{}, nil
+	}
+	return m.resources.Clone(), nil
+}
+
+// GetFreezerState returns the freezer state of the cgroup which, like
+// the effective state of a real cgroup, is Frozen if the cgroup or any
+// of its ancestors is frozen.
+func (m *Manager) GetFreezerState() (configs.FreezerState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("GetFreezerState"); err != nil {
+		return configs.Undefined, err
+	}
+	if !m.exists || m.noFreezer {
+		return configs.Undefined, nil
+	}
+	for c := m; c != nil; c = c.parent {
+		if c.state == configs.Frozen {
+			return configs.Frozen, nil
+		}
+	}
+	return configs.Thawed, nil
+}
+
+func (m *Manager) Exists() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_ = m.call("Exists")
+	return m.exists
+}
+
+func (m *Manager) OOMKillCount() (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("OOMKillCount"); err != nil {
+		return 0, err
+	}
+	return m.oomKills, nil
+}
+
+// NotifyOOM returns a channel receiving the events simulated by OOM.
+func (m *Manager) NotifyOOM(ctx context.Context) (<-chan cgroups.OOMEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("NotifyOOM", ctx); err != nil {
+		return nil, err
+	}
+	if !m.exists {
+		return nil, m.notExist()
+	}
+	ch := make(chan cgroups.OOMEvent, 1)
+	m.oomCh = append(m.oomCh, ch)
+	go func() {
+		<-ctx.Done()
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, c := range m.oomCh {
+			if c == ch {
+				m.oomCh = append(m.oomCh[:i], m.oomCh[i+1:]...)
+				close(ch)
+				break
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// Reclaim simulates memory reclaim by decreasing the memory usage set
+// by SetStats by up to bytes.
+func (m *Manager) Reclaim(bytes uint64, swappiness *int) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.call("Reclaim", bytes, swappiness); err != nil {
+		return 0, err
+	}
+	if !m.exists {
+		return 0, m.notExist()
+	}
+	if m.stats == nil {
+		return 0, nil
+	}
+	// Do not modify the statistics passed to SetStats.
+	stats := *m.stats
+	m.stats = &stats
+	usage := &m.stats.MemoryStats.Usage.Usage
+	reclaimed := min(bytes, *usage)
+	*usage -= reclaimed
+	return reclaimed, nil
+}
@@ -0,0 +1,153 @@
+package fake
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestManager(t *testing.T) {
+	m := New(&configs.Cgroup{Path: "/test", Resources: &configs.Resources{}})
+	if m.Exists() {
+		t.Fatal("expected the cgroup not to exist before Apply")
+	}
+	if err := m.Apply(100); err != nil {
+		t.Fatal(err)
+	}
+	r := &configs.Resources{PidsLimit: 10}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	// The resources are copied, as a real cgroup is not changed
+	// by modifying them afterwards.
+	r.PidsLimit = 20
+	child, err := m.NewChild("child", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A process is only in one cgroup.
+	if err := child.Apply(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := child.Apply(101); err != nil {
+		t.Fatal(err)
+	}
+	if pids, _ := m.GetPids(); len(pids) != 0 {
+		t.Fatalf("expected no processes, got %v", pids)
+	}
+	stats, err := m.GetStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.PidsStats.Current != 2 || stats.PidsStats.Limit != 10 {
+		t.Fatalf("unexpected pids stats %+v", stats.PidsStats)
+	}
+
+	if err := m.Freeze(configs.Frozen); err != nil {
+		t.Fatal(err)
+	}
+	if state, _ := child.GetFreezerState(); state != configs.Frozen {
+		t.Fatalf("expected the child to be frozen, got %q", state)
+	}
+
+	if err := m.Destroy(); !errors.Is(err, unix.EBUSY) {
+		t.Fatalf("expected EBUSY error for a populated cgroup, got %v", err)
+	}
+	if err := m.Kill(unix.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Destroy(); err != nil {
+		t.Fatal(err)
+	}
+	if m.Exists() || child.Exists() {
+		t.Fatal("expected the cgroups to be removed")
+	}
+}
+
+func TestOOM(t *testing.T) {
+	m := New(&configs.Cgroup{Path: "/test"})
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := m.NotifyOOM(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.OOM()
+	if ev := <-ch; ev.OOMKill != 1 {
+		t.Fatalf("expected an OOM kill event, got %+v", ev)
+	}
+	if n, _ := m.OOMKillCount(); n != 1 {
+		t.Fatalf("expected an OOM kill count of 1, got %d", n)
+	}
+	cancel()
+	for range ch { //nolint:revive // Wait for the channel to be closed.
+	}
+}
+
+func TestReclaim(t *testing.T) {
+	m := New(&configs.Cgroup{Path: "/test"})
+	if err := m.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	stats := cgroups.NewStats()
+	stats.MemoryStats.Usage.Usage = 8192
+	m.SetStats(stats)
+	if n, err := m.Reclaim(4096, nil); err != nil || n != 4096 {
+		t.Fatalf("expected 4096 bytes to be reclaimed, got %d (%v)", n, err)
+	}
+	if n, err := m.Reclaim(8192, nil); err != nil || n != 4096 {
+		t.Fatalf("expected the remaining 4096 bytes to be reclaimed, got %d (%v)", n, err)
+	}
+	if st, _ := m.GetStats(); st.MemoryStats.Usage.Usage != 0 {
+		t.Fatalf("expected no memory usage, got %d", st.MemoryStats.Usage.Usage)
+	}
+	if stats.MemoryStats.Usage.Usage != 8192 {
+		t.Fatal("the statistics passed to SetStats were modified")
+	}
+}
+
+// TestMethods checks that every cgroups.Manager method is recorded,
+// and returns the injected error.
+func TestMethods(t *testing.T) {
+	iface := reflect.TypeOf((*cgroups.Manager)(nil)).Elem()
+	errType := reflect.TypeOf((*error)(nil)).Elem()
+	ctxType := reflect.TypeOf((*context.Context)(nil)).Elem()
+	injected := errors.New("injected")
+
+	for i := 0; i < iface.NumMethod(); i++ {
+		method := iface.Method(i)
+		t.Run(method.Name, func(t *testing.T) {
+			m := New(&configs.Cgroup{Path: "/test"})
+			m.SetError(method.Name, injected)
+			args := make([]reflect.Value, method.Type.NumIn())
+			for j := range args {
+				typ := method.Type.In(j)
+				if typ == ctxType {
+					args[j] = reflect.ValueOf(context.Background())
+				} else {
+					args[j] = reflect.Zero(typ)
+				}
+			}
+			out := reflect.ValueOf(m).MethodByName(method.Name).Call(args)
+
+			if last := method.Type.NumOut() - 1; last >= 0 && method.Type.Out(last) == errType {
+				if err, _ := out[last].Interface().(error); err != injected { //nolint:errorlint // The error is not to be wrapped.
+					t.Errorf("expected the injected error, got %v", err)
+				}
+			}
+			calls := m.Calls()
+			if len(calls) != 1 || calls[0].Method != method.Name {
+				t.Errorf("expected a single call of %s recorded, got %+v", method.Name, calls)
+			}
+		})
+	}
+}
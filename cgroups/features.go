@@ -0,0 +1,259 @@
+package cgroups
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Mode is the way the cgroup filesystem is mounted on the host.
+type Mode int
+
+const (
+	// Legacy is cgroup v1 only.
+	Legacy Mode = iota + 1
+	// Hybrid is cgroup v1, with the cgroup v2 hierarchy (having no
+	// controllers) mounted at /sys/fs/cgroup/unified.
+	Hybrid
+	// Unified is cgroup v2 only.
+	Unified
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Legacy:
+		return "legacy"
+	case Hybrid:
+		return "hybrid"
+	case Unified:
+		return "unified"
+	}
+	return "unknown"
+}
+
+func (m Mode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func getMode() Mode {
+	if IsCgroup2UnifiedMode() {
+		return Unified
+	}
+	if IsCgroup2HybridMode() {
+		return Hybrid
+	}
+	return Legacy
+}
+
+// Knobs reports which of the optional cgroup interface files, depending
+// on the kernel version and configuration, are available. The cgroup v1
+// equivalent of a file is used where there is one.
+type Knobs struct {
+	// MemoryPeak is memory.peak (kernel 5.19+), or
+	// memory.max_usage_in_bytes on cgroup v1.
+	MemoryPeak bool `json:"memory_peak"`
+	// MemorySwapPeak is memory.swap.peak (kernel 6.5+), or
+	// memory.memsw.max_usage_in_bytes on cgroup v1.
+	MemorySwapPeak bool `json:"memory_swap_peak"`
+	// CPUBurst is cpu.max.burst (kernel 5.14+),
+	// or cpu.cfs_burst_us on cgroup v1.
+	CPUBurst bool `json:"cpu_burst"`
+	// CPUIdle is cpu.idle (kernel 5.15+).
+	CPUIdle bool `json:"cpu_idle"`
+	// BFQWeight is io.bfq.weight, or blkio.bfq.weight on cgroup v1,
+	// available when the BFQ I/O scheduler is in use.
+	BFQWeight bool `json:"bfq_weight"`
+	// BFQDeviceWeight is the support for per-device BFQ weights
+	// (kernel 5.4+).
+	BFQDeviceWeight bool `json:"bfq_device_weight"`
+	// Kill is cgroup.kill (cgroup v2, kernel 5.14+).
+	Kill bool `json:"kill"`
+	// Freeze is cgroup.freeze (kernel 5.2+), or freezer.state
+	// on cgroup v1.
+	Freeze bool `json:"freeze"`
+	// HugetlbRsvd is hugetlb.<size>.rsvd.max (kernel 5.7+), or
+	// hugetlb.<size>.rsvd.limit_in_bytes on cgroup v1.
+	HugetlbRsvd bool `json:"hugetlb_rsvd"`
+	// CloneIntoCgroup is the support for creating processes in a cgroup
+	// (cgroup v2, kernel 5.7+), see PrepareCommand.
+	CloneIntoCgroup bool `json:"clone_into_cgroup"`
+}
+
+// FeatureSet is the set of cgroup features available at a cgroup, as
+// reported by Features and FeaturesAt.
+type FeatureSet struct {
+	// Mode is the cgroup mode of the host.
+	Mode Mode `json:"mode"`
+	// Controllers are the controllers available in the cgroup. For
+	// cgroup v2, these are the ones listed in cgroup.controllers; for
+	// cgroup v1, the mounted ones for which the cgroup exists.
+	Controllers []string `json:"controllers"`
+	// Delegated are the controllers which can be used in the sub-cgroups.
+	// For cgroup v2, these are the available controllers if the caller
+	// can enable them (i.e. cgroup.subtree_control is writable), or the
+	// ones already enabled otherwise; for cgroup v1, the controllers for
+	// which the cgroup is writable.
+	Delegated []string `json:"delegated"`
+	// Knobs are the optional interface files available in the cgroup.
+	Knobs Knobs `json:"knobs"`
+}
+
+// Features probes the cgroup features available at the cgroup of the
+// current process.
+func Features() (*FeatureSet, error) {
+	cgroups, err := ParseCgroupFile("/proc/self/cgroup")
+	if err != nil {
+		return nil, err
+	}
+	if IsCgroup2UnifiedMode() {
+		return featuresV2(filepath.Join(unifiedMountpoint, cgroups[""]))
+	}
+	mounts, err := getCgroupMountsV1(false)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]string)
+	for _, m := range mounts {
+		for _, ss := range m.Subsystems {
+			path, err := getControllerPath(ss, cgroups)
+			if err != nil {
+				continue
+			}
+			// See getCgroupPathHelper.
+			rel, err := filepath.Rel(m.Root, path)
+			if err != nil {
+				continue
+			}
+			dirs[ss] = filepath.Join(m.Mountpoint, rel)
+		}
+	}
+	return featuresV1(dirs), nil
+}
+
+// FeaturesAt probes the cgroup features available at the cgroup path,
+// relative to the cgroup root (as in configs.Cgroup.Path). The cgroup
+// must exist.
+func FeaturesAt(path string) (*FeatureSet, error) {
+	if IsCgroup2UnifiedMode() {
+		return featuresV2(filepath.Join(unifiedMountpoint, path))
+	}
+	mounts, err := getCgroupMountsV1(false)
+	if err != nil {
+		return nil, err
+	}
+	dirs := make(map[string]string)
+	for _, m := range mounts {
+		for _, ss := range m.Subsystems {
+			dirs[ss] = filepath.Join(m.Mountpoint, path)
+		}
+	}
+	f := featuresV1(dirs)
+	if len(f.Controllers) == 0 {
+		return nil, &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+	return f, nil
+}
+
+func featuresV2(dir string) (*FeatureSet, error) {
+	data, err := ReadFile(dir, "cgroup.controllers")
+	if err != nil {
+		return nil, err
+	}
+	f := &FeatureSet{
+		Mode:        Unified,
+		Controllers: strings.Fields(data),
+	}
+	if unix.Access(filepath.Join(dir, "cgroup.subtree_control"), unix.W_OK) == nil {
+		f.Delegated = f.Controllers
+	} else {
+		data, err := ReadFile(dir, "cgroup.subtree_control")
+		if err != nil {
+			return nil, err
+		}
+		f.Delegated = strings.Fields(data)
+	}
+
+	exists := func(file string) bool {
+		return PathExists(filepath.Join(dir, file))
+	}
+	f.Knobs = Knobs{
+		MemoryPeak:      exists("memory.peak"),
+		MemorySwapPeak:  exists("memory.swap.peak"),
+		CPUBurst:        exists("cpu.max.burst"),
+		CPUIdle:         exists("cpu.idle"),
+		BFQWeight:       exists("io.bfq.weight"),
+		Kill:            exists("cgroup.kill"),
+		Freeze:          exists("cgroup.freeze"),
+		HugetlbRsvd:     hugetlbRsvdExists(dir, ".rsvd.max"),
+		CloneIntoCgroup: CloneIntoCgroupSupported(),
+	}
+	if bfq, err := OpenFile(dir, "io.bfq.weight", os.O_RDONLY); err == nil {
+		f.Knobs.BFQDeviceWeight = BFQDeviceWeightSupported(bfq)
+		bfq.Close()
+	}
+	return f, nil
+}
+
+// featuresV1 probes the cgroup features, given the cgroup directories
+// of the controllers.
+func featuresV1(dirs map[string]string) *FeatureSet {
+	f := &FeatureSet{Mode: getMode()}
+	exists := func(ss, file string) bool {
+		dir, ok := dirs[ss]
+		return ok && PathExists(filepath.Join(dir, file))
+	}
+	for ss, dir := range dirs {
+		if !PathExists(dir) {
+			continue
+		}
+		f.Controllers = append(f.Controllers, ss)
+		if unix.Access(dir, unix.W_OK) == nil {
+			f.Delegated = append(f.Delegated, ss)
+		}
+	}
+	sort.Strings(f.Controllers)
+	sort.Strings(f.Delegated)
+	f.Knobs = Knobs{
+		MemoryPeak:      exists("memory", "memory.max_usage_in_bytes"),
+		MemorySwapPeak:  exists("memory", "memory.memsw.max_usage_in_bytes"),
+		CPUBurst:        exists("cpu", "cpu.cfs_burst_us"),
+		CPUIdle:         exists("cpu", "cpu.idle"),
+		BFQWeight:       exists("blkio", "blkio.bfq.weight"),
+		BFQDeviceWeight: exists("blkio", "blkio.bfq.weight_device"),
+		Freeze:          exists("freezer", "freezer.state"),
+	}
+	if dir, ok := dirs["hugetlb"]; ok {
+		f.Knobs.HugetlbRsvd = hugetlbRsvdExists(dir, ".rsvd.limit_in_bytes")
+	}
+	return f
+}
+
+// hugetlbRsvdExists returns whether the hugetlb reservation
+// file with the suffix exists in dir, for any huge page size.
+func hugetlbRsvdExists(dir, suffix string) bool {
+	for _, size := range HugePageSizes() {
+		if PathExists(filepath.Join(dir, "hugetlb."+size+suffix)) {
+			return true
+		}
+	}
+	return false
+}
+
+// BFQDeviceWeightSupported checks for per-device BFQ weight support (added
+// in kernel v5.4, commit 795fe54c2a8) by reading from "io.bfq.weight".
+func BFQDeviceWeightSupported(bfq *os.File) bool {
+	if bfq == nil {
+		return false
+	}
+	_, _ = bfq.Seek(0, 0)
+	buf := make([]byte, 32)
+	_, _ = bfq.Read(buf)
+	// If only a single number (default weight) if read back, we have older kernel.
+	_, err := strconv.ParseInt(string(bytes.TrimSpace(buf)), 10, 64)
+	return err != nil
+}
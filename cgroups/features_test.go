@@ -0,0 +1,89 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFeaturesV2(t *testing.T) {
+	TestMode = true
+	dir := t.TempDir()
+	for file, data := range map[string]string{
+		"cgroup.controllers":     "cpu io memory pids\n",
+		"cgroup.subtree_control": "",
+		"cgroup.freeze":          "0\n",
+		"cgroup.kill":            "",
+		"cpu.idle":               "0\n",
+		"io.bfq.weight":          "default 100\n",
+		"memory.peak":            "0\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f, err := featuresV2(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Mode != Unified {
+		t.Errorf("expected unified mode, got %v", f.Mode)
+	}
+	controllers := []string{"cpu", "io", "memory", "pids"}
+	if !reflect.DeepEqual(f.Controllers, controllers) {
+		t.Errorf("expected controllers %v, got %v", controllers, f.Controllers)
+	}
+	// cgroup.subtree_control is writable, so all the controllers can be enabled.
+	if !reflect.DeepEqual(f.Delegated, controllers) {
+		t.Errorf("expected delegated controllers %v, got %v", controllers, f.Delegated)
+	}
+	knobs := Knobs{
+		MemoryPeak:      true,
+		CPUIdle:         true,
+		BFQWeight:       true,
+		BFQDeviceWeight: true,
+		Kill:            true,
+		Freeze:          true,
+		CloneIntoCgroup: CloneIntoCgroupSupported(),
+	}
+	if f.Knobs != knobs {
+		t.Errorf("expected knobs %+v, got %+v", knobs, f.Knobs)
+	}
+
+	if _, err := featuresV2(filepath.Join(dir, "missing")); !os.IsNotExist(err) {
+		t.Errorf("expected ENOENT error for a missing cgroup, got %v", err)
+	}
+}
+
+func TestFeaturesV1(t *testing.T) {
+	TestMode = true
+	root := t.TempDir()
+	dirs := make(map[string]string)
+	for _, ss := range []string{"cpu", "memory", "pids"} {
+		dirs[ss] = filepath.Join(root, ss)
+	}
+	for ss, file := range map[string]string{
+		"cpu":    "cpu.cfs_burst_us",
+		"memory": "memory.max_usage_in_bytes",
+	} {
+		if err := os.MkdirAll(dirs[ss], 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dirs[ss], file), []byte("0\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := featuresV1(dirs)
+	// The pids cgroup does not exist.
+	controllers := []string{"cpu", "memory"}
+	if !reflect.DeepEqual(f.Controllers, controllers) {
+		t.Errorf("expected controllers %v, got %v", controllers, f.Controllers)
+	}
+	knobs := Knobs{MemoryPeak: true, CPUBurst: true}
+	if f.Knobs != knobs {
+		t.Errorf("expected knobs %+v, got %+v", knobs, f.Knobs)
+	}
+}
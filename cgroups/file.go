@@ -25,13 +25,26 @@ func OpenFile(dir, file string, flags int) (*os.File, error) {
 	if dir == "" {
 		return nil, fmt.Errorf("no directory specified for %s", file)
 	}
-	return openFile(dir, file, flags)
+	return openFile(nil, dir, file, flags)
 }
 
 // ReadFile reads data from a cgroup file in dir.
 // It is supposed to be used for cgroup files only.
 func ReadFile(dir, file string) (string, error) {
-	fd, err := OpenFile(dir, file, unix.O_RDONLY)
+	return readFile(nil, dir, file)
+}
+
+// WriteFile writes data to a cgroup file in dir.
+// It is supposed to be used for cgroup files only.
+func WriteFile(dir, file, data string) error {
+	return writeFile(nil, dir, file, data)
+}
+
+func readFile(b Backend, dir, file string) (string, error) {
+	if dir == "" {
+		return "", fmt.Errorf("no directory specified for %s", file)
+	}
+	fd, err := openFile(b, dir, file, unix.O_RDONLY)
 	if err != nil {
 		return "", err
 	}
@@ -42,10 +55,11 @@ func ReadFile(dir, file string) (string, error) {
 	return buf.String(), err
 }
 
-// WriteFile writes data to a cgroup file in dir.
-// It is supposed to be used for cgroup files only.
-func WriteFile(dir, file, data string) error {
-	fd, err := OpenFile(dir, file, unix.O_WRONLY)
+func writeFile(b Backend, dir, file, data string) error {
+	if dir == "" {
+		return fmt.Errorf("no directory specified for %s", file)
+	}
+	fd, err := openFile(b, dir, file, unix.O_WRONLY)
 	if err != nil {
 		return err
 	}
@@ -117,14 +131,22 @@ func prepareOpenat2() error {
 	return prepErr
 }
 
-func openFile(dir, file string, flags int) (*os.File, error) {
+// openFile opens a cgroup file using the backend b,
+// or the default way if b is nil.
+func openFile(b Backend, dir, file string, flags int) (*os.File, error) {
+	path := path.Join(dir, utils.CleanPath(file))
+	if b != nil {
+		return b.OpenFile(path, flags)
+	}
 	mode := os.FileMode(0)
-	if TestMode && flags&os.O_WRONLY != 0 {
+	if TestMode && flags&(os.O_WRONLY|os.O_RDWR) != 0 {
 		// "emulate" cgroup fs for unit tests
-		flags |= os.O_TRUNC | os.O_CREATE
+		flags |= os.O_CREATE
+		if flags&os.O_RDWR == 0 {
+			flags |= os.O_TRUNC
+		}
 		mode = 0o600
 	}
-	path := path.Join(dir, utils.CleanPath(file))
 	if prepareOpenat2() != nil {
 		return openFallback(path, flags, mode)
 	}
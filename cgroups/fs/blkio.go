@@ -2,6 +2,7 @@ package fs
 
 import (
 	"bufio"
+	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
@@ -20,59 +21,159 @@ func (s *BlkioGroup) Name() string {
 	return "blkio"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *BlkioGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
+func (s *BlkioGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
 func (s *BlkioGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *BlkioGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	s.detectWeightFilenames(path)
 	if r.BlkioWeight != 0 {
-		if err := cgroups.WriteFile(path, s.weightFilename, strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
+		if err := w.WriteFile(path, s.weightFilename, strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
 			return err
 		}
 	}
 
 	if r.BlkioLeafWeight != 0 {
-		if err := cgroups.WriteFile(path, "blkio.leaf_weight", strconv.FormatUint(uint64(r.BlkioLeafWeight), 10)); err != nil {
+		if err := w.WriteFile(path, "blkio.leaf_weight", strconv.FormatUint(uint64(r.BlkioLeafWeight), 10)); err != nil {
 			return err
 		}
 	}
 	for _, wd := range r.BlkioWeightDevice {
 		if wd.Weight != 0 {
-			if err := cgroups.WriteFile(path, s.weightDeviceFilename, wd.WeightString()); err != nil {
+			if err := w.WriteFile(path, s.weightDeviceFilename, wd.WeightString()); err != nil {
 				return err
 			}
 		}
 		if wd.LeafWeight != 0 {
-			if err := cgroups.WriteFile(path, "blkio.leaf_weight_device", wd.LeafWeightString()); err != nil {
+			if err := w.WriteFile(path, "blkio.leaf_weight_device", wd.LeafWeightString()); err != nil {
 				return err
 			}
 		}
 	}
 	for _, td := range r.BlkioThrottleReadBpsDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.read_bps_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.read_bps_device", td.String()); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteBpsDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.write_bps_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.write_bps_device", td.String()); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleReadIOPSDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.read_iops_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.read_iops_device", td.String()); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteIOPSDevice {
-		if err := cgroups.WriteFile(path, "blkio.throttle.write_iops_device", td.String()); err != nil {
+		if err := w.WriteFile(path, "blkio.throttle.write_iops_device", td.String()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Snapshot records the files to be modified by Set.
+func (s *BlkioGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if r.BlkioWeight != 0 {
+		if err := snap.Save(path, "blkio.weight", "blkio.bfq.weight"); err != nil {
+			return err
+		}
+	}
+	if r.BlkioLeafWeight != 0 {
+		if err := snap.Save(path, "blkio.leaf_weight"); err != nil {
+			return err
+		}
+	}
+	if len(r.BlkioWeightDevice) > 0 {
+		if err := snap.Save(path, "blkio.weight_device", "blkio.bfq.weight_device", "blkio.leaf_weight_device"); err != nil {
+			return err
+		}
+	}
+	for _, t := range []struct {
+		file string
+		devs []*configs.ThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", r.BlkioThrottleReadBpsDevice},
+		{"blkio.throttle.write_bps_device", r.BlkioThrottleWriteBpsDevice},
+		{"blkio.throttle.read_iops_device", r.BlkioThrottleReadIOPSDevice},
+		{"blkio.throttle.write_iops_device", r.BlkioThrottleWriteIOPSDevice},
+	} {
+		if len(t.devs) == 0 {
+			continue
+		}
+		keys := make([]string, 0, len(t.devs))
+		for _, td := range t.devs {
+			keys = append(keys, fmt.Sprintf("%d:%d", td.Major, td.Minor))
+		}
+		// A zero rate removes the limit.
+		if err := snap.SaveKeyed(path, t.file, keys, "0"); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
+// Deprecated: use GetResourcesFrom instead.
+func (s *BlkioGroup) GetResources(path string, r *configs.Resources) error {
+	return s.GetResourcesFrom(nil, path, r)
+}
+
+// GetResourcesFrom reads back the throttling limits set by SetTo.
+func (s *BlkioGroup) GetResourcesFrom(h *cgroups.Host, path string, r *configs.Resources) error {
+	for _, t := range []struct {
+		file string
+		devs *[]*configs.ThrottleDevice
+	}{
+		{"blkio.throttle.read_bps_device", &r.BlkioThrottleReadBpsDevice},
+		{"blkio.throttle.write_bps_device", &r.BlkioThrottleWriteBpsDevice},
+		{"blkio.throttle.read_iops_device", &r.BlkioThrottleReadIOPSDevice},
+		{"blkio.throttle.write_iops_device", &r.BlkioThrottleWriteIOPSDevice},
+	} {
+		devs, err := getThrottleDevices(h, path, t.file)
+		if err != nil {
+			return err
+		}
+		*t.devs = devs
+	}
 	return nil
 }
 
+// getThrottleDevices parses a blkio.throttle.*_device file,
+// which has a "MAJ:MIN RATE" line per device.
+func getThrottleDevices(h *cgroups.Host, path, file string) ([]*configs.ThrottleDevice, error) {
+	data, err := h.ReadFile(path, file)
+	if err != nil {
+		return nil, err
+	}
+	var devs []*configs.ThrottleDevice
+	for _, line := range strings.Split(data, "\n") {
+		if line == "" {
+			continue
+		}
+		var (
+			major, minor int64
+			rate         uint64
+		)
+		if _, err := fmt.Sscanf(line, "%d:%d %d", &major, &minor, &rate); err != nil {
+			return nil, &parseError{Path: path, File: file, Err: err}
+		}
+		devs = append(devs, configs.NewThrottleDevice(major, minor, rate))
+	}
+	return devs, nil
+}
+
 /*
 examples:
 
@@ -108,9 +209,9 @@ func splitBlkioStatLine(r rune) bool {
 	return r == ' ' || r == ':'
 }
 
-func getBlkioStat(dir, file string) ([]cgroups.BlkioStatEntry, error) {
+func getBlkioStat(h *cgroups.Host, dir, file string) ([]cgroups.BlkioStatEntry, error) {
 	var blkioStats []cgroups.BlkioStatEntry
-	f, err := cgroups.OpenFile(dir, file, os.O_RDONLY)
+	f, err := h.OpenFile(dir, file, os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return blkioStats, nil
@@ -163,7 +264,12 @@ func getBlkioStat(dir, file string) ([]cgroups.BlkioStatEntry, error) {
 	return blkioStats, nil
 }
 
+// Deprecated: use GetStatsFrom instead.
 func (s *BlkioGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *BlkioGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
 	type blkioStatInfo struct {
 		filename            string
 		blkioStatEntriesPtr *[]cgroups.BlkioStatEntry
@@ -279,7 +385,7 @@ func (s *BlkioGroup) GetStats(path string, stats *cgroups.Stats) error {
 
 	for _, statGroup := range orderedStats {
 		for i, statInfo := range statGroup {
-			if blkioStats, err = getBlkioStat(path, statInfo.filename); err != nil || blkioStats == nil {
+			if blkioStats, err = getBlkioStat(h, path, statInfo.filename); err != nil || blkioStats == nil {
 				// if error occurs on first file, move to next group
 				if i == 0 {
 					break
@@ -2,6 +2,7 @@ package fs
 
 import (
 	"fmt"
+	"reflect"
 	"strconv"
 	"testing"
 
@@ -862,3 +863,33 @@ func TestBlkioSetThrottleWriteIOpsDevice(t *testing.T) {
 		t.Fatal("Got the wrong value, set blkio.throttle.write_iops_device failed.")
 	}
 }
+
+func TestBlkioGetResources(t *testing.T) {
+	path := tempDir(t, "blkio")
+
+	writeFileContents(t, path, map[string]string{
+		"blkio.throttle.read_bps_device":   "8:0 1024\n8:16 2048\n",
+		"blkio.throttle.write_bps_device":  "",
+		"blkio.throttle.read_iops_device":  "",
+		"blkio.throttle.write_iops_device": "8:0 100\n",
+	})
+
+	r := &configs.Resources{}
+	blkio := &BlkioGroup{}
+	if err := blkio.GetResources(path, r); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &configs.Resources{
+		BlkioThrottleReadBpsDevice: []*configs.ThrottleDevice{
+			configs.NewThrottleDevice(8, 0, 1024),
+			configs.NewThrottleDevice(8, 16, 2048),
+		},
+		BlkioThrottleWriteIOPSDevice: []*configs.ThrottleDevice{
+			configs.NewThrottleDevice(8, 0, 100),
+		},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Fatalf("expected %+v, got %+v", expected, r)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/dims/libcontainer/cgroups"
 	"github.com/dims/libcontainer/cgroups/fscommon"
@@ -19,26 +20,35 @@ func (s *CpuGroup) Name() string {
 	return "cpu"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *CpuGroup) Apply(path string, r *configs.Resources, pid int) error {
-	if err := os.MkdirAll(path, 0o755); err != nil {
+	return s.ApplyTo(cgroups.Cgroupfs, path, r, pid)
+}
+
+func (s *CpuGroup) ApplyTo(w cgroups.FileWriter, path string, r *configs.Resources, pid int) error {
+	if err := cgroups.MkdirAll(w, path); err != nil {
 		return err
 	}
 	// We should set the real-Time group scheduling settings before moving
 	// in the process because if the process is already in SCHED_RR mode
 	// and no RT bandwidth is set, adding it will fail.
-	if err := s.SetRtSched(path, r); err != nil {
+	if err := setRtSched(w, path, r); err != nil {
 		return err
 	}
 	// Since we are not using apply(), we need to place the pid
 	// into the procs file.
-	return cgroups.WriteCgroupProc(path, pid)
+	return cgroups.WriteCgroupProcTo(w, path, pid)
 }
 
 func (s *CpuGroup) SetRtSched(path string, r *configs.Resources) error {
+	return setRtSched(cgroups.Cgroupfs, path, r)
+}
+
+func setRtSched(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	var period string
 	if r.CpuRtPeriod != 0 {
 		period = strconv.FormatUint(r.CpuRtPeriod, 10)
-		if err := cgroups.WriteFile(path, "cpu.rt_period_us", period); err != nil {
+		if err := w.WriteFile(path, "cpu.rt_period_us", period); err != nil {
 			// The values of cpu.rt_period_us and cpu.rt_runtime_us
 			// are inter-dependent and need to be set in a proper order.
 			// If the kernel rejects the new period value with EINVAL
@@ -52,11 +62,11 @@ func (s *CpuGroup) SetRtSched(path string, r *configs.Resources) error {
 		}
 	}
 	if r.CpuRtRuntime != 0 {
-		if err := cgroups.WriteFile(path, "cpu.rt_runtime_us", strconv.FormatInt(r.CpuRtRuntime, 10)); err != nil {
+		if err := w.WriteFile(path, "cpu.rt_runtime_us", strconv.FormatInt(r.CpuRtRuntime, 10)); err != nil {
 			return err
 		}
 		if period != "" {
-			if err := cgroups.WriteFile(path, "cpu.rt_period_us", period); err != nil {
+			if err := w.WriteFile(path, "cpu.rt_period_us", period); err != nil {
 				return err
 			}
 		}
@@ -64,17 +74,34 @@ func (s *CpuGroup) SetRtSched(path string, r *configs.Resources) error {
 	return nil
 }
 
+// Deprecated: use SetTo instead.
 func (s *CpuGroup) Set(path string, r *configs.Resources) error {
-	if r.CpuShares != 0 {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *CpuGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
+	// cpu.idle (since kernel 5.15)
+	if r.CpuIdle != nil {
+		if err := w.WriteFile(path, "cpu.idle", strconv.FormatInt(*r.CpuIdle, 10)); err != nil {
+			return err
+		}
+	}
+
+	// The shares of an idle cgroup can not be set.
+	if r.CpuShares != 0 && (r.CpuIdle == nil || *r.CpuIdle == 0) {
 		shares := r.CpuShares
-		if err := cgroups.WriteFile(path, "cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
+		if err := w.WriteFile(path, "cpu.shares", strconv.FormatUint(shares, 10)); err != nil {
 			return err
 		}
 		// read it back
-		sharesRead, err := fscommon.GetCgroupParamUint(path, "cpu.shares")
+		data, err := w.ReadFile(path, "cpu.shares")
 		if err != nil {
 			return err
 		}
+		sharesRead, err := fscommon.ParseUint(strings.TrimSpace(data), 10, 64)
+		if err != nil {
+			return &fscommon.ParseError{Path: path, File: "cpu.shares", Err: err}
+		}
 		// ... and check
 		if shares > sharesRead {
 			return fmt.Errorf("the maximum allowed cpu-shares is %d", sharesRead)
@@ -86,7 +113,7 @@ func (s *CpuGroup) Set(path string, r *configs.Resources) error {
 	var period string
 	if r.CpuPeriod != 0 {
 		period = strconv.FormatUint(r.CpuPeriod, 10)
-		if err := cgroups.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
+		if err := w.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
 			// Sometimes when the period to be set is smaller
 			// than the current one, it is rejected by the kernel
 			// (EINVAL) as old_quota/new_period exceeds the parent
@@ -100,22 +127,105 @@ func (s *CpuGroup) Set(path string, r *configs.Resources) error {
 			period = ""
 		}
 	}
+	// cpu.cfs_burst_us (since kernel 5.14)
+	var burst string
+	if r.CpuBurst != nil {
+		burst = strconv.FormatUint(*r.CpuBurst, 10)
+		if err := w.WriteFile(path, "cpu.cfs_burst_us", burst); err != nil {
+			// The kernel rejects (EINVAL) a burst larger than the
+			// current quota. If the quota is going to be set, ignore
+			// the error for now and retry after setting the quota.
+			if !errors.Is(err, unix.EINVAL) || r.CpuQuota == 0 {
+				return err
+			}
+		} else {
+			burst = ""
+		}
+	}
 	if r.CpuQuota != 0 {
-		if err := cgroups.WriteFile(path, "cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10)); err != nil {
+		if err := w.WriteFile(path, "cpu.cfs_quota_us", strconv.FormatInt(r.CpuQuota, 10)); err != nil {
 			return err
 		}
 		if period != "" {
-			if err := cgroups.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
+			if err := w.WriteFile(path, "cpu.cfs_period_us", period); err != nil {
+				return err
+			}
+		}
+		if burst != "" {
+			if err := w.WriteFile(path, "cpu.cfs_burst_us", burst); err != nil {
 				return err
 			}
 		}
 	}
-	return s.SetRtSched(path, r)
+	return setRtSched(w, path, r)
 }
 
+// Snapshot records the files to be modified by Set.
+func (s *CpuGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"cpu.idle", r.CpuIdle != nil},
+		{"cpu.shares", r.CpuShares != 0},
+		{"cpu.cfs_period_us", r.CpuPeriod != 0},
+		{"cpu.cfs_burst_us", r.CpuBurst != nil},
+		{"cpu.cfs_quota_us", r.CpuQuota != 0},
+		{"cpu.rt_period_us", r.CpuRtPeriod != 0},
+		{"cpu.rt_runtime_us", r.CpuRtRuntime != 0},
+	} {
+		if !f.set {
+			continue
+		}
+		if err := snap.Save(path, f.name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deprecated: use GetResourcesFrom instead.
+func (s *CpuGroup) GetResources(path string, r *configs.Resources) error {
+	return s.GetResourcesFrom(nil, path, r)
+}
+
+// GetResourcesFrom reads back the CPU limits set by SetTo.
+func (s *CpuGroup) GetResourcesFrom(h *cgroups.Host, path string, r *configs.Resources) error {
+	var err error
+	if r.CpuShares, err = fscommon.GetCgroupParamUintFrom(h, path, "cpu.shares"); err != nil {
+		return err
+	}
+	// The CFS files are absent if the kernel is built without
+	// CONFIG_CFS_BANDWIDTH.
+	if r.CpuQuota, err = fscommon.GetCgroupParamIntFrom(h, path, "cpu.cfs_quota_us"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if r.CpuPeriod, err = fscommon.GetCgroupParamUintFrom(h, path, "cpu.cfs_period_us"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// cpu.cfs_burst_us (since kernel 5.14)
+	if burst, err := fscommon.GetCgroupParamUintFrom(h, path, "cpu.cfs_burst_us"); err == nil {
+		r.CpuBurst = &burst
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	// cpu.idle (since kernel 5.15)
+	if idle, err := fscommon.GetCgroupParamIntFrom(h, path, "cpu.idle"); err == nil {
+		r.CpuIdle = &idle
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *CpuGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *CpuGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
 	const file = "cpu.stat"
-	f, err := cgroups.OpenFile(path, file, os.O_RDONLY)
+	f, err := h.OpenFile(path, file, os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -139,6 +249,12 @@ func (s *CpuGroup) GetStats(path string, stats *cgroups.Stats) error {
 
 		case "throttled_time":
 			stats.CpuStats.ThrottlingData.ThrottledTime = v
+
+		case "nr_bursts":
+			stats.CpuStats.ThrottlingData.BurstsPeriods = v
+
+		case "burst_time":
+			stats.CpuStats.ThrottlingData.BurstTime = v
 		}
 	}
 	return nil
@@ -104,6 +104,48 @@ func TestCpuSetBandWidth(t *testing.T) {
 	}
 }
 
+func TestCpuSetIdleAndBurst(t *testing.T) {
+	path := tempDir(t, "cpu")
+
+	const (
+		sharesBefore = 1024
+		burstAfter   = 2000
+	)
+
+	writeFileContents(t, path, map[string]string{
+		"cpu.shares":       strconv.Itoa(sharesBefore),
+		"cpu.idle":         "0",
+		"cpu.cfs_burst_us": "0",
+	})
+
+	idle := int64(1)
+	burst := uint64(burstAfter)
+	r := &configs.Resources{
+		// Shares are not set for an idle cgroup.
+		CpuShares: 512,
+		CpuIdle:   &idle,
+		CpuBurst:  &burst,
+	}
+	cpu := &CpuGroup{}
+	if err := cpu.Set(path, r); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]uint64{
+		"cpu.idle":         1,
+		"cpu.cfs_burst_us": burstAfter,
+		"cpu.shares":       sharesBefore,
+	} {
+		value, err := fscommon.GetCgroupParamUint(path, file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Fatalf("Got the wrong value %d, set %s failed.", value, file)
+		}
+	}
+}
+
 func TestCpuStats(t *testing.T) {
 	path := tempDir(t, "cpu")
 
@@ -111,10 +153,12 @@ func TestCpuStats(t *testing.T) {
 		nrPeriods     = 2000
 		nrThrottled   = 200
 		throttledTime = uint64(18446744073709551615)
+		nrBursts      = 20
+		burstTime     = 123456
 	)
 
-	cpuStatContent := fmt.Sprintf("nr_periods %d\nnr_throttled %d\nthrottled_time %d\n",
-		nrPeriods, nrThrottled, throttledTime)
+	cpuStatContent := fmt.Sprintf("nr_periods %d\nnr_throttled %d\nthrottled_time %d\nnr_bursts %d\nburst_time %d\n",
+		nrPeriods, nrThrottled, throttledTime, nrBursts, burstTime)
 	writeFileContents(t, path, map[string]string{
 		"cpu.stat": cpuStatContent,
 	})
@@ -130,6 +174,8 @@ func TestCpuStats(t *testing.T) {
 		Periods:          nrPeriods,
 		ThrottledPeriods: nrThrottled,
 		ThrottledTime:    throttledTime,
+		BurstsPeriods:    nrBursts,
+		BurstTime:        burstTime,
 	}
 
 	expectThrottlingDataEquals(t, expectedStats, actualStats.CpuStats.ThrottlingData)
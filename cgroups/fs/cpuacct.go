@@ -34,34 +34,49 @@ func (s *CpuacctGroup) Name() string {
 	return "cpuacct"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *CpuacctGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
-func (s *CpuacctGroup) Set(_ string, _ *configs.Resources) error {
+func (s *CpuacctGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
+func (s *CpuacctGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *CpuacctGroup) SetTo(_ cgroups.FileWriter, _ string, _ *configs.Resources) error {
 	return nil
 }
 
+// Deprecated: use GetStatsFrom instead.
 func (s *CpuacctGroup) GetStats(path string, stats *cgroups.Stats) error {
-	if !cgroups.PathExists(path) {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *CpuacctGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
+	if !h.PathExists(path) {
 		return nil
 	}
-	userModeUsage, kernelModeUsage, err := getCpuUsageBreakdown(path)
+	userModeUsage, kernelModeUsage, err := getCpuUsageBreakdown(h, path)
 	if err != nil {
 		return err
 	}
 
-	totalUsage, err := fscommon.GetCgroupParamUint(path, "cpuacct.usage")
+	totalUsage, err := fscommon.GetCgroupParamUintFrom(h, path, "cpuacct.usage")
 	if err != nil {
 		return err
 	}
 
-	percpuUsage, err := getPercpuUsage(path)
+	percpuUsage, err := getPercpuUsage(h, path)
 	if err != nil {
 		return err
 	}
 
-	percpuUsageInKernelmode, percpuUsageInUsermode, err := getPercpuUsageInModes(path)
+	percpuUsageInKernelmode, percpuUsageInUsermode, err := getPercpuUsageInModes(h, path)
 	if err != nil {
 		return err
 	}
@@ -76,7 +91,7 @@ func (s *CpuacctGroup) GetStats(path string, stats *cgroups.Stats) error {
 }
 
 // Returns user and kernel usage breakdown in nanoseconds.
-func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
+func getCpuUsageBreakdown(h *cgroups.Host, path string) (uint64, uint64, error) {
 	var userModeUsage, kernelModeUsage uint64
 	const (
 		userField   = "user"
@@ -87,7 +102,7 @@ func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
 	// Expected format:
 	// user <usage in ticks>
 	// system <usage in ticks>
-	data, err := cgroups.ReadFile(path, file)
+	data, err := h.ReadFile(path, file)
 	if err != nil {
 		return 0, 0, err
 	}
@@ -106,10 +121,10 @@ func getCpuUsageBreakdown(path string) (uint64, uint64, error) {
 	return (userModeUsage * nanosecondsInSecond) / clockTicks, (kernelModeUsage * nanosecondsInSecond) / clockTicks, nil
 }
 
-func getPercpuUsage(path string) ([]uint64, error) {
+func getPercpuUsage(h *cgroups.Host, path string) ([]uint64, error) {
 	const file = "cpuacct.usage_percpu"
 	percpuUsage := []uint64{}
-	data, err := cgroups.ReadFile(path, file)
+	data, err := h.ReadFile(path, file)
 	if err != nil {
 		return percpuUsage, err
 	}
@@ -124,12 +139,12 @@ func getPercpuUsage(path string) ([]uint64, error) {
 	return percpuUsage, nil
 }
 
-func getPercpuUsageInModes(path string) ([]uint64, []uint64, error) {
+func getPercpuUsageInModes(h *cgroups.Host, path string) ([]uint64, []uint64, error) {
 	usageKernelMode := []uint64{}
 	usageUserMode := []uint64{}
 	const file = cgroupCpuacctUsageAll
 
-	fd, err := cgroups.OpenFile(path, file, os.O_RDONLY)
+	fd, err := h.OpenFile(path, file, os.O_RDONLY)
 	if os.IsNotExist(err) {
 		return usageKernelMode, usageUserMode, nil
 	} else if err != nil {
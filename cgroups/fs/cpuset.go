@@ -4,8 +4,6 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
-	"strconv"
-	"strings"
 
 	"golang.org/x/sys/unix"
 
@@ -20,120 +18,121 @@ func (s *CpusetGroup) Name() string {
 	return "cpuset"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *CpusetGroup) Apply(path string, r *configs.Resources, pid int) error {
-	return s.ApplyDir(path, r, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, r, pid)
 }
 
+func (s *CpusetGroup) ApplyTo(w cgroups.FileWriter, path string, r *configs.Resources, pid int) error {
+	return s.ApplyDirTo(w, path, r, pid)
+}
+
+// Deprecated: use SetTo instead.
 func (s *CpusetGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *CpusetGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	if r.CpusetCpus != "" {
-		if err := cgroups.WriteFile(path, "cpuset.cpus", r.CpusetCpus); err != nil {
+		if err := w.WriteFile(path, "cpuset.cpus", r.CpusetCpus); err != nil {
 			return err
 		}
 	}
 	if r.CpusetMems != "" {
-		if err := cgroups.WriteFile(path, "cpuset.mems", r.CpusetMems); err != nil {
+		if err := w.WriteFile(path, "cpuset.mems", r.CpusetMems); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func getCpusetStat(path string, file string) ([]uint16, error) {
-	var extracted []uint16
-	fileContent, err := fscommon.GetCgroupParamString(path, file)
-	if err != nil {
-		return extracted, err
-	}
-	if len(fileContent) == 0 {
-		return extracted, &parseError{Path: path, File: file, Err: errors.New("empty file")}
-	}
-
-	for _, s := range strings.Split(fileContent, ",") {
-		sp := strings.SplitN(s, "-", 3)
-		switch len(sp) {
-		case 3:
-			return extracted, &parseError{Path: path, File: file, Err: errors.New("extra dash")}
-		case 2:
-			min, err := strconv.ParseUint(sp[0], 10, 16)
-			if err != nil {
-				return extracted, &parseError{Path: path, File: file, Err: err}
-			}
-			max, err := strconv.ParseUint(sp[1], 10, 16)
-			if err != nil {
-				return extracted, &parseError{Path: path, File: file, Err: err}
-			}
-			if min > max {
-				return extracted, &parseError{Path: path, File: file, Err: errors.New("invalid values, min > max")}
-			}
-			for i := min; i <= max; i++ {
-				extracted = append(extracted, uint16(i))
-			}
-		case 1:
-			value, err := strconv.ParseUint(s, 10, 16)
-			if err != nil {
-				return extracted, &parseError{Path: path, File: file, Err: err}
-			}
-			extracted = append(extracted, uint16(value))
+// Snapshot records the files to be modified by Set.
+func (s *CpusetGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if r.CpusetCpus != "" {
+		if err := snap.Save(path, "cpuset.cpus"); err != nil {
+			return err
 		}
 	}
+	if r.CpusetMems != "" {
+		return snap.Save(path, "cpuset.mems")
+	}
+	return nil
+}
+
+// Deprecated: use GetResourcesFrom instead.
+func (s *CpusetGroup) GetResources(path string, r *configs.Resources) error {
+	return s.GetResourcesFrom(nil, path, r)
+}
 
-	return extracted, nil
+// GetResourcesFrom reads back the cpuset.cpus and cpuset.mems set by SetTo.
+func (s *CpusetGroup) GetResourcesFrom(h *cgroups.Host, path string, r *configs.Resources) error {
+	var err error
+	if r.CpusetCpus, err = fscommon.GetCgroupParamStringFrom(h, path, "cpuset.cpus"); err != nil {
+		return err
+	}
+	r.CpusetMems, err = fscommon.GetCgroupParamStringFrom(h, path, "cpuset.mems")
+	return err
 }
 
+// Deprecated: use GetStatsFrom instead.
 func (s *CpusetGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *CpusetGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
 	var err error
 
-	stats.CPUSetStats.CPUs, err = getCpusetStat(path, "cpuset.cpus")
+	stats.CPUSetStats.CPUs, err = fscommon.GetCgroupParamListFrom(h, path, "cpuset.cpus")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.CPUExclusive, err = fscommon.GetCgroupParamUint(path, "cpuset.cpu_exclusive")
+	stats.CPUSetStats.CPUExclusive, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.cpu_exclusive")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.Mems, err = getCpusetStat(path, "cpuset.mems")
+	stats.CPUSetStats.Mems, err = fscommon.GetCgroupParamListFrom(h, path, "cpuset.mems")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemHardwall, err = fscommon.GetCgroupParamUint(path, "cpuset.mem_hardwall")
+	stats.CPUSetStats.MemHardwall, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.mem_hardwall")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemExclusive, err = fscommon.GetCgroupParamUint(path, "cpuset.mem_exclusive")
+	stats.CPUSetStats.MemExclusive, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.mem_exclusive")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemoryMigrate, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_migrate")
+	stats.CPUSetStats.MemoryMigrate, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.memory_migrate")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemorySpreadPage, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_spread_page")
+	stats.CPUSetStats.MemorySpreadPage, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.memory_spread_page")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemorySpreadSlab, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_spread_slab")
+	stats.CPUSetStats.MemorySpreadSlab, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.memory_spread_slab")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.MemoryPressure, err = fscommon.GetCgroupParamUint(path, "cpuset.memory_pressure")
+	stats.CPUSetStats.MemoryPressure, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.memory_pressure")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.SchedLoadBalance, err = fscommon.GetCgroupParamUint(path, "cpuset.sched_load_balance")
+	stats.CPUSetStats.SchedLoadBalance, err = fscommon.GetCgroupParamUintFrom(h, path, "cpuset.sched_load_balance")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
 
-	stats.CPUSetStats.SchedRelaxDomainLevel, err = fscommon.GetCgroupParamInt(path, "cpuset.sched_relax_domain_level")
+	stats.CPUSetStats.SchedRelaxDomainLevel, err = fscommon.GetCgroupParamIntFrom(h, path, "cpuset.sched_relax_domain_level")
 	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
 	}
@@ -142,6 +141,10 @@ func (s *CpusetGroup) GetStats(path string, stats *cgroups.Stats) error {
 }
 
 func (s *CpusetGroup) ApplyDir(dir string, r *configs.Resources, pid int) error {
+	return s.ApplyDirTo(cgroups.Cgroupfs, dir, r, pid)
+}
+
+func (s *CpusetGroup) ApplyDirTo(w cgroups.FileWriter, dir string, r *configs.Resources, pid int) error {
 	// This might happen if we have no cpuset cgroup mounted.
 	// Just do nothing and don't fail.
 	if dir == "" {
@@ -150,10 +153,10 @@ func (s *CpusetGroup) ApplyDir(dir string, r *configs.Resources, pid int) error
 	// 'ensureParent' start with parent because we don't want to
 	// explicitly inherit from parent, it could conflict with
 	// 'cpuset.cpu_exclusive'.
-	if err := cpusetEnsureParent(filepath.Dir(dir)); err != nil {
+	if err := cpusetEnsureParent(w, filepath.Dir(dir)); err != nil {
 		return err
 	}
-	if err := os.Mkdir(dir, 0o755); err != nil && !os.IsExist(err) {
+	if err := w.Mkdir(dir); err != nil && !os.IsExist(err) {
 		return err
 	}
 	// We didn't inherit cpuset configs from parent, but we have
@@ -163,19 +166,19 @@ func (s *CpusetGroup) ApplyDir(dir string, r *configs.Resources, pid int) error
 	// specified configs, otherwise, inherit from parent. This makes
 	// cpuset configs work correctly with 'cpuset.cpu_exclusive', and
 	// keep backward compatibility.
-	if err := s.ensureCpusAndMems(dir, r); err != nil {
+	if err := s.ensureCpusAndMems(w, dir, r); err != nil {
 		return err
 	}
 	// Since we are not using apply(), we need to place the pid
 	// into the procs file.
-	return cgroups.WriteCgroupProc(dir, pid)
+	return cgroups.WriteCgroupProcTo(w, dir, pid)
 }
 
-func getCpusetSubsystemSettings(parent string) (cpus, mems string, err error) {
-	if cpus, err = cgroups.ReadFile(parent, "cpuset.cpus"); err != nil {
+func getCpusetSubsystemSettings(w cgroups.FileWriter, parent string) (cpus, mems string, err error) {
+	if cpus, err = w.ReadFile(parent, "cpuset.cpus"); err != nil {
 		return
 	}
-	if mems, err = cgroups.ReadFile(parent, "cpuset.mems"); err != nil {
+	if mems, err = w.ReadFile(parent, "cpuset.mems"); err != nil {
 		return
 	}
 	return cpus, mems, nil
@@ -185,7 +188,7 @@ func getCpusetSubsystemSettings(parent string) (cpus, mems string, err error) {
 // are created and populated with the proper cpus and mems files copied
 // from their respective parent. It does that recursively, starting from
 // the top of the cpuset hierarchy (i.e. cpuset cgroup mount point).
-func cpusetEnsureParent(current string) error {
+func cpusetEnsureParent(w cgroups.FileWriter, current string) error {
 	var st unix.Statfs_t
 
 	parent := filepath.Dir(current)
@@ -199,34 +202,34 @@ func cpusetEnsureParent(current string) error {
 		return &os.PathError{Op: "statfs", Path: parent, Err: err}
 	}
 
-	if err := cpusetEnsureParent(parent); err != nil {
+	if err := cpusetEnsureParent(w, parent); err != nil {
 		return err
 	}
-	if err := os.Mkdir(current, 0o755); err != nil && !os.IsExist(err) {
+	if err := w.Mkdir(current); err != nil && !os.IsExist(err) {
 		return err
 	}
-	return cpusetCopyIfNeeded(current, parent)
+	return cpusetCopyIfNeeded(w, current, parent)
 }
 
 // cpusetCopyIfNeeded copies the cpuset.cpus and cpuset.mems from the parent
 // directory to the current directory if the file's contents are 0
-func cpusetCopyIfNeeded(current, parent string) error {
-	currentCpus, currentMems, err := getCpusetSubsystemSettings(current)
+func cpusetCopyIfNeeded(w cgroups.FileWriter, current, parent string) error {
+	currentCpus, currentMems, err := getCpusetSubsystemSettings(w, current)
 	if err != nil {
 		return err
 	}
-	parentCpus, parentMems, err := getCpusetSubsystemSettings(parent)
+	parentCpus, parentMems, err := getCpusetSubsystemSettings(w, parent)
 	if err != nil {
 		return err
 	}
 
 	if isEmptyCpuset(currentCpus) {
-		if err := cgroups.WriteFile(current, "cpuset.cpus", parentCpus); err != nil {
+		if err := w.WriteFile(current, "cpuset.cpus", parentCpus); err != nil {
 			return err
 		}
 	}
 	if isEmptyCpuset(currentMems) {
-		if err := cgroups.WriteFile(current, "cpuset.mems", parentMems); err != nil {
+		if err := w.WriteFile(current, "cpuset.mems", parentMems); err != nil {
 			return err
 		}
 	}
@@ -237,9 +240,9 @@ func isEmptyCpuset(str string) bool {
 	return str == "" || str == "\n"
 }
 
-func (s *CpusetGroup) ensureCpusAndMems(path string, r *configs.Resources) error {
-	if err := s.Set(path, r); err != nil {
+func (s *CpusetGroup) ensureCpusAndMems(w cgroups.FileWriter, path string, r *configs.Resources) error {
+	if err := s.SetTo(w, path, r); err != nil {
 		return err
 	}
-	return cpusetCopyIfNeeded(path, filepath.Dir(path))
+	return cpusetCopyIfNeeded(w, path, filepath.Dir(path))
 }
@@ -3,6 +3,7 @@ package fs
 import (
 	"bytes"
 	"errors"
+	"os"
 	"reflect"
 
 	"github.com/dims/libcontainer/cgroups"
@@ -20,7 +21,12 @@ func (s *DevicesGroup) Name() string {
 	return "devices"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *DevicesGroup) Apply(path string, r *configs.Resources, pid int) error {
+	return s.ApplyTo(cgroups.Cgroupfs, path, r, pid)
+}
+
+func (s *DevicesGroup) ApplyTo(w cgroups.FileWriter, path string, r *configs.Resources, pid int) error {
 	if r.SkipDevices {
 		return nil
 	}
@@ -30,11 +36,11 @@ func (s *DevicesGroup) Apply(path string, r *configs.Resources, pid int) error {
 		return errSubsystemDoesNotExist
 	}
 
-	return apply(path, pid)
+	return apply(w, path, pid)
 }
 
-func loadEmulator(path string) (*cgroupdevices.Emulator, error) {
-	list, err := cgroups.ReadFile(path, "devices.list")
+func loadEmulator(w cgroups.FileWriter, path string) (*cgroupdevices.Emulator, error) {
+	list, err := w.ReadFile(path, "devices.list")
 	if err != nil {
 		return nil, err
 	}
@@ -52,14 +58,19 @@ func buildEmulator(rules []*devices.Rule) (*cgroupdevices.Emulator, error) {
 	return emu, nil
 }
 
+// Deprecated: use SetTo instead.
 func (s *DevicesGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *DevicesGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	if userns.RunningInUserNS() || r.SkipDevices {
 		return nil
 	}
 
 	// Generate two emulators, one for the current state of the cgroup and one
 	// for the requested state by the user.
-	current, err := loadEmulator(path)
+	current, err := loadEmulator(w, path)
 	if err != nil {
 		return err
 	}
@@ -68,6 +79,34 @@ func (s *DevicesGroup) Set(path string, r *configs.Resources) error {
 		return err
 	}
 
+	if err := transition(w, path, current, target); err != nil {
+		return err
+	}
+
+	// Final safety check -- ensure that the resulting state is what was
+	// requested. This is only really correct for white-lists, but for
+	// black-lists we can at least check that the cgroup is in the right mode.
+	//
+	// This safety-check is skipped for the unit tests because we cannot
+	// currently mock devices.list correctly, and when planning, as the
+	// resulting state is not known without making the changes.
+	if !s.TestingSkipFinalCheck && cgroups.MakesChanges(w) {
+		currentAfter, err := loadEmulator(w, path)
+		if err != nil {
+			return err
+		}
+		if !target.IsBlacklist() && !reflect.DeepEqual(currentAfter, target) {
+			return errors.New("resulting devices cgroup doesn't precisely match target")
+		} else if target.IsBlacklist() != currentAfter.IsBlacklist() {
+			return errors.New("resulting devices cgroup doesn't match target mode")
+		}
+	}
+	return nil
+}
+
+// transition changes the devices cgroup at path from the current state
+// to the target one.
+func transition(w cgroups.FileWriter, path string, current, target *cgroupdevices.Emulator) error {
 	// Compute the minimal set of transition rules needed to achieve the
 	// requested state.
 	transitionRules, err := current.Transition(target)
@@ -79,31 +118,40 @@ func (s *DevicesGroup) Set(path string, r *configs.Resources) error {
 		if rule.Allow {
 			file = "devices.allow"
 		}
-		if err := cgroups.WriteFile(path, file, rule.CgroupString()); err != nil {
+		if err := w.WriteFile(path, file, rule.CgroupString()); err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	// Final safety check -- ensure that the resulting state is what was
-	// requested. This is only really correct for white-lists, but for
-	// black-lists we can at least check that the cgroup is in the right mode.
-	//
-	// This safety-check is skipped for the unit tests because we cannot
-	// currently mock devices.list correctly.
-	if !s.TestingSkipFinalCheck {
-		currentAfter, err := loadEmulator(path)
+// Snapshot records the device rules to be modified by Set.
+func (s *DevicesGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if userns.RunningInUserNS() || r.SkipDevices {
+		return nil
+	}
+	saved, err := loadEmulator(snap.Host, path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	snap.Add(func() error {
+		current, err := loadEmulator(snap.Host, path)
 		if err != nil {
 			return err
 		}
-		if !target.IsBlacklist() && !reflect.DeepEqual(currentAfter, target) {
-			return errors.New("resulting devices cgroup doesn't precisely match target")
-		} else if target.IsBlacklist() != currentAfter.IsBlacklist() {
-			return errors.New("resulting devices cgroup doesn't match target mode")
-		}
-	}
+		return transition(snap.Host, path, current, saved)
+	})
 	return nil
 }
 
+// Deprecated: use GetStatsFrom instead.
 func (s *DevicesGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *DevicesGroup) GetStatsFrom(_ *cgroups.Host, _ string, _ *cgroups.Stats) error {
 	return nil
 }
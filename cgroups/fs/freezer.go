@@ -19,11 +19,21 @@ func (s *FreezerGroup) Name() string {
 	return "freezer"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *FreezerGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
-func (s *FreezerGroup) Set(path string, r *configs.Resources) (Err error) {
+func (s *FreezerGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
+func (s *FreezerGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *FreezerGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) (Err error) {
 	switch r.Freezer {
 	case configs.Frozen:
 		defer func() {
@@ -31,7 +41,7 @@ func (s *FreezerGroup) Set(path string, r *configs.Resources) (Err error) {
 				// Freezing failed, and it is bad and dangerous
 				// to leave the cgroup in FROZEN or FREEZING
 				// state, so (try to) thaw it back.
-				_ = cgroups.WriteFile(path, "freezer.state", string(configs.Thawed))
+				_ = w.WriteFile(path, "freezer.state", string(configs.Thawed))
 			}
 		}()
 
@@ -64,11 +74,11 @@ func (s *FreezerGroup) Set(path string, r *configs.Resources) (Err error) {
 				// the chances to succeed in freezing
 				// in case new processes keep appearing
 				// in the cgroup.
-				_ = cgroups.WriteFile(path, "freezer.state", string(configs.Thawed))
+				_ = w.WriteFile(path, "freezer.state", string(configs.Thawed))
 				time.Sleep(10 * time.Millisecond)
 			}
 
-			if err := cgroups.WriteFile(path, "freezer.state", string(configs.Frozen)); err != nil {
+			if err := w.WriteFile(path, "freezer.state", string(configs.Frozen)); err != nil {
 				return err
 			}
 
@@ -79,7 +89,7 @@ func (s *FreezerGroup) Set(path string, r *configs.Resources) (Err error) {
 				// system.
 				time.Sleep(10 * time.Microsecond)
 			}
-			state, err := cgroups.ReadFile(path, "freezer.state")
+			state, err := w.ReadFile(path, "freezer.state")
 			if err != nil {
 				return err
 			}
@@ -100,7 +110,7 @@ func (s *FreezerGroup) Set(path string, r *configs.Resources) (Err error) {
 		// Despite our best efforts, it got stuck in FREEZING.
 		return errors.New("unable to freeze")
 	case configs.Thawed:
-		return cgroups.WriteFile(path, "freezer.state", string(configs.Thawed))
+		return w.WriteFile(path, "freezer.state", string(configs.Thawed))
 	case configs.Undefined:
 		return nil
 	default:
@@ -108,13 +118,37 @@ func (s *FreezerGroup) Set(path string, r *configs.Resources) (Err error) {
 	}
 }
 
+// Snapshot records the freezer state to be modified by Set.
+func (s *FreezerGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if r.Freezer == configs.Undefined {
+		return nil
+	}
+	state, err := s.getState(snap.Host, path)
+	if err != nil || state == configs.Undefined {
+		return err
+	}
+	snap.Add(func() error {
+		return s.SetTo(snap.Host, path, &configs.Resources{Freezer: state})
+	})
+	return nil
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *FreezerGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *FreezerGroup) GetStatsFrom(_ *cgroups.Host, _ string, _ *cgroups.Stats) error {
 	return nil
 }
 
 func (s *FreezerGroup) GetState(path string) (configs.FreezerState, error) {
+	return s.getState(nil, path)
+}
+
+func (s *FreezerGroup) getState(h *cgroups.Host, path string) (configs.FreezerState, error) {
 	for {
-		state, err := cgroups.ReadFile(path, "freezer.state")
+		state, err := h.ReadFile(path, "freezer.state")
 		if err != nil {
 			// If the kernel is too old, then we just treat the freezer as
 			// being in an "undefined" state.
@@ -129,7 +163,7 @@ func (s *FreezerGroup) GetState(path string) (configs.FreezerState, error) {
 		case "FROZEN":
 			// Find out whether the cgroup is frozen directly,
 			// or indirectly via an ancestor.
-			self, err := cgroups.ReadFile(path, "freezer.self_freezing")
+			self, err := h.ReadFile(path, "freezer.self_freezing")
 			if err != nil {
 				// If the kernel is too old, then we just treat
 				// it as being frozen.
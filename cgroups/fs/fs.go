@@ -1,11 +1,14 @@
 package fs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 
+	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
 
 	"github.com/dims/libcontainer/cgroups"
@@ -29,61 +32,108 @@ var subsystems = []subsystem{
 	&RdmaGroup{},
 	&NameGroup{GroupName: "name=systemd", Join: true},
 	&NameGroup{GroupName: "misc", Join: true},
+	// The cgroup v2 hierarchy, joined in hybrid mode only.
+	&NameGroup{GroupName: "", Join: true},
 }
 
 var errSubsystemDoesNotExist = errors.New("cgroup: subsystem does not exist")
 
-func init() {
-	// If using cgroups-hybrid mode then add a "" controller indicating
-	// it should join the cgroups v2.
-	if cgroups.IsCgroup2HybridMode() {
-		subsystems = append(subsystems, &NameGroup{GroupName: "", Join: true})
-	}
-}
-
 type subsystem interface {
 	// Name returns the name of the subsystem.
 	Name() string
-	// GetStats fills in the stats for the subsystem.
-	GetStats(path string, stats *cgroups.Stats) error
-	// Apply creates and joins a cgroup, adding pid into it. Some
-	// subsystems use resources to pre-configure the cgroup parents
-	// before creating or joining it.
-	Apply(path string, r *configs.Resources, pid int) error
-	// Set sets the cgroup resources.
-	Set(path string, r *configs.Resources) error
+	// GetStatsFrom fills in the stats for the subsystem,
+	// reading the files of the host h.
+	GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error
+	// ApplyTo creates and joins a cgroup, adding pid into it, using w
+	// to make the changes. Some subsystems use resources to pre-configure
+	// the cgroup parents before creating or joining it.
+	ApplyTo(w cgroups.FileWriter, path string, r *configs.Resources, pid int) error
+	// SetTo sets the cgroup resources, using w to write the files.
+	SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error
+}
+
+// resourcesGetter is implemented by subsystems which
+// can read back the resources set by Set.
+type resourcesGetter interface {
+	// GetResourcesFrom fills in the resources for the subsystem,
+	// reading the files of the host h.
+	GetResourcesFrom(h *cgroups.Host, path string, r *configs.Resources) error
+}
+
+// snapshotter is implemented by subsystems which can record
+// the current values of the files to be modified by Set.
+type snapshotter interface {
+	// Snapshot records the files to be modified by setting r.
+	Snapshot(s *cgroups.Snapshot, path string, r *configs.Resources) error
 }
 
 type manager struct {
-	mu      sync.Mutex
+	mu sync.Mutex
+	// host is the cgroup filesystem the hierarchies are on.
+	host    *cgroups.Host
 	cgroups *configs.Cgroup
 	paths   map[string]string
 }
 
 func NewManager(cg *configs.Cgroup, paths map[string]string) (cgroups.Manager, error) {
-	// Some v1 controllers (cpu, cpuset, and devices) expect
-	// cgroups.Resources to not be nil in Apply.
-	if cg.Resources == nil {
-		return nil, errors.New("cgroup v1 manager needs configs.Resources to be set during manager creation")
+	if err := checkConfig(cg); err != nil {
+		return nil, err
 	}
-	if cg.Resources.Unified != nil {
-		return nil, cgroups.ErrV1NoUnified
+
+	h := cgroups.DefaultHost()
+	if paths == nil {
+		var err error
+		paths, err = initPaths(h, cg)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &manager{
+		host:    h,
+		cgroups: cg,
+		paths:   paths,
+	}, nil
+}
+
+// NewHostManager is like NewManager, but for the cgroup v1 hierarchies of
+// the host h (see cgroups.Host). If paths is nil, the cgroup paths are
+// found under h.Root.
+func NewHostManager(h *cgroups.Host, cg *configs.Cgroup, paths map[string]string) (cgroups.Manager, error) {
+	if h.Mode == cgroups.Unified {
+		return nil, fmt.Errorf("cgroup root %s is in unified mode", h.Root)
+	}
+	if err := checkConfig(cg); err != nil {
+		return nil, err
 	}
 
 	if paths == nil {
 		var err error
-		paths, err = initPaths(cg)
+		paths, err = hostPaths(h, cg)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	return &manager{
+		host:    h,
 		cgroups: cg,
 		paths:   paths,
 	}, nil
 }
 
+func checkConfig(cg *configs.Cgroup) error {
+	// Some v1 controllers (cpu, cpuset, and devices) expect
+	// cgroups.Resources to not be nil in Apply.
+	if cg.Resources == nil {
+		return errors.New("cgroup v1 manager needs configs.Resources to be set during manager creation")
+	}
+	if cg.Resources.Unified != nil {
+		return cgroups.ErrV1NoUnified
+	}
+	return nil
+}
+
 // isIgnorableError returns whether err is a permission error (in the loose
 // sense of the word). This includes EROFS (which for an unprivileged user is
 // basically a permission error) and EACCES (for similar reasons) as well as
@@ -108,7 +158,29 @@ func isIgnorableError(rootless bool, err error) bool {
 func (m *manager) Apply(pid int) (err error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	return m.apply(m.host, pid)
+}
+
+func (m *manager) PlanApply(pid int) (*cgroups.Plan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// The paths are trimmed by apply on permission errors,
+	// which must not happen for a plan.
+	saved := m.paths
+	m.paths = make(map[string]string, len(saved))
+	for name, path := range saved {
+		m.paths[name] = path
+	}
+	defer func() { m.paths = saved }()
+
+	p := &cgroups.Plan{Host: m.host}
+	if err := m.apply(p, pid); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
 
+func (m *manager) apply(w cgroups.FileWriter, pid int) error {
 	c := m.cgroups
 
 	for _, sys := range subsystems {
@@ -118,7 +190,7 @@ func (m *manager) Apply(pid int) (err error) {
 			continue
 		}
 
-		if err := sys.Apply(p, c.Resources, pid); err != nil {
+		if err := sys.ApplyTo(w, p, c.Resources, pid); err != nil {
 			// In the case of rootless (including euid=0 in userns), where an
 			// explicit cgroup path hasn't been set, we don't bail on error in
 			// case of permission problems here, but do delete the path from
@@ -142,7 +214,11 @@ func (m *manager) Apply(pid int) (err error) {
 func (m *manager) Destroy() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return cgroups.RemovePaths(m.paths)
+	return m.host.RemovePaths(m.paths)
+}
+
+func (m *manager) Kill(sig unix.Signal) error {
+	return cgroups.FreezeAndKill(m, sig)
 }
 
 func (m *manager) Path(subsys string) string {
@@ -160,14 +236,67 @@ func (m *manager) GetStats() (*cgroups.Stats, error) {
 		if path == "" {
 			continue
 		}
-		if err := sys.GetStats(path, stats); err != nil {
+		if err := sys.GetStatsFrom(m.host, path, stats); err != nil {
 			return nil, err
 		}
 	}
 	return stats, nil
 }
 
-func (m *manager) Set(r *configs.Resources) error {
+func (m *manager) GetStatsTree() (cgroups.StatsTree, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return getStatsTree(m.host, m.paths)
+}
+
+// GetStatsTree returns the statistics of the cgroup identified by the
+// per-subsystem paths, and of all its sub-cgroups. A sub-cgroup only
+// has the statistics of the subsystems it exists in.
+func GetStatsTree(paths map[string]string) (cgroups.StatsTree, error) {
+	return getStatsTree(nil, paths)
+}
+
+func getStatsTree(h *cgroups.Host, paths map[string]string) (cgroups.StatsTree, error) {
+	tree := make(cgroups.StatsTree)
+	for _, sys := range subsystems {
+		path := paths[sys.Name()]
+		if path == "" {
+			continue
+		}
+		subs, err := cgroups.GetSubCgroups(path)
+		if err != nil {
+			// Only the cgroup itself being missing is not an error
+			// here, the sub-cgroups removed are skipped by the walk.
+			if !os.IsNotExist(err) || h.PathExists(path) {
+				return nil, err
+			}
+			// Leave the error handling to the subsystem, as GetStats does.
+			subs = []string{"."}
+		}
+		for _, p := range subs {
+			stats, ok := tree[p]
+			if !ok {
+				stats = cgroups.NewStats()
+				tree[p] = stats
+			}
+			if err := sys.GetStatsFrom(h, filepath.Join(path, p), stats); err != nil {
+				// The sub-cgroup was removed in the meantime.
+				if p != "." && !h.PathExists(filepath.Join(path, p)) {
+					if !ok {
+						delete(tree, p)
+					}
+					continue
+				}
+				return nil, err
+			}
+		}
+	}
+	return tree, nil
+}
+
+// Set applies the resources r to the cgroup. If any of the settings
+// fails, the ones applied before it are rolled back.
+func (m *manager) Set(r *configs.Resources) (retErr error) {
 	if r == nil {
 		return nil
 	}
@@ -175,12 +304,57 @@ func (m *manager) Set(r *configs.Resources) error {
 	if r.Unified != nil {
 		return cgroups.ErrV1NoUnified
 	}
+	if r.MemoryHigh != 0 || r.MemoryMin != 0 || r.MemoryOOMGroup != nil {
+		return cgroups.ErrV1NoMemoryV2
+	}
+	if r.CpusetPartition != "" {
+		return cgroups.ErrV1NoPartition
+	}
 
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	s, err := snapshot(m.host, m.paths, r)
+	if err != nil {
+		return fmt.Errorf("unable to save cgroup state: %w", err)
+	}
+	defer func() {
+		if retErr != nil {
+			if err := s.Restore(); err != nil {
+				logrus.Warnf("unable to roll back cgroup after a failed update: %v", err)
+			}
+		}
+	}()
+	return m.set(m.host, r)
+}
+
+func (m *manager) PlanSet(r *configs.Resources) (*cgroups.Plan, error) {
+	p := &cgroups.Plan{Host: m.host}
+	if r == nil {
+		return p, nil
+	}
+	if r.Unified != nil {
+		return nil, cgroups.ErrV1NoUnified
+	}
+	if r.MemoryHigh != 0 || r.MemoryMin != 0 || r.MemoryOOMGroup != nil {
+		return nil, cgroups.ErrV1NoMemoryV2
+	}
+	if r.CpusetPartition != "" {
+		return nil, cgroups.ErrV1NoPartition
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.set(p, r); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// set applies the resources r to the cgroup using w.
+func (m *manager) set(w cgroups.FileWriter, r *configs.Resources) error {
 	for _, sys := range subsystems {
 		path := m.paths[sys.Name()]
-		if err := sys.Set(path, r); err != nil {
+		if err := sys.SetTo(w, path, r); err != nil {
 			// When rootless is true, errors from the device subsystem
 			// are ignored, as it is really not expected to work.
 			if m.cgroups.Rootless && sys.Name() == "devices" {
@@ -200,6 +374,31 @@ func (m *manager) Set(r *configs.Resources) error {
 	return nil
 }
 
+// Snapshot records the current values of the cgroup v1 files at paths
+// (as returned by GetPaths) which are to be modified by setting the
+// resources r, so that they can be restored if the update fails.
+func Snapshot(paths map[string]string, r *configs.Resources) (*cgroups.Snapshot, error) {
+	return snapshot(nil, paths, r)
+}
+
+func snapshot(h *cgroups.Host, paths map[string]string, r *configs.Resources) (*cgroups.Snapshot, error) {
+	s := &cgroups.Snapshot{Host: h}
+	for _, sys := range subsystems {
+		snap, ok := sys.(snapshotter)
+		if !ok {
+			continue
+		}
+		path := paths[sys.Name()]
+		if path == "" {
+			continue
+		}
+		if err := snap.Snapshot(s, path, r); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
 // Freeze toggles the container's freezer cgroup depending on the state
 // provided
 func (m *manager) Freeze(state configs.FreezerState) error {
@@ -211,7 +410,7 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 	prevState := m.cgroups.Resources.Freezer
 	m.cgroups.Resources.Freezer = state
 	freezer := &FreezerGroup{}
-	if err := freezer.Set(path, m.cgroups.Resources); err != nil {
+	if err := freezer.SetTo(m.host, path, m.cgroups.Resources); err != nil {
 		m.cgroups.Resources.Freezer = prevState
 		return err
 	}
@@ -219,11 +418,59 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 }
 
 func (m *manager) GetPids() ([]int, error) {
-	return cgroups.GetPids(m.Path("devices"))
+	return m.host.GetPids(m.Path("devices"))
 }
 
 func (m *manager) GetAllPids() ([]int, error) {
-	return cgroups.GetAllPids(m.Path("devices"))
+	return m.host.GetAllPids(m.Path("devices"))
+}
+
+func (m *manager) NewChild(name string, r *configs.Resources) (cgroups.Manager, error) {
+	m.mu.Lock()
+	paths := m.paths
+	m.mu.Unlock()
+	return newChild(m.host, paths, name, &configs.Cgroup{Resources: r, Rootless: m.cgroups.Rootless})
+}
+
+// NewChild creates a sub-cgroup called name in each of the cgroup v1
+// hierarchies at paths (as returned by GetPaths), and returns a manager
+// for it, with the resources r set. See cgroups.Manager.NewChild.
+func NewChild(paths map[string]string, name string, r *configs.Resources) (cgroups.Manager, error) {
+	return newChild(cgroups.DefaultHost(), paths, name, &configs.Cgroup{Resources: r})
+}
+
+func newChild(h *cgroups.Host, paths map[string]string, name string, cg *configs.Cgroup) (_ cgroups.Manager, Err error) {
+	if err := cgroups.CheckChildName(name); err != nil {
+		return nil, err
+	}
+	if cg.Resources == nil {
+		cg.Resources = &configs.Resources{SkipDevices: true}
+	} else if len(cg.Resources.Devices) == 0 && !cg.Resources.SkipDevices {
+		r := *cg.Resources
+		r.SkipDevices = true
+		cg.Resources = &r
+	}
+	childPaths := make(map[string]string, len(paths))
+	for subsys, path := range paths {
+		childPaths[subsys] = filepath.Join(path, name)
+	}
+	child, err := NewHostManager(h, cg, childPaths)
+	if err != nil {
+		return nil, err
+	}
+	// Apply can fail after creating some of the directories.
+	defer func() {
+		if Err != nil {
+			_ = child.Destroy()
+		}
+	}()
+	if err := child.Apply(-1); err != nil {
+		return nil, err
+	}
+	if err := child.Set(cg.Resources); err != nil {
+		return nil, err
+	}
+	return child, nil
 }
 
 func (m *manager) GetPaths() map[string]string {
@@ -236,6 +483,36 @@ func (m *manager) GetCgroups() (*configs.Cgroup, error) {
 	return m.cgroups, nil
 }
 
+func (m *manager) GetResources() (*configs.Resources, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return getResources(m.host, m.paths)
+}
+
+// GetResources reads back the resources currently in effect for
+// the cgroup v1 controllers at paths, as returned by GetPaths.
+func GetResources(paths map[string]string) (*configs.Resources, error) {
+	return getResources(nil, paths)
+}
+
+func getResources(h *cgroups.Host, paths map[string]string) (*configs.Resources, error) {
+	r := &configs.Resources{}
+	for _, sys := range subsystems {
+		g, ok := sys.(resourcesGetter)
+		if !ok {
+			continue
+		}
+		path := paths[sys.Name()]
+		if path == "" {
+			continue
+		}
+		if err := g.GetResourcesFrom(h, path, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
 func (m *manager) GetFreezerState() (configs.FreezerState, error) {
 	dir := m.Path("freezer")
 	// If the container doesn't have the freezer cgroup, say it's undefined.
@@ -243,19 +520,23 @@ func (m *manager) GetFreezerState() (configs.FreezerState, error) {
 		return configs.Undefined, nil
 	}
 	freezer := &FreezerGroup{}
-	return freezer.GetState(dir)
+	return freezer.getState(m.host, dir)
 }
 
 func (m *manager) Exists() bool {
-	return cgroups.PathExists(m.Path("devices"))
+	return m.host.PathExists(m.Path("devices"))
 }
 
 func OOMKillCount(path string) (uint64, error) {
-	return fscommon.GetValueByKey(path, "memory.oom_control", "oom_kill")
+	return oomKillCount(nil, path)
+}
+
+func oomKillCount(h *cgroups.Host, path string) (uint64, error) {
+	return fscommon.GetValueByKeyFrom(h, path, "memory.oom_control", "oom_kill")
 }
 
 func (m *manager) OOMKillCount() (uint64, error) {
-	c, err := OOMKillCount(m.Path("memory"))
+	c, err := oomKillCount(m.host, m.Path("memory"))
 	// Ignore ENOENT when rootless as it couldn't create cgroup.
 	if err != nil && m.cgroups.Rootless && os.IsNotExist(err) {
 		err = nil
@@ -263,3 +544,11 @@ func (m *manager) OOMKillCount() (uint64, error) {
 
 	return c, err
 }
+
+func (m *manager) NotifyOOM(ctx context.Context) (<-chan cgroups.OOMEvent, error) {
+	return notifyOOM(ctx, m.host, m.Path("memory"))
+}
+
+func (m *manager) Reclaim(bytes uint64, swappiness *int) (uint64, error) {
+	return reclaim(m.host, m.Path("memory"), bytes, swappiness)
+}
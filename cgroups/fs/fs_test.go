@@ -1,9 +1,13 @@
 package fs
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 
 	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/cgroups/fscommon"
 	"github.com/dims/libcontainer/configs"
 )
 
@@ -48,3 +52,175 @@ func BenchmarkGetStats(b *testing.B) {
 		b.Fatalf("stats: %+v", st)
 	}
 }
+
+func TestSetRollback(t *testing.T) {
+	memoryPath := tempDir(t, "memory")
+	cpuPath := tempDir(t, "cpu")
+
+	writeFileContents(t, memoryPath, map[string]string{
+		"memory.limit_in_bytes":      "314572800",
+		"memory.soft_limit_in_bytes": "209715200",
+	})
+	writeFileContents(t, cpuPath, map[string]string{
+		"cpu.shares": "1024",
+	})
+	// Make writing to cpu.cfs_quota_us fail.
+	if err := os.Symlink("nonexistent/file", filepath.Join(cpuPath, "cpu.cfs_quota_us")); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(&configs.Cgroup{Resources: &configs.Resources{}}, map[string]string{
+		"memory": memoryPath,
+		"cpu":    cpuPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &configs.Resources{
+		Memory:            524288000,
+		MemoryReservation: 314572800,
+		CpuShares:         512,
+		CpuQuota:          10000,
+		SkipDevices:       true,
+	}
+	if err := m.Set(r); err == nil {
+		t.Fatal("expected Set to fail")
+	}
+
+	for _, f := range []struct{ path, file, expected string }{
+		{memoryPath, "memory.limit_in_bytes", "314572800"},
+		{memoryPath, "memory.soft_limit_in_bytes", "209715200"},
+		{cpuPath, "cpu.shares", "1024"},
+	} {
+		value, err := fscommon.GetCgroupParamString(f.path, f.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != f.expected {
+			t.Errorf("expected %s to be rolled back to %s, got %s", f.file, f.expected, value)
+		}
+	}
+}
+
+func TestPlanSet(t *testing.T) {
+	memoryPath := tempDir(t, "memory")
+	cpuPath := tempDir(t, "cpu")
+
+	writeFileContents(t, memoryPath, map[string]string{
+		"memory.limit_in_bytes":      "314572800",
+		"memory.soft_limit_in_bytes": "209715200",
+	})
+	writeFileContents(t, cpuPath, map[string]string{
+		"cpu.shares": "1024",
+	})
+
+	m, err := NewManager(&configs.Cgroup{Resources: &configs.Resources{}}, map[string]string{
+		"memory": memoryPath,
+		"cpu":    cpuPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &configs.Resources{
+		Memory:            524288000,
+		MemoryReservation: 314572800,
+		CpuShares:         512,
+		SkipDevices:       true,
+	}
+	p, err := m.PlanSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []cgroups.Op{
+		{Type: cgroups.OpWriteFile, Path: memoryPath, File: "memory.limit_in_bytes", Value: "524288000"},
+		{Type: cgroups.OpWriteFile, Path: memoryPath, File: "memory.soft_limit_in_bytes", Value: "314572800"},
+		{Type: cgroups.OpWriteFile, Path: cpuPath, File: "cpu.shares", Value: "512"},
+	}
+	if !reflect.DeepEqual(p.Ops, expected) {
+		t.Errorf("expected plan %v, got %v", expected, p.Ops)
+	}
+
+	// Planning must not change anything.
+	for _, f := range []struct{ path, file, expected string }{
+		{memoryPath, "memory.limit_in_bytes", "314572800"},
+		{memoryPath, "memory.soft_limit_in_bytes", "209715200"},
+		{cpuPath, "cpu.shares", "1024"},
+	} {
+		value, err := fscommon.GetCgroupParamString(f.path, f.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != f.expected {
+			t.Errorf("expected %s to be left as %s, got %s", f.file, f.expected, value)
+		}
+	}
+}
+
+func TestNewChild(t *testing.T) {
+	memoryPath := tempDir(t, "memory")
+	pidsPath := tempDir(t, "pids")
+
+	m, err := NewManager(&configs.Cgroup{Resources: &configs.Resources{}}, map[string]string{
+		"memory": memoryPath,
+		"pids":   pidsPath,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &configs.Resources{
+		Memory:      1073741824,
+		PidsLimit:   10,
+		SkipDevices: true,
+	}
+	child, err := m.NewChild("child", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	childMemoryPath := filepath.Join(memoryPath, "child")
+	if path := child.Path("memory"); path != childMemoryPath {
+		t.Errorf("expected child memory path %s, got %s", childMemoryPath, path)
+	}
+	for _, f := range []struct{ path, file, expected string }{
+		{childMemoryPath, "memory.limit_in_bytes", "1073741824"},
+		{filepath.Join(pidsPath, "child"), "pids.max", "10"},
+	} {
+		value, err := fscommon.GetCgroupParamString(f.path, f.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != f.expected {
+			t.Errorf("expected %s to be %s, got %s", f.file, f.expected, value)
+		}
+	}
+}
+
+func TestGetStatsTree(t *testing.T) {
+	pidsPath := tempDir(t, "pids")
+	for dir, current := range map[string]string{
+		pidsPath:                          "3\n",
+		filepath.Join(pidsPath, "a"):      "2\n",
+		filepath.Join(pidsPath, "a", "b"): "1\n",
+	} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		writeFileContents(t, dir, map[string]string{
+			"pids.current": current,
+			"pids.max":     "max\n",
+		})
+	}
+
+	tree, err := GetStatsTree(map[string]string{"pids": pidsPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]uint64{".": 3, "a": 2, "a/b": 1}
+	if len(tree) != len(expected) {
+		t.Fatalf("expected %d cgroups, got %v", len(expected), tree)
+	}
+	for p, current := range expected {
+		if stats := tree[p]; stats == nil || stats.PidsStats.Current != current {
+			t.Errorf("expected %s to have %d pids, got %+v", p, current, stats)
+		}
+	}
+}
@@ -16,24 +16,34 @@ func (s *HugetlbGroup) Name() string {
 	return "hugetlb"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *HugetlbGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
+func (s *HugetlbGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
 func (s *HugetlbGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *HugetlbGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	const suffix = ".limit_in_bytes"
 	skipRsvd := false
 
 	for _, hugetlb := range r.HugetlbLimit {
 		prefix := "hugetlb." + hugetlb.Pagesize
 		val := strconv.FormatUint(hugetlb.Limit, 10)
-		if err := cgroups.WriteFile(path, prefix+suffix, val); err != nil {
+		if err := w.WriteFile(path, prefix+suffix, val); err != nil {
 			return err
 		}
 		if skipRsvd {
 			continue
 		}
-		if err := cgroups.WriteFile(path, prefix+".rsvd"+suffix, val); err != nil {
+		if err := w.WriteFile(path, prefix+".rsvd"+suffix, val); err != nil {
 			if errors.Is(err, os.ErrNotExist) {
 				skipRsvd = true
 				continue
@@ -45,8 +55,49 @@ func (s *HugetlbGroup) Set(path string, r *configs.Resources) error {
 	return nil
 }
 
+// Snapshot records the files to be modified by Set.
+func (s *HugetlbGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	for _, hugetlb := range r.HugetlbLimit {
+		prefix := "hugetlb." + hugetlb.Pagesize
+		if err := snap.Save(path, prefix+".limit_in_bytes", prefix+".rsvd.limit_in_bytes"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Deprecated: use GetResourcesFrom instead.
+func (s *HugetlbGroup) GetResources(path string, r *configs.Resources) error {
+	return s.GetResourcesFrom(nil, path, r)
+}
+
+// GetResourcesFrom reads back the hugetlb limits set by SetTo.
+// Page sizes with no limit set are not included.
+func (s *HugetlbGroup) GetResourcesFrom(h *cgroups.Host, path string, r *configs.Resources) error {
+	r.HugetlbLimit = nil
+	for _, pagesize := range cgroups.HugePageSizes() {
+		limit, err := fscommon.GetCgroupParamLimitFrom(h, path, "hugetlb."+pagesize+".limit_in_bytes")
+		if err != nil {
+			return err
+		}
+		if limit == -1 {
+			continue
+		}
+		r.HugetlbLimit = append(r.HugetlbLimit, &configs.HugepageLimit{
+			Pagesize: pagesize,
+			Limit:    uint64(limit),
+		})
+	}
+	return nil
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *HugetlbGroup) GetStats(path string, stats *cgroups.Stats) error {
-	if !cgroups.PathExists(path) {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *HugetlbGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
+	if !h.PathExists(path) {
 		return nil
 	}
 	rsvd := ".rsvd"
@@ -55,7 +106,7 @@ func (s *HugetlbGroup) GetStats(path string, stats *cgroups.Stats) error {
 	again:
 		prefix := "hugetlb." + pageSize + rsvd
 
-		value, err := fscommon.GetCgroupParamUint(path, prefix+".usage_in_bytes")
+		value, err := fscommon.GetCgroupParamUintFrom(h, path, prefix+".usage_in_bytes")
 		if err != nil {
 			if rsvd != "" && errors.Is(err, os.ErrNotExist) {
 				rsvd = ""
@@ -65,13 +116,13 @@ func (s *HugetlbGroup) GetStats(path string, stats *cgroups.Stats) error {
 		}
 		hugetlbStats.Usage = value
 
-		value, err = fscommon.GetCgroupParamUint(path, prefix+".max_usage_in_bytes")
+		value, err = fscommon.GetCgroupParamUintFrom(h, path, prefix+".max_usage_in_bytes")
 		if err != nil {
 			return err
 		}
 		hugetlbStats.MaxUsage = value
 
-		value, err = fscommon.GetCgroupParamUint(path, prefix+".failcnt")
+		value, err = fscommon.GetCgroupParamUintFrom(h, path, prefix+".failcnt")
 		if err != nil {
 			return err
 		}
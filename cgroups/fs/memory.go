@@ -30,27 +30,33 @@ func (s *MemoryGroup) Name() string {
 	return "memory"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *MemoryGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
-func setMemory(path string, val int64) error {
+func (s *MemoryGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+func setMemory(w cgroups.FileWriter, path string, val int64) error {
 	if val == 0 {
 		return nil
 	}
 
-	err := cgroups.WriteFile(path, cgroupMemoryLimit, strconv.FormatInt(val, 10))
+	err := w.WriteFile(path, cgroupMemoryLimit, strconv.FormatInt(val, 10))
 	if !errors.Is(err, unix.EBUSY) {
 		return err
 	}
 
 	// EBUSY means the kernel can't set new limit as it's too low
 	// (lower than the current usage). Return more specific error.
-	usage, err := fscommon.GetCgroupParamUint(path, cgroupMemoryUsage)
+	h := cgroups.FileWriterHost(w)
+	usage, err := fscommon.GetCgroupParamUintFrom(h, path, cgroupMemoryUsage)
 	if err != nil {
 		return err
 	}
-	max, err := fscommon.GetCgroupParamUint(path, cgroupMemoryMaxUsage)
+	max, err := fscommon.GetCgroupParamUintFrom(h, path, cgroupMemoryMaxUsage)
 	if err != nil {
 		return err
 	}
@@ -58,15 +64,15 @@ func setMemory(path string, val int64) error {
 	return fmt.Errorf("unable to set memory limit to %d (current usage: %d, peak usage: %d)", val, usage, max)
 }
 
-func setSwap(path string, val int64) error {
+func setSwap(w cgroups.FileWriter, path string, val int64) error {
 	if val == 0 {
 		return nil
 	}
 
-	return cgroups.WriteFile(path, cgroupMemorySwapLimit, strconv.FormatInt(val, 10))
+	return w.WriteFile(path, cgroupMemorySwapLimit, strconv.FormatInt(val, 10))
 }
 
-func setMemoryAndSwap(path string, r *configs.Resources) error {
+func setMemoryAndSwap(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	// If the memory update is set to -1 and the swap is not explicitly
 	// set, we should also set swap to -1, it means unlimited memory.
 	if r.Memory == -1 && r.MemorySwap == 0 {
@@ -79,7 +85,7 @@ func setMemoryAndSwap(path string, r *configs.Resources) error {
 	// When memory and swap memory are both set, we need to handle the cases
 	// for updating container.
 	if r.Memory != 0 && r.MemorySwap != 0 {
-		curLimit, err := fscommon.GetCgroupParamUint(path, cgroupMemoryLimit)
+		curLimit, err := fscommon.GetCgroupParamUintFrom(cgroups.FileWriterHost(w), path, cgroupMemoryLimit)
 		if err != nil {
 			return err
 		}
@@ -88,48 +94,53 @@ func setMemoryAndSwap(path string, r *configs.Resources) error {
 		// for memory and swap memory, so it won't fail because the new
 		// value and the old value don't fit kernel's validation.
 		if r.MemorySwap == -1 || curLimit < uint64(r.MemorySwap) {
-			if err := setSwap(path, r.MemorySwap); err != nil {
+			if err := setSwap(w, path, r.MemorySwap); err != nil {
 				return err
 			}
-			if err := setMemory(path, r.Memory); err != nil {
+			if err := setMemory(w, path, r.Memory); err != nil {
 				return err
 			}
 			return nil
 		}
 	}
 
-	if err := setMemory(path, r.Memory); err != nil {
+	if err := setMemory(w, path, r.Memory); err != nil {
 		return err
 	}
-	if err := setSwap(path, r.MemorySwap); err != nil {
+	if err := setSwap(w, path, r.MemorySwap); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// Deprecated: use SetTo instead.
 func (s *MemoryGroup) Set(path string, r *configs.Resources) error {
-	if err := setMemoryAndSwap(path, r); err != nil {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *MemoryGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
+	if err := setMemoryAndSwap(w, path, r); err != nil {
 		return err
 	}
 
 	// ignore KernelMemory and KernelMemoryTCP
 
 	if r.MemoryReservation != 0 {
-		if err := cgroups.WriteFile(path, "memory.soft_limit_in_bytes", strconv.FormatInt(r.MemoryReservation, 10)); err != nil {
+		if err := w.WriteFile(path, "memory.soft_limit_in_bytes", strconv.FormatInt(r.MemoryReservation, 10)); err != nil {
 			return err
 		}
 	}
 
 	if r.OomKillDisable {
-		if err := cgroups.WriteFile(path, "memory.oom_control", "1"); err != nil {
+		if err := w.WriteFile(path, "memory.oom_control", "1"); err != nil {
 			return err
 		}
 	}
 	if r.MemorySwappiness == nil || int64(*r.MemorySwappiness) == -1 {
 		return nil
 	} else if *r.MemorySwappiness <= 100 {
-		if err := cgroups.WriteFile(path, "memory.swappiness", strconv.FormatUint(*r.MemorySwappiness, 10)); err != nil {
+		if err := w.WriteFile(path, "memory.swappiness", strconv.FormatUint(*r.MemorySwappiness, 10)); err != nil {
 			return err
 		}
 	} else {
@@ -139,9 +150,65 @@ func (s *MemoryGroup) Set(path string, r *configs.Resources) error {
 	return nil
 }
 
+// Snapshot records the files to be modified by Set.
+func (s *MemoryGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if r.Memory != 0 || r.MemorySwap != 0 {
+		if err := snap.Save(path, cgroupMemorySwapLimit, cgroupMemoryLimit); err != nil {
+			return err
+		}
+	}
+	if r.MemoryReservation != 0 {
+		if err := snap.Save(path, "memory.soft_limit_in_bytes"); err != nil {
+			return err
+		}
+	}
+	if r.OomKillDisable {
+		// memory.oom_control has several fields,
+		// of which only oom_kill_disable can be written.
+		disable, err := fscommon.GetValueByKeyFrom(snap.Host, path, "memory.oom_control", "oom_kill_disable")
+		if err == nil {
+			snap.Add(func() error {
+				return snap.Host.WriteFile(path, "memory.oom_control", strconv.FormatUint(disable, 10))
+			})
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	if r.MemorySwappiness != nil && int64(*r.MemorySwappiness) != -1 {
+		return snap.Save(path, "memory.swappiness")
+	}
+	return nil
+}
+
+// Deprecated: use GetResourcesFrom instead.
+func (s *MemoryGroup) GetResources(path string, r *configs.Resources) error {
+	return s.GetResourcesFrom(nil, path, r)
+}
+
+// GetResourcesFrom reads back the memory limits set by SetTo.
+func (s *MemoryGroup) GetResourcesFrom(h *cgroups.Host, path string, r *configs.Resources) error {
+	var err error
+	if r.Memory, err = fscommon.GetCgroupParamLimitFrom(h, path, cgroupMemoryLimit); err != nil {
+		return err
+	}
+	if r.MemoryReservation, err = fscommon.GetCgroupParamLimitFrom(h, path, "memory.soft_limit_in_bytes"); err != nil {
+		return err
+	}
+	// memsw is only available if swap accounting is enabled.
+	if r.MemorySwap, err = fscommon.GetCgroupParamLimitFrom(h, path, cgroupMemorySwapLimit); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *MemoryGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
 	const file = "memory.stat"
-	statsFile, err := cgroups.OpenFile(path, file, os.O_RDONLY)
+	statsFile, err := h.OpenFile(path, file, os.O_RDONLY)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return nil
@@ -160,12 +227,18 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 	}
 	stats.MemoryStats.Cache = stats.MemoryStats.Stats["cache"]
 
-	memoryUsage, err := getMemoryData(path, "")
+	memoryUsage, err := getMemoryData(h, path, "")
 	if err != nil {
 		return err
 	}
 	stats.MemoryStats.Usage = memoryUsage
-	swapUsage, err := getMemoryData(path, "memsw")
+	// memory.failcnt counts hits of the limit, which is
+	// the cgroup v1 equivalent of the "max" event in v2.
+	stats.MemoryStats.Events.Max = memoryUsage.Failcnt
+	if err := getOOMControl(h, path, &stats.MemoryStats.Events); err != nil {
+		return err
+	}
+	swapUsage, err := getMemoryData(h, path, "memsw")
 	if err != nil {
 		return err
 	}
@@ -174,18 +247,18 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 		Usage:   swapUsage.Usage - memoryUsage.Usage,
 		Failcnt: swapUsage.Failcnt - memoryUsage.Failcnt,
 	}
-	kernelUsage, err := getMemoryData(path, "kmem")
+	kernelUsage, err := getMemoryData(h, path, "kmem")
 	if err != nil {
 		return err
 	}
 	stats.MemoryStats.KernelUsage = kernelUsage
-	kernelTCPUsage, err := getMemoryData(path, "kmem.tcp")
+	kernelTCPUsage, err := getMemoryData(h, path, "kmem.tcp")
 	if err != nil {
 		return err
 	}
 	stats.MemoryStats.KernelTCPUsage = kernelTCPUsage
 
-	value, err := fscommon.GetCgroupParamUint(path, "memory.use_hierarchy")
+	value, err := fscommon.GetCgroupParamUintFrom(h, path, "memory.use_hierarchy")
 	if err != nil {
 		return err
 	}
@@ -193,7 +266,7 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 		stats.MemoryStats.UseHierarchy = true
 	}
 
-	pagesByNUMA, err := getPageUsageByNUMA(path)
+	pagesByNUMA, err := getPageUsageByNUMA(h, path)
 	if err != nil {
 		return err
 	}
@@ -202,7 +275,7 @@ func (s *MemoryGroup) GetStats(path string, stats *cgroups.Stats) error {
 	return nil
 }
 
-func getMemoryData(path, name string) (cgroups.MemoryData, error) {
+func getMemoryData(h *cgroups.Host, path, name string) (cgroups.MemoryData, error) {
 	memoryData := cgroups.MemoryData{}
 
 	moduleName := "memory"
@@ -216,7 +289,7 @@ func getMemoryData(path, name string) (cgroups.MemoryData, error) {
 		limit    = moduleName + ".limit_in_bytes"
 	)
 
-	value, err := fscommon.GetCgroupParamUint(path, usage)
+	value, err := fscommon.GetCgroupParamUintFrom(h, path, usage)
 	if err != nil {
 		if name != "" && os.IsNotExist(err) {
 			// Ignore ENOENT as swap and kmem controllers
@@ -226,17 +299,17 @@ func getMemoryData(path, name string) (cgroups.MemoryData, error) {
 		return cgroups.MemoryData{}, err
 	}
 	memoryData.Usage = value
-	value, err = fscommon.GetCgroupParamUint(path, maxUsage)
+	value, err = fscommon.GetCgroupParamUintFrom(h, path, maxUsage)
 	if err != nil {
 		return cgroups.MemoryData{}, err
 	}
 	memoryData.MaxUsage = value
-	value, err = fscommon.GetCgroupParamUint(path, failcnt)
+	value, err = fscommon.GetCgroupParamUintFrom(h, path, failcnt)
 	if err != nil {
 		return cgroups.MemoryData{}, err
 	}
 	memoryData.Failcnt = value
-	value, err = fscommon.GetCgroupParamUint(path, limit)
+	value, err = fscommon.GetCgroupParamUintFrom(h, path, limit)
 	if err != nil {
 		if name == "kmem" && os.IsNotExist(err) {
 			// Ignore ENOENT as kmem.limit_in_bytes has
@@ -251,14 +324,46 @@ func getMemoryData(path, name string) (cgroups.MemoryData, error) {
 	return memoryData, nil
 }
 
-func getPageUsageByNUMA(path string) (cgroups.PageUsageByNUMA, error) {
+// getOOMControl fills in the OOM related event counters
+// from the memory.oom_control file.
+func getOOMControl(h *cgroups.Host, path string, events *cgroups.MemoryEvents) error {
+	const file = "memory.oom_control"
+	fd, err := h.OpenFile(path, file, os.O_RDONLY)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer fd.Close()
+
+	sc := bufio.NewScanner(fd)
+	for sc.Scan() {
+		t, v, err := fscommon.ParseKeyValue(sc.Text())
+		if err != nil {
+			return &parseError{Path: path, File: file, Err: err}
+		}
+		switch t {
+		case "under_oom":
+			events.UnderOOM = v == 1
+		case "oom_kill": // since kernel 4.13
+			events.OOMKill = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return &parseError{Path: path, File: file, Err: err}
+	}
+	return nil
+}
+
+func getPageUsageByNUMA(h *cgroups.Host, path string) (cgroups.PageUsageByNUMA, error) {
 	const (
 		maxColumns = math.MaxUint8 + 1
 		file       = "memory.numa_stat"
 	)
 	stats := cgroups.PageUsageByNUMA{}
 
-	fd, err := cgroups.OpenFile(path, file, os.O_RDONLY)
+	fd, err := h.OpenFile(path, file, os.O_RDONLY)
 	if os.IsNotExist(err) {
 		return stats, nil
 	} else if err != nil {
@@ -356,3 +461,67 @@ func getNUMAField(stats *cgroups.PageUsageByNUMA, name string) *cgroups.PageStat
 	}
 	return nil
 }
+
+// Reclaim emulates the cgroup v2 memory.reclaim for the memory cgroup at
+// path (see cgroups.Manager.Reclaim), and returns the decrease of the
+// memory usage.
+//
+// Cgroup v1 can only reclaim the whole memory of a cgroup right away, by
+// writing memory.force_empty, so bytes must not be less than the usage,
+// otherwise cgroups.ErrV1NoReclaim is returned. If swappiness is not nil,
+// memory.swappiness is set to it while doing so, and restored afterwards.
+func Reclaim(path string, bytes uint64, swappiness *int) (uint64, error) {
+	return reclaim(nil, path, bytes, swappiness)
+}
+
+func reclaim(h *cgroups.Host, path string, bytes uint64, swappiness *int) (uint64, error) {
+	if path == "" {
+		return 0, errors.New("no memory cgroup")
+	}
+	if bytes == 0 {
+		return 0, errors.New("the amount of memory to reclaim must be non-zero")
+	}
+	if swappiness != nil && (*swappiness < 0 || *swappiness > 100) {
+		return 0, fmt.Errorf("invalid swappiness value: %d (valid range is 0-100)", *swappiness)
+	}
+	before, err := fscommon.GetCgroupParamUintFrom(h, path, cgroupMemoryUsage)
+	if err != nil {
+		return 0, err
+	}
+	// The soft limit could be lowered instead, but the memory above it
+	// is only reclaimed under global memory pressure, if ever.
+	if bytes < before {
+		return 0, cgroups.ErrV1NoReclaim
+	}
+	if err := forceEmpty(h, path, swappiness); err != nil {
+		return 0, err
+	}
+	after, err := fscommon.GetCgroupParamUintFrom(h, path, cgroupMemoryUsage)
+	if err != nil {
+		return 0, err
+	}
+	if after > before {
+		return 0, nil
+	}
+	return before - after, nil
+}
+
+// forceEmpty writes memory.force_empty, with memory.swappiness
+// temporarily set to swappiness if it is not nil.
+func forceEmpty(h *cgroups.Host, path string, swappiness *int) (Err error) {
+	if swappiness != nil {
+		prev, err := h.ReadFile(path, "memory.swappiness")
+		if err != nil {
+			return err
+		}
+		if err := h.WriteFile(path, "memory.swappiness", strconv.Itoa(*swappiness)); err != nil {
+			return err
+		}
+		defer func() {
+			if err := h.WriteFile(path, "memory.swappiness", strings.TrimSpace(prev)); err != nil && Err == nil {
+				Err = err
+			}
+		}()
+	}
+	return h.WriteFile(path, "memory.force_empty", "0")
+}
@@ -1,6 +1,7 @@
 package fs
 
 import (
+	"errors"
 	"strconv"
 	"testing"
 
@@ -17,7 +18,11 @@ rss 1024`
 	memoryFailcnt              = "100\n"
 	memoryLimitContents        = "8192\n"
 	memoryUseHierarchyContents = "1\n"
-	memoryNUMAStatContents     = `total=44611 N0=32631 N1=7501 N2=1982 N3=2497
+	memoryOOMControlContents   = `oom_kill_disable 1
+under_oom 1
+oom_kill 3
+`
+	memoryNUMAStatContents = `total=44611 N0=32631 N1=7501 N2=1982 N3=2497
 file=44428 N0=32614 N1=7335 N2=1982 N3=2497
 anon=183 N0=17 N1=166 N2=0 N3=0
 unevictable=0 N0=0 N1=0 N2=0 N3=0
@@ -222,6 +227,67 @@ func TestMemorySetMemorySwappinessDefault(t *testing.T) {
 	}
 }
 
+func TestMemoryReclaim(t *testing.T) {
+	path := tempDir(t, "memory")
+
+	writeFileContents(t, path, map[string]string{
+		"memory.usage_in_bytes": "8192",
+		"memory.swappiness":     "60",
+		"memory.force_empty":    "",
+	})
+
+	// Less than the usage: unsupported.
+	if _, err := Reclaim(path, 4096, nil); !errors.Is(err, cgroups.ErrV1NoReclaim) {
+		t.Fatalf("expected ErrV1NoReclaim, got %v", err)
+	}
+	if value, err := cgroups.ReadFile(path, "memory.force_empty"); err != nil || value != "" {
+		t.Fatalf("expected memory.force_empty not to be written, got %q (%v)", value, err)
+	}
+
+	// The whole usage: memory.force_empty is written, with the
+	// swappiness overridden in the meantime.
+	swappiness := 0
+	if _, err := Reclaim(path, 8192, &swappiness); err != nil {
+		t.Fatal(err)
+	}
+	if value, err := cgroups.ReadFile(path, "memory.force_empty"); err != nil || value != "0" {
+		t.Fatalf("expected memory.force_empty to be written, got %q (%v)", value, err)
+	}
+	if value, err := fscommon.GetCgroupParamUint(path, "memory.swappiness"); err != nil || value != 60 {
+		t.Fatalf("expected memory.swappiness to be restored to 60, got %d (%v)", value, err)
+	}
+
+	swappiness = 101
+	if _, err := Reclaim(path, 8192, &swappiness); err == nil {
+		t.Fatal("expected error for invalid swappiness, got nil")
+	}
+}
+
+func TestMemoryGetResources(t *testing.T) {
+	path := tempDir(t, "memory")
+
+	writeFileContents(t, path, map[string]string{
+		"memory.limit_in_bytes":       "524288000",
+		"memory.soft_limit_in_bytes":  "9223372036854771712", // no limit
+		"memory.memsw.limit_in_bytes": "9223372036854771712", // no limit
+	})
+
+	r := &configs.Resources{}
+	memory := &MemoryGroup{}
+	if err := memory.GetResources(path, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.Memory != 524288000 {
+		t.Errorf("expected Memory 524288000, got %d", r.Memory)
+	}
+	if r.MemoryReservation != -1 {
+		t.Errorf("expected MemoryReservation -1, got %d", r.MemoryReservation)
+	}
+	if r.MemorySwap != -1 {
+		t.Errorf("expected MemorySwap -1, got %d", r.MemorySwap)
+	}
+}
+
 func TestMemoryStats(t *testing.T) {
 	path := tempDir(t, "memory")
 	writeFileContents(t, path, map[string]string{
@@ -240,6 +306,7 @@ func TestMemoryStats(t *testing.T) {
 		"memory.kmem.limit_in_bytes":      memoryLimitContents,
 		"memory.use_hierarchy":            memoryUseHierarchyContents,
 		"memory.numa_stat":                memoryNUMAStatContents + memoryNUMAStatExtraContents,
+		"memory.oom_control":              memoryOOMControlContents,
 	})
 
 	memory := &MemoryGroup{}
@@ -256,6 +323,10 @@ func TestMemoryStats(t *testing.T) {
 		KernelUsage:   cgroups.MemoryData{Usage: 2048, MaxUsage: 4096, Failcnt: 100, Limit: 8192},
 		Stats:         map[string]uint64{"cache": 512, "rss": 1024},
 		UseHierarchy:  true,
+		Events: cgroups.MemoryEvents{
+			MemoryEventsInner: cgroups.MemoryEventsInner{Max: 100, OOMKill: 3},
+			UnderOOM:          true,
+		},
 		PageUsageByNUMA: cgroups.PageUsageByNUMA{
 			PageUsageByNUMAInner: cgroups.PageUsageByNUMAInner{
 				Total:       cgroups.PageStats{Total: 44611, Nodes: map[uint8]uint64{0: 32631, 1: 7501, 2: 1982, 3: 2497}},
@@ -438,7 +509,7 @@ func TestNoHierarchicalNumaStat(t *testing.T) {
 		"memory.numa_stat": memoryNUMAStatNoHierarchyContents + memoryNUMAStatExtraContents,
 	})
 
-	actualStats, err := getPageUsageByNUMA(path)
+	actualStats, err := getPageUsageByNUMA(nil, path)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -489,7 +560,7 @@ anon=183 N0=12 badone
 			"memory.numa_stat": c.contents,
 		})
 
-		_, err := getPageUsageByNUMA(path)
+		_, err := getPageUsageByNUMA(nil, path)
 		if err == nil {
 			t.Errorf("case %q: expected error, got nil", c.desc)
 		}
@@ -499,7 +570,7 @@ anon=183 N0=12 badone
 func TestWithoutNumaStat(t *testing.T) {
 	path := tempDir(t, "memory")
 
-	actualStats, err := getPageUsageByNUMA(path)
+	actualStats, err := getPageUsageByNUMA(nil, path)
 	if err != nil {
 		t.Fatal(err)
 	}
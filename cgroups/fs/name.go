@@ -14,18 +14,33 @@ func (s *NameGroup) Name() string {
 	return s.GroupName
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *NameGroup) Apply(path string, _ *configs.Resources, pid int) error {
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
+}
+
+func (s *NameGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
 	if s.Join {
 		// Ignore errors if the named cgroup does not exist.
-		_ = apply(path, pid)
+		_ = apply(w, path, pid)
 	}
 	return nil
 }
 
-func (s *NameGroup) Set(_ string, _ *configs.Resources) error {
+// Deprecated: use SetTo instead.
+func (s *NameGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *NameGroup) SetTo(_ cgroups.FileWriter, _ string, _ *configs.Resources) error {
 	return nil
 }
 
+// Deprecated: use GetStatsFrom instead.
 func (s *NameGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *NameGroup) GetStatsFrom(_ *cgroups.Host, _ string, _ *cgroups.Stats) error {
 	return nil
 }
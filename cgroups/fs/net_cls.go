@@ -13,13 +13,23 @@ func (s *NetClsGroup) Name() string {
 	return "net_cls"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *NetClsGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
+func (s *NetClsGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
 func (s *NetClsGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *NetClsGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	if r.NetClsClassid != 0 {
-		if err := cgroups.WriteFile(path, "net_cls.classid", strconv.FormatUint(uint64(r.NetClsClassid), 10)); err != nil {
+		if err := w.WriteFile(path, "net_cls.classid", strconv.FormatUint(uint64(r.NetClsClassid), 10)); err != nil {
 			return err
 		}
 	}
@@ -27,6 +37,19 @@ func (s *NetClsGroup) Set(path string, r *configs.Resources) error {
 	return nil
 }
 
+// Snapshot records the files to be modified by Set.
+func (s *NetClsGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if r.NetClsClassid != 0 {
+		return snap.Save(path, "net_cls.classid")
+	}
+	return nil
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *NetClsGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *NetClsGroup) GetStatsFrom(_ *cgroups.Host, _ string, _ *cgroups.Stats) error {
 	return nil
 }
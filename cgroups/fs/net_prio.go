@@ -11,13 +11,23 @@ func (s *NetPrioGroup) Name() string {
 	return "net_prio"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *NetPrioGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
+func (s *NetPrioGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
 func (s *NetPrioGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *NetPrioGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	for _, prioMap := range r.NetPrioIfpriomap {
-		if err := cgroups.WriteFile(path, "net_prio.ifpriomap", prioMap.CgroupString()); err != nil {
+		if err := w.WriteFile(path, "net_prio.ifpriomap", prioMap.CgroupString()); err != nil {
 			return err
 		}
 	}
@@ -25,6 +35,21 @@ func (s *NetPrioGroup) Set(path string, r *configs.Resources) error {
 	return nil
 }
 
+// Snapshot records the files to be modified by Set.
+func (s *NetPrioGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if len(r.NetPrioIfpriomap) > 0 {
+		// All interfaces are listed, so the old
+		// priorities can simply be written back.
+		return snap.Save(path, "net_prio.ifpriomap")
+	}
+	return nil
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *NetPrioGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *NetPrioGroup) GetStatsFrom(_ *cgroups.Host, _ string, _ *cgroups.Stats) error {
 	return nil
 }
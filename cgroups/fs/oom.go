@@ -0,0 +1,86 @@
+package fs
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+)
+
+// NotifyOOM returns a channel which receives an event every time an OOM
+// condition occurs in the memory cgroup at path. It uses the cgroup v1
+// notification API (cgroup.event_control with an eventfd registered for
+// memory.oom_control). The channel is closed once ctx is done, or the
+// cgroup is removed.
+func NotifyOOM(ctx context.Context, path string) (<-chan cgroups.OOMEvent, error) {
+	return notifyOOM(ctx, nil, path)
+}
+
+func notifyOOM(ctx context.Context, h *cgroups.Host, path string) (<-chan cgroups.OOMEvent, error) {
+	const (
+		controlFile = "cgroup.event_control"
+		oomFile     = "memory.oom_control"
+	)
+
+	oomControl, err := h.OpenFile(path, oomFile, unix.O_RDONLY)
+	if err != nil {
+		return nil, err
+	}
+	efd, err := unix.Eventfd(0, unix.EFD_CLOEXEC|unix.EFD_NONBLOCK)
+	if err != nil {
+		oomControl.Close()
+		return nil, os.NewSyscallError("eventfd", err)
+	}
+	// A non-blocking fd is handled by the runtime poller,
+	// so a pending Read is interrupted by Close.
+	eventfd := os.NewFile(uintptr(efd), "eventfd")
+
+	data := fmt.Sprintf("%d %d", efd, oomControl.Fd())
+	if err := h.WriteFile(path, controlFile, data); err != nil {
+		eventfd.Close()
+		oomControl.Close()
+		return nil, err
+	}
+
+	ch := make(chan cgroups.OOMEvent)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		eventfd.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer close(done)
+		defer oomControl.Close()
+
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventfd.Read(buf); err != nil {
+				return
+			}
+			// The eventfd is also signalled when the cgroup is removed.
+			if !cgroups.PathExists(filepath.Join(path, controlFile)) {
+				return
+			}
+			// oom_kill is only available since kernel 4.13.
+			count, _ := oomKillCount(h, path)
+			for n := binary.NativeEndian.Uint64(buf); n > 0; n-- {
+				select {
+				case ch <- cgroups.OOMEvent{OOMKill: count}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -4,6 +4,7 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 
 	"golang.org/x/sys/unix"
@@ -21,7 +22,7 @@ var (
 
 const defaultCgroupRoot = "/sys/fs/cgroup"
 
-func initPaths(cg *configs.Cgroup) (map[string]string, error) {
+func initPaths(h *cgroups.Host, cg *configs.Cgroup) (map[string]string, error) {
 	root, err := rootPath()
 	if err != nil {
 		return nil, err
@@ -35,6 +36,9 @@ func initPaths(cg *configs.Cgroup) (map[string]string, error) {
 	paths := make(map[string]string)
 	for _, sys := range subsystems {
 		name := sys.Name()
+		if name == "" && h.Mode != cgroups.Hybrid {
+			continue
+		}
 		path, err := subsysPath(root, inner, name)
 		if err != nil {
 			// The non-presence of the devices subsystem
@@ -51,6 +55,39 @@ func initPaths(cg *configs.Cgroup) (map[string]string, error) {
 	return paths, nil
 }
 
+// hostPaths is like initPaths, but for the cgroup filesystem at root of a
+// host other than the default one (see cgroups.Host), where the hierarchies
+// are found by their names, and a relative cgroup path is relative to the
+// root cgroup rather than to the one of the current process.
+func hostPaths(h *cgroups.Host, cg *configs.Cgroup) (map[string]string, error) {
+	inner, err := innerPath(cg)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := make(map[string]string)
+	for _, sys := range subsystems {
+		name := sys.Name()
+		dir := filepath.Join(h.Root, strings.TrimPrefix(name, cgroups.CgroupNamePrefix))
+		if name == "" {
+			if h.Mode != cgroups.Hybrid {
+				continue
+			}
+			// The cgroup v2 hierarchy in hybrid mode.
+			dir = filepath.Join(h.Root, "unified")
+		}
+		if _, err := os.Stat(dir); err != nil {
+			if os.IsNotExist(err) && (cg.SkipDevices || name != "devices") {
+				continue
+			}
+			return nil, err
+		}
+		paths[name] = filepath.Join(dir, inner)
+	}
+
+	return paths, nil
+}
+
 func tryDefaultCgroupRoot() string {
 	var st, pst unix.Stat_t
 
@@ -176,12 +213,12 @@ func subsysPath(root, inner, subsystem string) (string, error) {
 	return filepath.Join(parentPath, inner), nil
 }
 
-func apply(path string, pid int) error {
+func apply(w cgroups.FileWriter, path string, pid int) error {
 	if path == "" {
 		return nil
 	}
-	if err := os.MkdirAll(path, 0o755); err != nil {
+	if err := cgroups.MkdirAll(w, path); err != nil {
 		return err
 	}
-	return cgroups.WriteCgroupProc(path, pid)
+	return cgroups.WriteCgroupProcTo(w, path, pid)
 }
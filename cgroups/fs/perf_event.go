@@ -11,14 +11,29 @@ func (s *PerfEventGroup) Name() string {
 	return "perf_event"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *PerfEventGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
-func (s *PerfEventGroup) Set(_ string, _ *configs.Resources) error {
+func (s *PerfEventGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
+func (s *PerfEventGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *PerfEventGroup) SetTo(_ cgroups.FileWriter, _ string, _ *configs.Resources) error {
 	return nil
 }
 
+// Deprecated: use GetStatsFrom instead.
 func (s *PerfEventGroup) GetStats(path string, stats *cgroups.Stats) error {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *PerfEventGroup) GetStatsFrom(_ *cgroups.Host, _ string, _ *cgroups.Stats) error {
 	return nil
 }
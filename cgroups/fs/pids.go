@@ -15,11 +15,21 @@ func (s *PidsGroup) Name() string {
 	return "pids"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *PidsGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
+func (s *PidsGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
 func (s *PidsGroup) Set(path string, r *configs.Resources) error {
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *PidsGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	if r.PidsLimit != 0 {
 		// "max" is the fallback value.
 		limit := "max"
@@ -28,7 +38,7 @@ func (s *PidsGroup) Set(path string, r *configs.Resources) error {
 			limit = strconv.FormatInt(r.PidsLimit, 10)
 		}
 
-		if err := cgroups.WriteFile(path, "pids.max", limit); err != nil {
+		if err := w.WriteFile(path, "pids.max", limit); err != nil {
 			return err
 		}
 	}
@@ -36,16 +46,41 @@ func (s *PidsGroup) Set(path string, r *configs.Resources) error {
 	return nil
 }
 
+// Snapshot records the files to be modified by Set.
+func (s *PidsGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if r.PidsLimit != 0 {
+		return snap.Save(path, "pids.max")
+	}
+	return nil
+}
+
+// Deprecated: use GetResourcesFrom instead.
+func (s *PidsGroup) GetResources(path string, r *configs.Resources) error {
+	return s.GetResourcesFrom(nil, path, r)
+}
+
+// GetResourcesFrom reads back the pids limit set by SetTo.
+func (s *PidsGroup) GetResourcesFrom(h *cgroups.Host, path string, r *configs.Resources) error {
+	var err error
+	r.PidsLimit, err = fscommon.GetCgroupParamLimitFrom(h, path, "pids.max")
+	return err
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *PidsGroup) GetStats(path string, stats *cgroups.Stats) error {
-	if !cgroups.PathExists(path) {
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *PidsGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
+	if !h.PathExists(path) {
 		return nil
 	}
-	current, err := fscommon.GetCgroupParamUint(path, "pids.current")
+	current, err := fscommon.GetCgroupParamUintFrom(h, path, "pids.current")
 	if err != nil {
 		return err
 	}
 
-	max, err := fscommon.GetCgroupParamUint(path, "pids.max")
+	max, err := fscommon.GetCgroupParamUintFrom(h, path, "pids.max")
 	if err != nil {
 		return err
 	}
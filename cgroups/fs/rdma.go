@@ -12,14 +12,34 @@ func (s *RdmaGroup) Name() string {
 	return "rdma"
 }
 
+// Deprecated: use ApplyTo instead.
 func (s *RdmaGroup) Apply(path string, _ *configs.Resources, pid int) error {
-	return apply(path, pid)
+	return s.ApplyTo(cgroups.Cgroupfs, path, nil, pid)
 }
 
+func (s *RdmaGroup) ApplyTo(w cgroups.FileWriter, path string, _ *configs.Resources, pid int) error {
+	return apply(w, path, pid)
+}
+
+// Deprecated: use SetTo instead.
 func (s *RdmaGroup) Set(path string, r *configs.Resources) error {
-	return fscommon.RdmaSet(path, r)
+	return s.SetTo(cgroups.Cgroupfs, path, r)
+}
+
+func (s *RdmaGroup) SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
+	return fscommon.RdmaSetTo(w, path, r)
 }
 
+// Snapshot records the files to be modified by Set.
+func (s *RdmaGroup) Snapshot(snap *cgroups.Snapshot, path string, r *configs.Resources) error {
+	return fscommon.RdmaSnapshot(snap, path, r)
+}
+
+// Deprecated: use GetStatsFrom instead.
 func (s *RdmaGroup) GetStats(path string, stats *cgroups.Stats) error {
-	return fscommon.RdmaGetStats(path, stats)
+	return s.GetStatsFrom(nil, path, stats)
+}
+
+func (s *RdmaGroup) GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
+	return fscommon.RdmaGetStatsFrom(h, path, stats)
 }
@@ -78,6 +78,10 @@ func expectMemoryStatEquals(t *testing.T, expected, actual cgroups.MemoryStats)
 	expectMemoryDataEquals(t, expected.KernelUsage, actual.KernelUsage)
 	expectPageUsageByNUMAEquals(t, expected.PageUsageByNUMA, actual.PageUsageByNUMA)
 
+	if expected.Events != actual.Events {
+		t.Errorf("Expected memory events: %+v, actual: %+v", expected.Events, actual.Events)
+	}
+
 	if expected.UseHierarchy != actual.UseHierarchy {
 		t.Errorf("Expected memory use hierarchy: %v, actual: %v", expected.UseHierarchy, actual.UseHierarchy)
 	}
@@ -0,0 +1,149 @@
+package fs2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+// leafName is the name of the sub-cgroup the processes of a cgroup are
+// moved to when controllers are enabled for its children, as per the
+// "no internal processes" rule of cgroup v2. It is rejected as a child
+// name by NewChild.
+const leafName = "leaf"
+
+// procsDir returns the directory the processes added to the cgroup at
+// dirPath (of the host h) are to be written to, which is its leaf
+// sub-cgroup if there is one (see moveToLeaf).
+func procsDir(h *cgroups.Host, dirPath string) string {
+	if leaf := filepath.Join(dirPath, leafName); h.PathExists(leaf) {
+		return leaf
+	}
+	return dirPath
+}
+
+// enableControllers enables the controllers needed to set the resources r
+// in the children of the cgroup at dirPath, moving its processes (if any)
+// into a leaf sub-cgroup first.
+func enableControllers(h *cgroups.Host, dirPath string, r *configs.Resources) error {
+	data, err := h.ReadFile(dirPath, "cgroup.subtree_control")
+	if err != nil {
+		return err
+	}
+	enabled := make(map[string]struct{})
+	for _, c := range strings.Fields(data) {
+		enabled[c] = struct{}{}
+	}
+	var ctrs []string
+	for _, c := range cgroups.NeededControllers(r) {
+		if _, ok := enabled[c]; !ok {
+			enabled[c] = struct{}{}
+			ctrs = append(ctrs, c)
+		}
+	}
+	if len(ctrs) == 0 {
+		return nil
+	}
+	// The root cgroup is exempt from the "no internal processes" rule.
+	var moved []int
+	if !h.IsRoot(dirPath) {
+		moved, err = moveToLeaf(h, dirPath)
+		if err != nil {
+			return err
+		}
+	}
+	if err := h.WriteFile(dirPath, "cgroup.subtree_control", "+"+strings.Join(ctrs, " +")); err != nil {
+		// Do not leave the processes in the leaf for nothing.
+		if len(moved) > 0 {
+			if err := moveProcs(h, filepath.Join(dirPath, leafName), dirPath, moved); err != nil {
+				logrus.Warnf("unable to move processes back to %s: %v", dirPath, err)
+			}
+		}
+		return fmt.Errorf("unable to enable controllers for the children of %s: %w", dirPath, err)
+	}
+	return nil
+}
+
+// moveToLeaf moves the processes of the cgroup at dirPath into its
+// sub-cgroup called leafName, and returns the ones moved.
+func moveToLeaf(h *cgroups.Host, dirPath string) ([]int, error) {
+	pids, err := h.GetPids(dirPath)
+	if err != nil || len(pids) == 0 {
+		return nil, err
+	}
+	leaf := filepath.Join(dirPath, leafName)
+	if err := h.Mkdir(leaf); err != nil && !os.IsExist(err) {
+		return nil, err
+	}
+	if err := moveProcs(h, dirPath, leaf, pids); err != nil {
+		// Move back the ones moved so far.
+		if err := moveProcs(h, leaf, dirPath, pids); err != nil {
+			logrus.Warnf("unable to move processes back to %s: %v", dirPath, err)
+		}
+		return nil, err
+	}
+	return pids, nil
+}
+
+// moveProcs moves the processes pids from the cgroup at from to the one at to.
+func moveProcs(h *cgroups.Host, from, to string, pids []int) error {
+	for _, pid := range pids {
+		if err := h.WriteCgroupProc(to, pid); err != nil {
+			// The process has exited in the meantime.
+			if errors.Is(err, unix.ESRCH) {
+				continue
+			}
+			return fmt.Errorf("unable to move process from %s to %s: %w", from, to, err)
+		}
+	}
+	return nil
+}
+
+func (m *manager) NewChild(name string, r *configs.Resources) (_ cgroups.Manager, Err error) {
+	if err := cgroups.CheckChildName(name); err != nil {
+		return nil, err
+	}
+	if name == leafName {
+		return nil, fmt.Errorf("child cgroup name %q is reserved", name)
+	}
+	if r == nil {
+		r = &configs.Resources{SkipDevices: true}
+	} else if len(r.Devices) == 0 && !r.SkipDevices {
+		rr := *r
+		rr.SkipDevices = true
+		r = &rr
+	}
+	if err := enableControllers(m.host, m.dirPath, r); err != nil {
+		return nil, err
+	}
+	// The resources of the child are set to r by Set below.
+	child := &manager{
+		host:    m.host,
+		config:  &configs.Cgroup{Rootless: m.config.Rootless},
+		dirPath: filepath.Join(m.dirPath, name),
+	}
+	if err := m.host.Mkdir(child.dirPath); err != nil {
+		if !os.IsExist(err) {
+			return nil, err
+		}
+	} else {
+		// If the directory was created, be sure it is not left around on errors.
+		defer func() {
+			if Err != nil {
+				_ = m.host.RemovePath(child.dirPath)
+			}
+		}()
+	}
+	if err := child.Set(r); err != nil {
+		return nil, err
+	}
+	return child, nil
+}
@@ -0,0 +1,160 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestNewChild(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	childDir := filepath.Join(fakeCgroupDir, "child")
+	if err := os.Mkdir(childDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range []struct{ dir, file, data string }{
+		{fakeCgroupDir, "cgroup.controllers", "cpu memory pids\n"},
+		{fakeCgroupDir, "cgroup.subtree_control", "memory\n"},
+		{fakeCgroupDir, "cgroup.procs", "1234\n"},
+		{childDir, "cgroup.controllers", "memory pids\n"},
+	} {
+		if err := os.WriteFile(filepath.Join(f.dir, f.file), []byte(f.data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &manager{config: &configs.Cgroup{}, dirPath: fakeCgroupDir}
+	if _, err := m.NewChild("../child", nil); err == nil {
+		t.Fatal("expected an error for an invalid name")
+	}
+	// With no device rules, the devices are left alone.
+	r := &configs.Resources{
+		Memory:    1073741824,
+		PidsLimit: 10,
+	}
+	child, err := m.NewChild("child", r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path := child.Path(""); path != childDir {
+		t.Errorf("expected child path %s, got %s", childDir, path)
+	}
+
+	for _, f := range []struct{ dir, file, expected string }{
+		// The processes are moved to a leaf before enabling the controllers.
+		{filepath.Join(fakeCgroupDir, leafName), "cgroup.procs", "1234"},
+		// Only the controllers not yet enabled are written.
+		{fakeCgroupDir, "cgroup.subtree_control", "+pids"},
+		{childDir, "pids.max", "10"},
+		{childDir, "memory.max", "1073741824"},
+	} {
+		data, err := os.ReadFile(filepath.Join(f.dir, f.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != f.expected {
+			t.Errorf("expected %s to be %q, got %q", f.file, f.expected, data)
+		}
+	}
+}
+
+func TestApplyLeaf(t *testing.T) {
+	root := t.TempDir()
+	h, err := cgroups.NewDirHost(root, cgroups.Unified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "parent")
+	if err := os.MkdirAll(filepath.Join(dir, leafName), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Processes added to a cgroup with a leaf go to the leaf.
+	m := &manager{host: h, config: &configs.Cgroup{}, dirPath: dir}
+	if err := m.Apply(5678); err != nil {
+		t.Fatal(err)
+	}
+	pids, err := h.GetPids(filepath.Join(dir, leafName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pids) != 1 || pids[0] != 5678 {
+		t.Errorf("expected process 5678 to be added to the leaf, got %v", pids)
+	}
+}
+
+// failWrites is a cgroups.Backend failing the writes to file,
+// and recording the paths of the other ones.
+type failWrites struct {
+	cgroups.Backend
+	file    string
+	written []string
+}
+
+func (b *failWrites) OpenFile(path string, flags int) (*os.File, error) {
+	if flags&(os.O_WRONLY|os.O_RDWR) != 0 {
+		if filepath.Base(path) == b.file {
+			return nil, &os.PathError{Op: "open", Path: path, Err: unix.EBUSY}
+		}
+		b.written = append(b.written, path)
+	}
+	return b.Backend.OpenFile(path, flags)
+}
+
+func TestNewChildMoveBack(t *testing.T) {
+	root := t.TempDir()
+	h, err := cgroups.NewDirHost(root, cgroups.Unified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := &failWrites{Backend: h.Backend, file: "cgroup.subtree_control"}
+	h.Backend = b
+	dir := filepath.Join(root, "parent")
+	if err := os.Mkdir(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for file, data := range map[string]string{
+		"cgroup.controllers":     "pids\n",
+		"cgroup.subtree_control": "",
+		"cgroup.procs":           "1234\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &manager{host: h, config: &configs.Cgroup{}, dirPath: dir}
+	if _, err := m.NewChild("child", &configs.Resources{PidsLimit: 10}); err == nil {
+		t.Fatal("expected NewChild to fail")
+	}
+	// The processes are moved back from the leaf.
+	expected := []string{
+		filepath.Join(dir, leafName, "cgroup.procs"),
+		filepath.Join(dir, "cgroup.procs"),
+	}
+	if !reflect.DeepEqual(b.written, expected) {
+		t.Errorf("expected writes to %v, got %v", expected, b.written)
+	}
+}
+
+func TestNewChildLeafName(t *testing.T) {
+	// "leaf" is only reserved on cgroup v2.
+	if err := cgroups.CheckChildName(leafName); err != nil {
+		t.Fatal(err)
+	}
+	m := &manager{config: &configs.Cgroup{}, dirPath: t.TempDir()}
+	if _, err := m.NewChild(leafName, nil); err == nil {
+		t.Fatal("expected an error for the leaf name")
+	}
+}
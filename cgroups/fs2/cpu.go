@@ -2,8 +2,13 @@ package fs2
 
 import (
 	"bufio"
+	"errors"
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
 
 	"github.com/dims/libcontainer/cgroups"
 	"github.com/dims/libcontainer/cgroups/fscommon"
@@ -11,21 +16,45 @@ import (
 )
 
 func isCpuSet(r *configs.Resources) bool {
-	return r.CpuWeight != 0 || r.CpuQuota != 0 || r.CpuPeriod != 0
+	return cgroups.IsControllerSet("cpu", r)
 }
 
-func setCpu(dirPath string, r *configs.Resources) error {
+func setCpu(w cgroups.FileWriter, dirPath string, r *configs.Resources) error {
 	if !isCpuSet(r) {
 		return nil
 	}
 
+	// cpu.idle (since kernel 5.15)
+	if r.CpuIdle != nil {
+		if err := w.WriteFile(dirPath, "cpu.idle", strconv.FormatInt(*r.CpuIdle, 10)); err != nil {
+			return err
+		}
+	}
+
 	// NOTE: .CpuShares is not used here. Conversion is the caller's responsibility.
-	if r.CpuWeight != 0 {
-		if err := cgroups.WriteFile(dirPath, "cpu.weight", strconv.FormatUint(r.CpuWeight, 10)); err != nil {
+	// The weight of an idle cgroup can not be set.
+	if r.CpuWeight != 0 && (r.CpuIdle == nil || *r.CpuIdle == 0) {
+		if err := w.WriteFile(dirPath, "cpu.weight", strconv.FormatUint(r.CpuWeight, 10)); err != nil {
 			return err
 		}
 	}
 
+	// cpu.max.burst (since kernel 5.14)
+	var burst string
+	if r.CpuBurst != nil {
+		burst = strconv.FormatUint(*r.CpuBurst, 10)
+		if err := w.WriteFile(dirPath, "cpu.max.burst", burst); err != nil {
+			// The kernel rejects (EINVAL) a burst larger than the
+			// current quota. If the quota is going to be set, ignore
+			// the error for now and retry after setting the quota.
+			if !errors.Is(err, unix.EINVAL) || (r.CpuQuota == 0 && r.CpuPeriod == 0) {
+				return err
+			}
+		} else {
+			burst = ""
+		}
+	}
+
 	if r.CpuQuota != 0 || r.CpuPeriod != 0 {
 		str := "max"
 		if r.CpuQuota > 0 {
@@ -38,17 +67,65 @@ func setCpu(dirPath string, r *configs.Resources) error {
 			period = 100000
 		}
 		str += " " + strconv.FormatUint(period, 10)
-		if err := cgroups.WriteFile(dirPath, "cpu.max", str); err != nil {
+		if err := w.WriteFile(dirPath, "cpu.max", str); err != nil {
 			return err
 		}
+		if burst != "" {
+			if err := w.WriteFile(dirPath, "cpu.max.burst", burst); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func statCpu(dirPath string, stats *cgroups.Stats) error {
+// getCpu is the reverse of setCpu. Files which do not exist
+// (e.g. in the root cgroup, or on older kernels) are skipped.
+func getCpu(h *cgroups.Host, dirPath string, r *configs.Resources) error {
+	if str, err := fscommon.GetCgroupParamStringFrom(h, dirPath, "cpu.max"); err == nil {
+		parts := strings.Fields(str)
+		if len(parts) != 2 {
+			return &parseError{Path: dirPath, File: "cpu.max", Err: fmt.Errorf("unexpected content %q", str)}
+		}
+		r.CpuQuota = -1
+		if parts[0] != "max" {
+			if r.CpuQuota, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+				return &parseError{Path: dirPath, File: "cpu.max", Err: err}
+			}
+		}
+		if r.CpuPeriod, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+			return &parseError{Path: dirPath, File: "cpu.max", Err: err}
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	var err error
+	if r.CpuWeight, err = fscommon.GetCgroupParamUintFrom(h, dirPath, "cpu.weight"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// cpu.idle (since kernel 5.15)
+	if idle, err := fscommon.GetCgroupParamIntFrom(h, dirPath, "cpu.idle"); err == nil {
+		r.CpuIdle = &idle
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	// cpu.max.burst (since kernel 5.14)
+	if burst, err := fscommon.GetCgroupParamUintFrom(h, dirPath, "cpu.max.burst"); err == nil {
+		r.CpuBurst = &burst
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func statCpu(h *cgroups.Host, dirPath string, stats *cgroups.Stats) error {
 	const file = "cpu.stat"
-	f, err := cgroups.OpenFile(dirPath, file, os.O_RDONLY)
+	f, err := h.OpenFile(dirPath, file, os.O_RDONLY)
 	if err != nil {
 		return err
 	}
@@ -78,6 +155,12 @@ func statCpu(dirPath string, stats *cgroups.Stats) error {
 
 		case "throttled_usec":
 			stats.CpuStats.ThrottlingData.ThrottledTime = v * 1000
+
+		case "nr_bursts":
+			stats.CpuStats.ThrottlingData.BurstsPeriods = v
+
+		case "burst_usec":
+			stats.CpuStats.ThrottlingData.BurstTime = v * 1000
 		}
 	}
 	if err := sc.Err(); err != nil {
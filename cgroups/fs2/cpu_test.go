@@ -0,0 +1,79 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestSetCpuIdleAndBurst(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	idle := int64(1)
+	burst := uint64(5000)
+	r := &configs.Resources{
+		CpuWeight: 100,
+		CpuQuota:  10000,
+		CpuIdle:   &idle,
+		CpuBurst:  &burst,
+	}
+	if err := setCpu(cgroups.Cgroupfs, fakeCgroupDir, r); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		"cpu.idle":      "1",
+		"cpu.max":       "10000 100000",
+		"cpu.max.burst": "5000",
+	} {
+		data, err := os.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to contain %q, got %q", file, expected, data)
+		}
+	}
+	// The weight of an idle cgroup is not set.
+	if _, err := os.Stat(filepath.Join(fakeCgroupDir, "cpu.weight")); !os.IsNotExist(err) {
+		t.Errorf("expected cpu.weight not to be written, got %v", err)
+	}
+}
+
+func TestStatCpuBurst(t *testing.T) {
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	const cpuStat = `usage_usec 100
+user_usec 60
+system_usec 40
+nr_periods 10
+nr_throttled 2
+throttled_usec 30
+nr_bursts 3
+burst_usec 7
+`
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "cpu.stat"), []byte(cpuStat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	st := cgroups.NewStats()
+	if err := statCpu(nil, fakeCgroupDir, st); err != nil {
+		t.Fatal(err)
+	}
+	expected := cgroups.ThrottlingData{
+		Periods:          10,
+		ThrottledPeriods: 2,
+		ThrottledTime:    30000,
+		BurstsPeriods:    3,
+		BurstTime:        7000,
+	}
+	if st.CpuStats.ThrottlingData != expected {
+		t.Errorf("expected %+v, got %+v", expected, st.CpuStats.ThrottlingData)
+	}
+}
@@ -1,28 +1,133 @@
 package fs2
 
 import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/cgroups/fscommon"
 	"github.com/dims/libcontainer/configs"
 )
 
+// PartitionError is returned when the kernel accepts the cpuset partition
+// type written to cpuset.cpus.partition, but reports the partition as
+// invalid, e.g. as the CPUs of the cgroup are not exclusive to it.
+type PartitionError struct {
+	Path string
+	// Partition is the partition type, "root" or "isolated".
+	Partition string
+	// Reason is the reason given by the kernel (since kernel 6.1).
+	Reason string
+}
+
+func (e *PartitionError) Error() string {
+	msg := fmt.Sprintf("cpuset partition %s of cgroup %s is invalid", e.Partition, e.Path)
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
 func isCpusetSet(r *configs.Resources) bool {
-	return r.CpusetCpus != "" || r.CpusetMems != ""
+	return cgroups.IsControllerSet("cpuset", r)
 }
 
-func setCpuset(dirPath string, r *configs.Resources) error {
+func setCpuset(w cgroups.FileWriter, dirPath string, r *configs.Resources) error {
 	if !isCpusetSet(r) {
 		return nil
 	}
 
 	if r.CpusetCpus != "" {
-		if err := cgroups.WriteFile(dirPath, "cpuset.cpus", r.CpusetCpus); err != nil {
+		if err := w.WriteFile(dirPath, "cpuset.cpus", r.CpusetCpus); err != nil {
 			return err
 		}
 	}
 	if r.CpusetMems != "" {
-		if err := cgroups.WriteFile(dirPath, "cpuset.mems", r.CpusetMems); err != nil {
+		if err := w.WriteFile(dirPath, "cpuset.mems", r.CpusetMems); err != nil {
+			return err
+		}
+	}
+	if r.CpusetPartition != "" {
+		if err := setPartition(w, dirPath, r.CpusetPartition); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// setPartition sets the cpuset partition type of the cgroup at dirPath,
+// returning a *PartitionError if the resulting partition is invalid.
+func setPartition(w cgroups.FileWriter, dirPath, partition string) error {
+	switch partition {
+	case "member", "root", "isolated":
+	default:
+		return fmt.Errorf("invalid cpuset partition type %q (valid types are member, root and isolated)", partition)
+	}
+	if err := w.WriteFile(dirPath, "cpuset.cpus.partition", partition); err != nil {
+		return err
+	}
+	if !cgroups.MakesChanges(w) {
+		return nil
+	}
+	data, err := w.ReadFile(dirPath, "cpuset.cpus.partition")
+	if err != nil {
+		return err
+	}
+	if _, valid, reason := parsePartition(data); !valid {
+		return &PartitionError{Path: dirPath, Partition: partition, Reason: reason}
+	}
+	return nil
+}
+
+// parsePartition parses the content of cpuset.cpus.partition, such as
+// "root" or "isolated invalid (Cpu list in cpuset.cpus not exclusive)".
+func parsePartition(data string) (partition string, valid bool, reason string) {
+	partition, state, _ := strings.Cut(strings.TrimSpace(data), " ")
+	if !strings.HasPrefix(state, "invalid") {
+		return partition, true, ""
+	}
+	reason = strings.TrimSpace(strings.TrimPrefix(state, "invalid"))
+	reason = strings.TrimSuffix(strings.TrimPrefix(reason, "("), ")")
+	return partition, false, reason
+}
+
+// getCpuset is the reverse of setCpuset.
+func getCpuset(h *cgroups.Host, dirPath string, r *configs.Resources) error {
+	var err error
+	if r.CpusetCpus, err = fscommon.GetCgroupParamStringFrom(h, dirPath, "cpuset.cpus"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if r.CpusetMems, err = fscommon.GetCgroupParamStringFrom(h, dirPath, "cpuset.mems"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// The root cgroup has no cpuset.cpus.partition.
+	data, err := h.ReadFile(dirPath, "cpuset.cpus.partition")
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	r.CpusetPartition, _, _ = parsePartition(data)
+	return nil
+}
+
+// statCpuset fills in the cpuset statistics with the CPUs and memory
+// nodes the cgroup is actually allowed to use, which are the ones set
+// in cpuset.cpus and cpuset.mems limited by the ones of the ancestors.
+func statCpuset(h *cgroups.Host, dirPath string, stats *cgroups.Stats) error {
+	var err error
+	stats.CPUSetStats.CPUs, err = fscommon.GetCgroupParamListFrom(h, dirPath, "cpuset.cpus.effective")
+	if err != nil {
+		return err
+	}
+	stats.CPUSetStats.Mems, err = fscommon.GetCgroupParamListFrom(h, dirPath, "cpuset.mems.effective")
+	if err != nil {
+		return err
+	}
+	data, err := fscommon.GetCgroupParamStringFrom(h, dirPath, "cpuset.cpus.partition")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	stats.CPUSetStats.Partition = data
+	return nil
+}
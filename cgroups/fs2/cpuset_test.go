@@ -0,0 +1,125 @@
+package fs2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestParsePartition(t *testing.T) {
+	for _, tc := range []struct {
+		data, partition, reason string
+		valid                   bool
+	}{
+		{data: "member\n", partition: "member", valid: true},
+		{data: "isolated\n", partition: "isolated", valid: true},
+		{data: "root invalid\n", partition: "root"},
+		{
+			data:      "isolated invalid (Cpu list in cpuset.cpus not exclusive)\n",
+			partition: "isolated",
+			reason:    "Cpu list in cpuset.cpus not exclusive",
+		},
+	} {
+		partition, valid, reason := parsePartition(tc.data)
+		if partition != tc.partition || valid != tc.valid || reason != tc.reason {
+			t.Errorf("%q: expected %q, %v, %q; got %q, %v, %q", tc.data, tc.partition, tc.valid, tc.reason, partition, valid, reason)
+		}
+	}
+}
+
+func TestSetCpusetPartition(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	r := &configs.Resources{
+		CpusetCpus:      "2-3",
+		CpusetPartition: "isolated",
+	}
+	if err := setCpuset(cgroups.Cgroupfs, fakeCgroupDir, r); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(fakeCgroupDir, "cpuset.cpus.partition"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "isolated" {
+		t.Errorf("expected cpuset.cpus.partition to be %q, got %q", "isolated", data)
+	}
+
+	r.CpusetPartition = "exclusive"
+	if err := setCpuset(cgroups.Cgroupfs, fakeCgroupDir, r); err == nil {
+		t.Error("expected error for invalid partition type, got nil")
+	}
+}
+
+// invalidPartition is a cgroups.FileWriter reading back the
+// partitions written as invalid.
+type invalidPartition struct {
+	cgroups.FileWriter
+}
+
+func (w invalidPartition) ReadFile(dir, file string) (string, error) {
+	data, err := w.FileWriter.ReadFile(dir, file)
+	if err == nil && file == "cpuset.cpus.partition" {
+		data += " invalid (Cpu list in cpuset.cpus not exclusive)\n"
+	}
+	return data, err
+}
+
+func TestSetCpusetPartitionInvalid(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	err := setPartition(invalidPartition{cgroups.Cgroupfs}, fakeCgroupDir, "root")
+	var perr *PartitionError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected a *PartitionError, got %v", err)
+	}
+	if perr.Partition != "root" || perr.Reason != "Cpu list in cpuset.cpus not exclusive" {
+		t.Errorf("unexpected error %+v", perr)
+	}
+}
+
+func TestStatCpuset(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	for file, data := range map[string]string{
+		"cpuset.cpus.effective": "0-2,5\n",
+		"cpuset.mems.effective": "1\n",
+		"cpuset.cpus.partition": "root invalid (Parent is not a partition root)\n",
+	} {
+		if err := os.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := cgroups.NewStats()
+	if err := statCpuset(nil, fakeCgroupDir, stats); err != nil {
+		t.Fatal(err)
+	}
+	expected := cgroups.CPUSetStats{
+		CPUs:      []uint16{0, 1, 2, 5},
+		Mems:      []uint16{1},
+		Partition: "root invalid (Parent is not a partition root)",
+	}
+	if !reflect.DeepEqual(stats.CPUSetStats, expected) {
+		t.Errorf("expected %+v, got %+v", expected, stats.CPUSetStats)
+	}
+
+	r := &configs.Resources{}
+	if err := getCpuset(nil, fakeCgroupDir, r); err != nil {
+		t.Fatal(err)
+	}
+	if r.CpusetPartition != "root" {
+		t.Errorf("expected partition type root, got %q", r.CpusetPartition)
+	}
+}
@@ -10,21 +10,21 @@ import (
 	"github.com/dims/libcontainer/configs"
 )
 
-func supportedControllers() (string, error) {
-	return cgroups.ReadFile(UnifiedMountpoint, "/cgroup.controllers")
+func supportedControllers(h *cgroups.Host) (string, error) {
+	return h.ReadFile(h.Root, "/cgroup.controllers")
 }
 
 // needAnyControllers returns whether we enable some supported controllers or not,
 // based on (1) controllers available and (2) resources that are being set.
 // We don't check "pseudo" controllers such as
 // "freezer" and "devices".
-func needAnyControllers(r *configs.Resources) (bool, error) {
+func needAnyControllers(h *cgroups.Host, r *configs.Resources) (bool, error) {
 	if r == nil {
 		return false, nil
 	}
 
 	// list of all available controllers
-	content, err := supportedControllers()
+	content, err := supportedControllers(h)
 	if err != nil {
 		return false, err
 	}
@@ -69,12 +69,28 @@ func containsDomainController(r *configs.Resources) bool {
 }
 
 // CreateCgroupPath creates cgroupv2 path, enabling all the supported controllers.
-func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
-	if !strings.HasPrefix(path, UnifiedMountpoint) {
+func CreateCgroupPath(path string, c *configs.Cgroup) error {
+	h := cgroups.DefaultHost()
+	return createCgroupPath(h, h, path, c)
+}
+
+// PlanCreateCgroupPath adds the operations CreateCgroupPath would perform to p.
+func PlanCreateCgroupPath(p *cgroups.Plan, path string, c *configs.Cgroup) error {
+	h := p.Host
+	if h == nil {
+		h = cgroups.DefaultHost()
+	}
+	return createCgroupPath(h, p, path, c)
+}
+
+// createCgroupPath creates the cgroup v2 path of the host h, using w.
+func createCgroupPath(h *cgroups.Host, w cgroups.FileWriter, path string, c *configs.Cgroup) (Err error) {
+	root := h.Root
+	if !strings.HasPrefix(path, root) {
 		return fmt.Errorf("invalid cgroup path %s", path)
 	}
 
-	content, err := supportedControllers()
+	content, err := supportedControllers(h)
 	if err != nil {
 		return err
 	}
@@ -86,13 +102,29 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 	ctrs := strings.Fields(content)
 	res := "+" + strings.Join(ctrs, " +")
 
-	elements := strings.Split(path, "/")
-	elements = elements[3:]
-	current := "/sys/fs"
+	// The parent of a threaded cgroup can only have the threaded
+	// controllers enabled for its children (the root is exempt).
+	parent := filepath.Dir(path)
+	var parentRes string
+	if c.Threaded {
+		threaded := threadedControllers(ctrs)
+		if h.IsRoot(parent) {
+			threaded = nil
+		}
+		if err := validateThreaded(h, path, c.Resources, threaded); err != nil {
+			return err
+		}
+		if len(threaded) > 0 {
+			parentRes = "+" + strings.Join(threaded, " +")
+		}
+	}
+
+	elements := strings.Split(strings.TrimPrefix(path, root), "/")
+	current := root
 	for i, e := range elements {
 		current = filepath.Join(current, e)
 		if i > 0 {
-			if err := os.Mkdir(current, 0o755); err != nil {
+			if err := w.Mkdir(current); err != nil {
 				if !os.IsExist(err) {
 					return err
 				}
@@ -101,11 +133,11 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 				current := current
 				defer func() {
 					if Err != nil {
-						os.Remove(current)
+						_ = h.RemovePath(current)
 					}
 				}()
 			}
-			cgType, _ := cgroups.ReadFile(current, cgTypeFile)
+			cgType, _ := w.ReadFile(current, cgTypeFile)
 			cgType = strings.TrimSpace(cgType)
 			switch cgType {
 			// If the cgroup is in an invalid mode (usually this means there's an internal
@@ -122,7 +154,7 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 					// since that means we're a properly delegated cgroup subtree) but in
 					// this case there's not much we can do and it's better than giving an
 					// error.
-					_ = cgroups.WriteFile(current, cgTypeFile, "threaded")
+					_ = w.WriteFile(current, cgTypeFile, "threaded")
 				}
 			// If the cgroup is in (threaded) or (domain threaded) mode, we can only use thread-aware controllers
 			// (and you cannot usually take a cgroup out of threaded mode).
@@ -134,13 +166,25 @@ func CreateCgroupPath(path string, c *configs.Cgroup) (Err error) {
 				}
 			}
 		}
+		if c.Threaded && i == len(elements)-1 {
+			if err := makeThreaded(w, current); err != nil {
+				return err
+			}
+		}
 		// enable all supported controllers
 		if i < len(elements)-1 {
-			if err := cgroups.WriteFile(current, cgStCtlFile, res); err != nil {
+			res := res
+			if c.Threaded && current == parent && !h.IsRoot(parent) {
+				if parentRes == "" {
+					continue
+				}
+				res = parentRes
+			}
+			if err := w.WriteFile(current, cgStCtlFile, res); err != nil {
 				// try write one by one
 				allCtrs := strings.Split(res, " ")
 				for _, ctr := range allCtrs {
-					_ = cgroups.WriteFile(current, cgStCtlFile, ctr)
+					_ = w.WriteFile(current, cgStCtlFile, ctr)
 				}
 			}
 			// Some controllers might not be enabled when rootless or containerized,
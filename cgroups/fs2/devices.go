@@ -5,6 +5,7 @@ import (
 
 	"golang.org/x/sys/unix"
 
+	"github.com/dims/libcontainer/cgroups"
 	"github.com/dims/libcontainer/cgroups/ebpf"
 	"github.com/dims/libcontainer/cgroups/ebpf/devicefilter"
 	"github.com/dims/libcontainer/configs"
@@ -53,7 +54,7 @@ func canSkipEBPFError(r *configs.Resources) bool {
 	return true
 }
 
-func setDevices(dirPath string, r *configs.Resources) error {
+func setDevices(w cgroups.FileWriter, dirPath string, r *configs.Resources) error {
 	if r.SkipDevices {
 		return nil
 	}
@@ -61,6 +62,10 @@ func setDevices(dirPath string, r *configs.Resources) error {
 	if err != nil {
 		return err
 	}
+	if p, ok := w.(*cgroups.Plan); ok {
+		p.Add(cgroups.Op{Type: cgroups.OpAttachDeviceFilter, Path: dirPath, Value: insts.String()})
+		return nil
+	}
 	dirFD, err := unix.Open(dirPath, unix.O_DIRECTORY|unix.O_RDONLY, 0o600)
 	if err != nil {
 		return fmt.Errorf("cannot get dir FD for %s", dirPath)
@@ -1,20 +1,20 @@
 package fs2
 
 import (
-	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"golang.org/x/sys/unix"
 
 	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/cgroups/fscommon"
 	"github.com/dims/libcontainer/configs"
 )
 
-func setFreezer(dirPath string, state configs.FreezerState) error {
+func setFreezer(w cgroups.FileWriter, dirPath string, state configs.FreezerState) error {
 	var stateStr string
 	switch state {
 	case configs.Undefined:
@@ -27,7 +27,19 @@ func setFreezer(dirPath string, state configs.FreezerState) error {
 		return fmt.Errorf("invalid freezer state %q requested", state)
 	}
 
-	fd, err := cgroups.OpenFile(dirPath, "cgroup.freeze", unix.O_RDWR)
+	if !cgroups.MakesChanges(w) {
+		// The state change can not be confirmed without making it.
+		if err := w.WriteFile(dirPath, "cgroup.freeze", stateStr); err != nil {
+			if state != configs.Frozen {
+				return nil
+			}
+			return fmt.Errorf("freezer not supported: %w", err)
+		}
+		return nil
+	}
+
+	h := cgroups.FileWriterHost(w)
+	fd, err := h.OpenFile(dirPath, "cgroup.freeze", unix.O_RDWR)
 	if err != nil {
 		// We can ignore this request as long as the user didn't ask us to
 		// freeze the container (since without the freezer cgroup, that's a
@@ -43,7 +55,7 @@ func setFreezer(dirPath string, state configs.FreezerState) error {
 		return err
 	}
 	// Confirm that the cgroup did actually change states.
-	if actualState, err := readFreezer(dirPath, fd); err != nil {
+	if actualState, err := readFreezer(h, dirPath, fd); err != nil {
 		return err
 	} else if actualState != state {
 		return fmt.Errorf(`expected "cgroup.freeze" to be in state %q but was in %q`, state, actualState)
@@ -51,8 +63,8 @@ func setFreezer(dirPath string, state configs.FreezerState) error {
 	return nil
 }
 
-func getFreezer(dirPath string) (configs.FreezerState, error) {
-	fd, err := cgroups.OpenFile(dirPath, "cgroup.freeze", unix.O_RDONLY)
+func getFreezer(h *cgroups.Host, dirPath string) (configs.FreezerState, error) {
+	fd, err := h.OpenFile(dirPath, "cgroup.freeze", unix.O_RDONLY)
 	if err != nil {
 		// If the kernel is too old, then we just treat the freezer as being in
 		// an "undefined" state.
@@ -63,10 +75,10 @@ func getFreezer(dirPath string) (configs.FreezerState, error) {
 	}
 	defer fd.Close()
 
-	return readFreezer(dirPath, fd)
+	return readFreezer(h, dirPath, fd)
 }
 
-func readFreezer(dirPath string, fd *os.File) (configs.FreezerState, error) {
+func readFreezer(h *cgroups.Host, dirPath string, fd *os.File) (configs.FreezerState, error) {
 	if _, err := fd.Seek(0, 0); err != nil {
 		return configs.Undefined, err
 	}
@@ -78,50 +90,38 @@ func readFreezer(dirPath string, fd *os.File) (configs.FreezerState, error) {
 	case "0\n":
 		return configs.Thawed, nil
 	case "1\n":
-		return waitFrozen(dirPath)
+		return waitFrozen(h, dirPath)
 	default:
 		return configs.Undefined, fmt.Errorf(`unknown "cgroup.freeze" state: %q`, state)
 	}
 }
 
-// waitFrozen polls cgroup.events until it sees "frozen 1" in it.
-func waitFrozen(dirPath string) (configs.FreezerState, error) {
-	fd, err := cgroups.OpenFile(dirPath, "cgroup.events", unix.O_RDONLY)
+// waitFrozen waits until cgroup.events reports "frozen 1".
+func waitFrozen(h *cgroups.Host, dirPath string) (configs.FreezerState, error) {
+	const timeout = 10 * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	events, err := h.WatchEvents(ctx, dirPath, cgroups.EventFrozen)
 	if err != nil {
 		return configs.Undefined, err
 	}
-	defer fd.Close()
-
-	// XXX: Simple wait/read/retry is used here. An implementation
-	// based on poll(2) or inotify(7) is possible, but it makes the code
-	// much more complicated. Maybe address this later.
-	const (
-		// Perform maxIter with waitTime in between iterations.
-		waitTime = 10 * time.Millisecond
-		maxIter  = 1000
-	)
-	scanner := bufio.NewScanner(fd)
-	for i := 0; scanner.Scan(); {
-		if i == maxIter {
-			return configs.Undefined, fmt.Errorf("timeout of %s reached waiting for the cgroup to freeze", waitTime*maxIter)
-		}
-		line := scanner.Text()
-		val := strings.TrimPrefix(line, "frozen ")
-		if val != line { // got prefix
-			if val[0] == '1' {
-				return configs.Frozen, nil
-			}
-
-			i++
-			// wait, then re-read
-			time.Sleep(waitTime)
-			_, err := fd.Seek(0, 0)
-			if err != nil {
-				return configs.Undefined, err
-			}
+	// Check the current state after setting up the watch,
+	// so that a change in between can not be missed.
+	frozen, err := fscommon.GetValueByKeyFrom(h, dirPath, "cgroup.events", "frozen")
+	if err != nil {
+		return configs.Undefined, err
+	}
+	if frozen == 1 {
+		return configs.Frozen, nil
+	}
+	for ev := range events {
+		if ev.Value == 1 {
+			return configs.Frozen, nil
 		}
 	}
-	// Should only reach here either on read error,
-	// or if the file does not contain "frozen " line.
-	return configs.Undefined, scanner.Err()
+	if ctx.Err() != nil {
+		return configs.Undefined, fmt.Errorf("timeout of %s reached waiting for the cgroup to freeze", timeout)
+	}
+	return configs.Undefined, errors.New("cgroup removed while waiting for it to freeze")
 }
@@ -0,0 +1,34 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestWaitFrozen(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	eventsPath := filepath.Join(fakeCgroupDir, "cgroup.events")
+	if err := os.WriteFile(eventsPath, []byte("populated 1\nfrozen 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = os.WriteFile(eventsPath, []byte("populated 1\nfrozen 1\n"), 0o644)
+	}()
+
+	state, err := waitFrozen(nil, fakeCgroupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != configs.Frozen {
+		t.Fatalf("expected state %q, got %q", configs.Frozen, state)
+	}
+}
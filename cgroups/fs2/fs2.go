@@ -1,11 +1,16 @@
 package fs2
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
+
 	"github.com/dims/libcontainer/cgroups"
 	"github.com/dims/libcontainer/cgroups/fscommon"
 	"github.com/dims/libcontainer/configs"
@@ -14,29 +19,50 @@ import (
 type parseError = fscommon.ParseError
 
 type manager struct {
+	// host is the cgroup filesystem the cgroup is on.
+	host   *cgroups.Host
 	config *configs.Cgroup
 	// dirPath is like "/sys/fs/cgroup/user.slice/user-1001.slice/session-1.scope"
 	dirPath string
 	// controllers is content of "cgroup.controllers" file.
 	// excludes pseudo-controllers ("devices" and "freezer").
 	controllers map[string]struct{}
+	// applied is a copy of the resources last successfully set,
+	// used to roll back a failed Set.
+	applied *configs.Resources
 }
 
 // NewManager creates a manager for cgroup v2 unified hierarchy.
 // dirPath is like "/sys/fs/cgroup/user.slice/user-1001.slice/session-1.scope".
 // If dirPath is empty, it is automatically set using config.
 func NewManager(config *configs.Cgroup, dirPath string) (cgroups.Manager, error) {
+	return newManager(cgroups.DefaultHost(), config, dirPath)
+}
+
+// NewHostManager is like NewManager, but for the cgroup v2 hierarchy of
+// the host h (see cgroups.Host). dirPath, if not empty, must be under
+// h.Root.
+func NewHostManager(h *cgroups.Host, config *configs.Cgroup, dirPath string) (cgroups.Manager, error) {
+	if h.Mode != cgroups.Unified {
+		return nil, fmt.Errorf("cgroup root %s is not in unified mode (%s)", h.Root, h.Mode)
+	}
+	return newManager(h, config, dirPath)
+}
+
+func newManager(h *cgroups.Host, config *configs.Cgroup, dirPath string) (cgroups.Manager, error) {
 	if dirPath == "" {
 		var err error
-		dirPath, err = defaultDirPath(config)
+		dirPath, err = defaultDirPath(h.Root, config)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	m := &manager{
+		host:    h,
 		config:  config,
 		dirPath: dirPath,
+		applied: config.Resources.Clone(),
 	}
 	return m, nil
 }
@@ -46,7 +72,7 @@ func (m *manager) getControllers() error {
 		return nil
 	}
 
-	data, err := cgroups.ReadFile(m.dirPath, "cgroup.controllers")
+	data, err := m.host.ReadFile(m.dirPath, "cgroup.controllers")
 	if err != nil {
 		if m.config.Rootless && m.config.Path == "" {
 			return nil
@@ -63,14 +89,26 @@ func (m *manager) getControllers() error {
 }
 
 func (m *manager) Apply(pid int) error {
-	if err := CreateCgroupPath(m.dirPath, m.config); err != nil {
+	return m.apply(m.host, pid)
+}
+
+func (m *manager) PlanApply(pid int) (*cgroups.Plan, error) {
+	p := &cgroups.Plan{Host: m.host}
+	if err := m.apply(p, pid); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (m *manager) apply(w cgroups.FileWriter, pid int) error {
+	if err := createCgroupPath(m.host, w, m.dirPath, m.config); err != nil {
 		// Related tests:
 		// - "runc create (no limits + no cgrouppath + no permission) succeeds"
 		// - "runc create (rootless + no limits + cgrouppath + no permission) fails with permission error"
 		// - "runc create (rootless + limits + no cgrouppath + no permission) fails with informative error"
 		if m.config.Rootless {
 			if m.config.Path == "" {
-				if blNeed, nErr := needAnyControllers(m.config.Resources); nErr == nil && !blNeed {
+				if blNeed, nErr := needAnyControllers(m.host, m.config.Resources); nErr == nil && !blNeed {
 					return nil
 				}
 				return fmt.Errorf("rootless needs no limits + no cgrouppath when no permission is granted for cgroups: %w", err)
@@ -78,48 +116,109 @@ func (m *manager) Apply(pid int) error {
 		}
 		return err
 	}
-	if err := cgroups.WriteCgroupProc(m.dirPath, pid); err != nil {
+	if err := cgroups.WriteCgroupProcTo(w, procsDir(m.host, m.dirPath), pid); err != nil {
 		return err
 	}
 	return nil
 }
 
 func (m *manager) GetPids() ([]int, error) {
-	return cgroups.GetPids(m.dirPath)
+	return m.host.GetPids(m.dirPath)
 }
 
 func (m *manager) GetAllPids() ([]int, error) {
-	return cgroups.GetAllPids(m.dirPath)
+	return m.host.GetAllPids(m.dirPath)
+}
+
+// OpenDir opens the cgroup directory with O_PATH (see cgroups.DirOpener).
+func (m *manager) OpenDir() (*os.File, error) {
+	return os.OpenFile(m.dirPath, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+}
+
+// GetThreads returns the thread IDs in the cgroup (see cgroups.ThreadManager).
+func (m *manager) GetThreads() ([]int, error) {
+	return m.host.GetThreads(m.dirPath)
+}
+
+// AddThread moves the thread tid into the cgroup (see cgroups.ThreadManager).
+func (m *manager) AddThread(tid int) error {
+	return m.host.WriteCgroupThread(m.dirPath, tid)
 }
 
 func (m *manager) GetStats() (*cgroups.Stats, error) {
+	return m.getStats(m.dirPath)
+}
+
+func (m *manager) GetStatsTree() (cgroups.StatsTree, error) {
+	paths, err := cgroups.GetSubCgroups(m.dirPath)
+	if err != nil {
+		return nil, err
+	}
+	tree := make(cgroups.StatsTree, len(paths))
+	for _, p := range paths {
+		dir := filepath.Join(m.dirPath, p)
+		st, err := m.getStats(dir)
+		if err != nil {
+			// The sub-cgroup was removed in the meantime.
+			if p != "." && !m.host.PathExists(dir) {
+				continue
+			}
+			return nil, err
+		}
+		tree[p] = st
+	}
+	return tree, nil
+}
+
+// getStats returns the statistics of the cgroup at dirPath,
+// which is either the manager's cgroup or a sub-cgroup of it.
+func (m *manager) getStats(dirPath string) (*cgroups.Stats, error) {
 	var errs []error
+	h := m.host
 
 	st := cgroups.NewStats()
 
 	// pids (since kernel 4.5)
-	if err := statPids(m.dirPath, st); err != nil {
+	if err := statPids(h, dirPath, st); err != nil {
 		errs = append(errs, err)
 	}
 	// memory (since kernel 4.5)
-	if err := statMemory(m.dirPath, st); err != nil && !os.IsNotExist(err) {
+	if err := statMemory(h, dirPath, st); err != nil && !os.IsNotExist(err) {
 		errs = append(errs, err)
 	}
 	// io (since kernel 4.5)
-	if err := statIo(m.dirPath, st); err != nil && !os.IsNotExist(err) {
+	if err := statIo(h, dirPath, st); err != nil && !os.IsNotExist(err) {
 		errs = append(errs, err)
 	}
 	// cpu (since kernel 4.15)
 	// Note cpu.stat is available even if the controller is not enabled.
-	if err := statCpu(m.dirPath, st); err != nil && !os.IsNotExist(err) {
+	if err := statCpu(h, dirPath, st); err != nil && !os.IsNotExist(err) {
 		errs = append(errs, err)
 	}
 	// hugetlb (since kernel 5.6)
-	if err := statHugeTlb(m.dirPath, st); err != nil && !os.IsNotExist(err) {
+	if err := statHugeTlb(h, dirPath, st); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	// cpuset (since kernel 5.0)
+	if err := statCpuset(h, dirPath, st); err != nil && !os.IsNotExist(err) {
 		errs = append(errs, err)
 	}
 	// rdma (since kernel 4.11)
-	if err := fscommon.RdmaGetStats(m.dirPath, st); err != nil && !os.IsNotExist(err) {
+	if err := fscommon.RdmaGetStatsFrom(h, dirPath, st); err != nil && !os.IsNotExist(err) {
+		errs = append(errs, err)
+	}
+	// PSI (since kernel 4.20; irq.pressure since kernel 6.1).
+	var err error
+	if st.CpuStats.PSI, err = statPSI(h, dirPath, "cpu.pressure"); err != nil {
+		errs = append(errs, err)
+	}
+	if st.CpuStats.IRQPSI, err = statPSI(h, dirPath, "irq.pressure"); err != nil {
+		errs = append(errs, err)
+	}
+	if st.MemoryStats.PSI, err = statPSI(h, dirPath, "memory.pressure"); err != nil {
+		errs = append(errs, err)
+	}
+	if st.BlkioStats.PSI, err = statPSI(h, dirPath, "io.pressure"); err != nil {
 		errs = append(errs, err)
 	}
 	if len(errs) > 0 && !m.config.Rootless {
@@ -132,7 +231,7 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 	if m.config.Resources == nil {
 		return errors.New("cannot toggle freezer: cgroups not configured for container")
 	}
-	if err := setFreezer(m.dirPath, state); err != nil {
+	if err := setFreezer(m.host, m.dirPath, state); err != nil {
 		return err
 	}
 	m.config.Resources.Freezer = state
@@ -140,34 +239,102 @@ func (m *manager) Freeze(state configs.FreezerState) error {
 }
 
 func (m *manager) Destroy() error {
-	return cgroups.RemovePath(m.dirPath)
+	return m.host.RemovePath(m.dirPath)
+}
+
+func (m *manager) Kill(sig unix.Signal) error {
+	if sig == unix.SIGKILL {
+		// cgroup.kill (since kernel 5.14) kills all processes
+		// in the cgroup and its sub-cgroups atomically.
+		err := m.host.WriteFile(m.dirPath, "cgroup.kill", "1")
+		if !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return cgroups.FreezeAndKill(m, sig)
 }
 
 func (m *manager) Path(_ string) string {
 	return m.dirPath
 }
 
-func (m *manager) Set(r *configs.Resources) error {
+// Set applies the resources r to the cgroup. If any of the settings
+// fails, the ones applied before it are rolled back.
+func (m *manager) Set(r *configs.Resources) (retErr error) {
 	if r == nil {
 		return nil
 	}
+	s, err := snapshot(m.host, m.dirPath, r, m.applied)
+	if err != nil {
+		return fmt.Errorf("unable to save cgroup state: %w", err)
+	}
+	defer func() {
+		if retErr != nil {
+			if err := s.Restore(); err != nil {
+				logrus.Warnf("unable to roll back cgroup %s after a failed update: %v", m.dirPath, err)
+			}
+		}
+	}()
+	return m.setResources(r)
+}
+
+// setResources is Set without the rollback on failure.
+func (m *manager) setResources(r *configs.Resources) error {
 	if err := m.getControllers(); err != nil {
 		return err
 	}
+	if err := m.set(m.host, r); err != nil {
+		return err
+	}
+	m.config.Resources = r
+	m.applied = r.Clone()
+	return nil
+}
+
+// SetWithoutRollback is like the Set method of m, a manager returned by
+// [NewManager], except that the cgroup is not rolled back on failure.
+// It is for the callers which take a [Snapshot] of their own.
+func SetWithoutRollback(m cgroups.Manager, r *configs.Resources) error {
+	fm, ok := m.(*manager)
+	if !ok {
+		return m.Set(r)
+	}
+	if r == nil {
+		return nil
+	}
+	return fm.setResources(r)
+}
+
+func (m *manager) PlanSet(r *configs.Resources) (*cgroups.Plan, error) {
+	p := &cgroups.Plan{Host: m.host}
+	if r == nil {
+		return p, nil
+	}
+	if err := m.getControllers(); err != nil {
+		return nil, err
+	}
+	if err := m.set(p, r); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// set applies the resources r to the cgroup using w.
+func (m *manager) set(w cgroups.FileWriter, r *configs.Resources) error {
 	// pids (since kernel 4.5)
-	if err := setPids(m.dirPath, r); err != nil {
+	if err := setPids(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// memory (since kernel 4.5)
-	if err := setMemory(m.dirPath, r); err != nil {
+	if err := setMemory(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// io (since kernel 4.5)
-	if err := setIo(m.dirPath, r); err != nil {
+	if err := setIo(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// cpu (since kernel 4.15)
-	if err := setCpu(m.dirPath, r); err != nil {
+	if err := setCpu(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// devices (since kernel 4.15, pseudo-controller)
@@ -175,38 +342,34 @@ func (m *manager) Set(r *configs.Resources) error {
 	// When rootless is true, errors from the device subsystem are ignored because it is really not expected to work.
 	// However, errors from other subsystems are not ignored.
 	// see @test "runc create (rootless + limits + no cgrouppath + no permission) fails with informative error"
-	if err := setDevices(m.dirPath, r); err != nil && !m.config.Rootless {
+	if err := setDevices(w, m.dirPath, r); err != nil && !m.config.Rootless {
 		return err
 	}
 	// cpuset (since kernel 5.0)
-	if err := setCpuset(m.dirPath, r); err != nil {
+	if err := setCpuset(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// hugetlb (since kernel 5.6)
-	if err := setHugeTlb(m.dirPath, r); err != nil {
+	if err := setHugeTlb(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// rdma (since kernel 4.11)
-	if err := fscommon.RdmaSet(m.dirPath, r); err != nil {
+	if err := fscommon.RdmaSetTo(w, m.dirPath, r); err != nil {
 		return err
 	}
 	// freezer (since kernel 5.2, pseudo-controller)
-	if err := setFreezer(m.dirPath, r.Freezer); err != nil {
+	if err := setFreezer(w, m.dirPath, r.Freezer); err != nil {
 		return err
 	}
-	if err := m.setUnified(r.Unified); err != nil {
-		return err
-	}
-	m.config.Resources = r
-	return nil
+	return m.setUnified(w, r.Unified)
 }
 
-func (m *manager) setUnified(res map[string]string) error {
+func (m *manager) setUnified(w cgroups.FileWriter, res map[string]string) error {
 	for k, v := range res {
 		if strings.Contains(k, "/") {
 			return fmt.Errorf("unified resource %q must be a file name (no slashes)", k)
 		}
-		if err := cgroups.WriteFile(m.dirPath, k, v); err != nil {
+		if err := w.WriteFile(m.dirPath, k, v); err != nil {
 			// Check for both EPERM and ENOENT since O_CREAT is used by WriteFile.
 			if errors.Is(err, os.ErrPermission) || errors.Is(err, os.ErrNotExist) {
 				// Check if a controller is available,
@@ -237,23 +400,52 @@ func (m *manager) GetCgroups() (*configs.Cgroup, error) {
 	return m.config, nil
 }
 
+func (m *manager) GetResources() (*configs.Resources, error) {
+	r := &configs.Resources{}
+	for _, get := range []func(*cgroups.Host, string, *configs.Resources) error{
+		getPids,
+		getMemory,
+		getIo,
+		getCpu,
+		getCpuset,
+		getHugeTlb,
+	} {
+		if err := get(m.host, m.dirPath, r); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
 func (m *manager) GetFreezerState() (configs.FreezerState, error) {
-	return getFreezer(m.dirPath)
+	return getFreezer(m.host, m.dirPath)
 }
 
 func (m *manager) Exists() bool {
-	return cgroups.PathExists(m.dirPath)
+	return m.host.PathExists(m.dirPath)
 }
 
 func OOMKillCount(path string) (uint64, error) {
-	return fscommon.GetValueByKey(path, "memory.events", "oom_kill")
+	return oomKillCount(nil, path)
+}
+
+func oomKillCount(h *cgroups.Host, path string) (uint64, error) {
+	return fscommon.GetValueByKeyFrom(h, path, "memory.events", "oom_kill")
 }
 
 func (m *manager) OOMKillCount() (uint64, error) {
-	c, err := OOMKillCount(m.dirPath)
+	c, err := oomKillCount(m.host, m.dirPath)
 	if err != nil && m.config.Rootless && os.IsNotExist(err) {
 		err = nil
 	}
 
 	return c, err
 }
+
+func (m *manager) NotifyOOM(ctx context.Context) (<-chan cgroups.OOMEvent, error) {
+	return notifyOOM(ctx, m.host, m.dirPath)
+}
+
+func (m *manager) Reclaim(bytes uint64, swappiness *int) (uint64, error) {
+	return reclaim(m.host, m.dirPath, bytes, swappiness)
+}
@@ -0,0 +1,263 @@
+package fs2
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestGetResources(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	for file, data := range map[string]string{
+		"memory.max":       "1073741824\n",
+		"memory.low":       "0\n",
+		"memory.high":      "max\n",
+		"memory.min":       "268435456\n",
+		"memory.swap.max":  "536870912\n",
+		"memory.oom.group": "1\n",
+		"cpu.max":          "max 100000\n",
+		"cpu.weight":       "100\n",
+		"cpu.max.burst":    "0\n",
+		"cpuset.cpus":      "0-3\n",
+		"cpuset.mems":      "0\n",
+		"pids.max":         "max\n",
+		"io.max":           "8:16 rbps=2097152 wbps=max riops=max wiops=120\n",
+	} {
+		if err := os.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &manager{config: &configs.Cgroup{}, dirPath: fakeCgroupDir}
+	r, err := m.GetResources()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oomGroup := true
+	burst := uint64(0)
+	expected := &configs.Resources{
+		Memory:                       1073741824,
+		MemorySwap:                   1073741824 + 536870912,
+		MemoryHigh:                   -1,
+		MemoryMin:                    268435456,
+		MemoryOOMGroup:               &oomGroup,
+		CpuQuota:                     -1,
+		CpuPeriod:                    100000,
+		CpuWeight:                    100,
+		CpuBurst:                     &burst,
+		CpusetCpus:                   "0-3",
+		CpusetMems:                   "0",
+		PidsLimit:                    -1,
+		BlkioThrottleReadBpsDevice:   []*configs.ThrottleDevice{configs.NewThrottleDevice(8, 16, 2097152)},
+		BlkioThrottleWriteIOPSDevice: []*configs.ThrottleDevice{configs.NewThrottleDevice(8, 16, 120)},
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Errorf("expected %+v, got %+v", expected, r)
+	}
+}
+
+func TestSetRollback(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	original := map[string]string{
+		"cgroup.controllers": "cpu io memory pids\n",
+		"pids.max":           "100\n",
+		"memory.max":         "max\n",
+		"memory.swap.max":    "0\n",
+		"cpu.weight":         "100\n",
+	}
+	for file, data := range original {
+		if err := os.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Make writing to cpu.max fail.
+	if err := os.Symlink("nonexistent/file", filepath.Join(fakeCgroupDir, "cpu.max")); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &manager{config: &configs.Cgroup{}, dirPath: fakeCgroupDir}
+	r := &configs.Resources{
+		PidsLimit:  200,
+		Memory:     1073741824,
+		MemorySwap: 2147483648,
+		CpuWeight:  50,
+		CpuQuota:   10000,
+	}
+	if err := m.Set(r); err == nil {
+		t.Fatal("expected Set to fail")
+	}
+
+	for file, expected := range original {
+		data, err := os.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to be rolled back to %q, got %q", file, expected, data)
+		}
+	}
+	if m.config.Resources != nil {
+		t.Errorf("expected resources not to be updated, got %+v", m.config.Resources)
+	}
+}
+
+func TestSetStoresCopy(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "cgroup.controllers"), []byte("pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &manager{config: &configs.Cgroup{}, dirPath: fakeCgroupDir}
+	r := &configs.Resources{PidsLimit: 100, Unified: map[string]string{"pids.max": "100"}}
+	if err := m.Set(r); err != nil {
+		t.Fatal(err)
+	}
+	// Modifying r in place must not change what a failed Set rolls back to.
+	r.PidsLimit = 200
+	r.Unified["pids.max"] = "200"
+	if m.applied == r || m.applied.PidsLimit != 100 || m.applied.Unified["pids.max"] != "100" {
+		t.Errorf("expected a copy of the resources set, got %+v", m.applied)
+	}
+}
+
+func TestPlanSet(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	original := map[string]string{
+		"cgroup.controllers": "cpu memory pids\n",
+		"pids.max":           "100\n",
+		"memory.max":         "max\n",
+		"memory.swap.max":    "0\n",
+		"cpu.weight":         "100\n",
+	}
+	for file, data := range original {
+		if err := os.WriteFile(filepath.Join(fakeCgroupDir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	m := &manager{config: &configs.Cgroup{}, dirPath: fakeCgroupDir}
+	r := &configs.Resources{
+		PidsLimit:  200,
+		Memory:     1073741824,
+		MemorySwap: 2147483648,
+		CpuWeight:  50,
+		// cpu.max does not exist, so it can not be planned.
+		CpuQuota: 10000,
+	}
+	if _, err := m.PlanSet(r); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ENOENT error, got %v", err)
+	}
+
+	r.CpuQuota = 0
+	p, err := m.PlanSet(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The device filter program is checked separately.
+	last := &p.Ops[len(p.Ops)-1]
+	if last.Type != cgroups.OpAttachDeviceFilter || last.Value == "" {
+		t.Errorf("expected the plan to end with a device filter, got %v", last)
+	}
+	last.Value = ""
+	expected := []cgroups.Op{
+		{Type: cgroups.OpWriteFile, Path: fakeCgroupDir, File: "pids.max", Value: "200"},
+		{Type: cgroups.OpWriteFile, Path: fakeCgroupDir, File: "memory.swap.max", Value: "1073741824"},
+		{Type: cgroups.OpWriteFile, Path: fakeCgroupDir, File: "memory.max", Value: "1073741824"},
+		{Type: cgroups.OpWriteFile, Path: fakeCgroupDir, File: "cpu.weight", Value: "50"},
+		{Type: cgroups.OpAttachDeviceFilter, Path: fakeCgroupDir},
+	}
+	if !reflect.DeepEqual(p.Ops, expected) {
+		t.Errorf("expected plan %v, got %v", expected, p.Ops)
+	}
+
+	// Planning must not change anything.
+	for file, expected := range original {
+		data, err := os.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to be left as %q, got %q", file, expected, data)
+		}
+	}
+}
+
+func TestGetStatsTree(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	for dir, current := range map[string]string{
+		".":   "3\n",
+		"a":   "2\n",
+		"a/b": "1\n",
+	} {
+		dir = filepath.Join(fakeCgroupDir, dir)
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+		for file, data := range map[string]string{
+			"pids.current": current,
+			"pids.max":     "max\n",
+		} {
+			if err := os.WriteFile(filepath.Join(dir, file), []byte(data), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	m := &manager{config: &configs.Cgroup{}, dirPath: fakeCgroupDir}
+	tree, err := m.GetStatsTree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]uint64{".": 3, "a": 2, "a/b": 1}
+	if len(tree) != len(expected) {
+		t.Fatalf("expected %d cgroups, got %v", len(expected), tree)
+	}
+	for p, current := range expected {
+		if stats := tree[p]; stats == nil || stats.PidsStats.Current != current {
+			t.Errorf("expected %s to have %d pids, got %+v", p, current, stats)
+		}
+	}
+}
+
+func TestSnapshotUnified(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	// A directory can not be read as a file.
+	if err := os.Mkdir(filepath.Join(fakeCgroupDir, "pids.max"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(fakeCgroupDir, "memory.reclaim"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write-only files are not saved.
+	r := &configs.Resources{Unified: map[string]string{"memory.reclaim": "1M"}}
+	if _, err := snapshot(nil, fakeCgroupDir, r, nil); err != nil {
+		t.Fatal(err)
+	}
+	// Other errors are not ignored.
+	r = &configs.Resources{Unified: map[string]string{"pids.max": "10"}}
+	if _, err := snapshot(nil, fakeCgroupDir, r, nil); err == nil {
+		t.Fatal("expected snapshot to fail")
+	}
+}
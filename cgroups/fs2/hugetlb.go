@@ -11,10 +11,10 @@ import (
 )
 
 func isHugeTlbSet(r *configs.Resources) bool {
-	return len(r.HugetlbLimit) > 0
+	return cgroups.IsControllerSet("hugetlb", r)
 }
 
-func setHugeTlb(dirPath string, r *configs.Resources) error {
+func setHugeTlb(w cgroups.FileWriter, dirPath string, r *configs.Resources) error {
 	if !isHugeTlbSet(r) {
 		return nil
 	}
@@ -23,13 +23,13 @@ func setHugeTlb(dirPath string, r *configs.Resources) error {
 	for _, hugetlb := range r.HugetlbLimit {
 		prefix := "hugetlb." + hugetlb.Pagesize
 		val := strconv.FormatUint(hugetlb.Limit, 10)
-		if err := cgroups.WriteFile(dirPath, prefix+suffix, val); err != nil {
+		if err := w.WriteFile(dirPath, prefix+suffix, val); err != nil {
 			return err
 		}
 		if skipRsvd {
 			continue
 		}
-		if err := cgroups.WriteFile(dirPath, prefix+".rsvd"+suffix, val); err != nil {
+		if err := w.WriteFile(dirPath, prefix+".rsvd"+suffix, val); err != nil {
 			if errors.Is(err, os.ErrNotExist) {
 				skipRsvd = true
 				continue
@@ -41,13 +41,37 @@ func setHugeTlb(dirPath string, r *configs.Resources) error {
 	return nil
 }
 
-func statHugeTlb(dirPath string, stats *cgroups.Stats) error {
+// getHugeTlb is the reverse of setHugeTlb. Page sizes
+// with no limit set are not included.
+func getHugeTlb(h *cgroups.Host, dirPath string, r *configs.Resources) error {
+	r.HugetlbLimit = nil
+	for _, pagesize := range cgroups.HugePageSizes() {
+		limit, err := fscommon.GetCgroupParamLimitFrom(h, dirPath, "hugetlb."+pagesize+".max")
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if limit == -1 {
+			continue
+		}
+		r.HugetlbLimit = append(r.HugetlbLimit, &configs.HugepageLimit{
+			Pagesize: pagesize,
+			Limit:    uint64(limit),
+		})
+	}
+
+	return nil
+}
+
+func statHugeTlb(h *cgroups.Host, dirPath string, stats *cgroups.Stats) error {
 	hugetlbStats := cgroups.HugetlbStats{}
 	rsvd := ".rsvd"
 	for _, pagesize := range cgroups.HugePageSizes() {
 	again:
 		prefix := "hugetlb." + pagesize + rsvd
-		value, err := fscommon.GetCgroupParamUint(dirPath, prefix+".current")
+		value, err := fscommon.GetCgroupParamUintFrom(h, dirPath, prefix+".current")
 		if err != nil {
 			if rsvd != "" && errors.Is(err, os.ErrNotExist) {
 				rsvd = ""
@@ -57,7 +81,7 @@ func statHugeTlb(dirPath string, stats *cgroups.Stats) error {
 		}
 		hugetlbStats.Usage = value
 
-		value, err = fscommon.GetValueByKey(dirPath, prefix+".events", "max")
+		value, err = fscommon.GetValueByKeyFrom(h, dirPath, prefix+".events", "max")
 		if err != nil {
 			return err
 		}
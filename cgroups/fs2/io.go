@@ -2,7 +2,6 @@ package fs2
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"os"
 	"strconv"
@@ -15,29 +14,10 @@ import (
 )
 
 func isIoSet(r *configs.Resources) bool {
-	return r.BlkioWeight != 0 ||
-		len(r.BlkioWeightDevice) > 0 ||
-		len(r.BlkioThrottleReadBpsDevice) > 0 ||
-		len(r.BlkioThrottleWriteBpsDevice) > 0 ||
-		len(r.BlkioThrottleReadIOPSDevice) > 0 ||
-		len(r.BlkioThrottleWriteIOPSDevice) > 0
+	return cgroups.IsControllerSet("io", r)
 }
 
-// bfqDeviceWeightSupported checks for per-device BFQ weight support (added
-// in kernel v5.4, commit 795fe54c2a8) by reading from "io.bfq.weight".
-func bfqDeviceWeightSupported(bfq *os.File) bool {
-	if bfq == nil {
-		return false
-	}
-	_, _ = bfq.Seek(0, 0)
-	buf := make([]byte, 32)
-	_, _ = bfq.Read(buf)
-	// If only a single number (default weight) if read back, we have older kernel.
-	_, err := strconv.ParseInt(string(bytes.TrimSpace(buf)), 10, 64)
-	return err != nil
-}
-
-func setIo(dirPath string, r *configs.Resources) error {
+func setIo(w cgroups.FileWriter, dirPath string, r *configs.Resources) error {
 	if !isIoSet(r) {
 		return nil
 	}
@@ -46,7 +26,7 @@ func setIo(dirPath string, r *configs.Resources) error {
 	var bfq *os.File
 	if r.BlkioWeight != 0 || len(r.BlkioWeightDevice) > 0 {
 		var err error
-		bfq, err = cgroups.OpenFile(dirPath, "io.bfq.weight", os.O_RDWR)
+		bfq, err = cgroups.FileWriterHost(w).OpenFile(dirPath, "io.bfq.weight", os.O_RDONLY)
 		if err == nil {
 			defer bfq.Close()
 		} else if !os.IsNotExist(err) {
@@ -56,41 +36,41 @@ func setIo(dirPath string, r *configs.Resources) error {
 
 	if r.BlkioWeight != 0 {
 		if bfq != nil { // Use BFQ.
-			if _, err := bfq.WriteString(strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
+			if err := w.WriteFile(dirPath, "io.bfq.weight", strconv.FormatUint(uint64(r.BlkioWeight), 10)); err != nil {
 				return err
 			}
 		} else {
 			// Fallback to io.weight with a conversion scheme.
 			v := cgroups.ConvertBlkIOToIOWeightValue(r.BlkioWeight)
-			if err := cgroups.WriteFile(dirPath, "io.weight", strconv.FormatUint(v, 10)); err != nil {
+			if err := w.WriteFile(dirPath, "io.weight", strconv.FormatUint(v, 10)); err != nil {
 				return err
 			}
 		}
 	}
-	if bfqDeviceWeightSupported(bfq) {
+	if cgroups.BFQDeviceWeightSupported(bfq) {
 		for _, wd := range r.BlkioWeightDevice {
-			if _, err := bfq.WriteString(wd.WeightString() + "\n"); err != nil {
+			if err := w.WriteFile(dirPath, "io.bfq.weight", wd.WeightString()+"\n"); err != nil {
 				return fmt.Errorf("setting device weight %q: %w", wd.WeightString(), err)
 			}
 		}
 	}
 	for _, td := range r.BlkioThrottleReadBpsDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("rbps")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("rbps")); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteBpsDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("wbps")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("wbps")); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleReadIOPSDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("riops")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("riops")); err != nil {
 			return err
 		}
 	}
 	for _, td := range r.BlkioThrottleWriteIOPSDevice {
-		if err := cgroups.WriteFile(dirPath, "io.max", td.StringName("wiops")); err != nil {
+		if err := w.WriteFile(dirPath, "io.max", td.StringName("wiops")); err != nil {
 			return err
 		}
 	}
@@ -98,9 +78,63 @@ func setIo(dirPath string, r *configs.Resources) error {
 	return nil
 }
 
-func readCgroup2MapFile(dirPath string, name string) (map[string][]string, error) {
+// getIo is the reverse of setIo, reading back the throttling
+// limits from io.max. Limits which are set to "max" are not included.
+func getIo(h *cgroups.Host, dirPath string, r *configs.Resources) error {
+	const file = "io.max"
+	data, err := h.ReadFile(dirPath, file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	r.BlkioThrottleReadBpsDevice = nil
+	r.BlkioThrottleWriteBpsDevice = nil
+	r.BlkioThrottleReadIOPSDevice = nil
+	r.BlkioThrottleWriteIOPSDevice = nil
+	for _, line := range strings.Split(data, "\n") {
+		// Format: MAJ:MIN rbps=N wbps=N riops=N wiops=N
+		parts := strings.Fields(line)
+		if len(parts) == 0 {
+			continue
+		}
+		var major, minor int64
+		if _, err := fmt.Sscanf(parts[0], "%d:%d", &major, &minor); err != nil {
+			return &parseError{Path: dirPath, File: file, Err: err}
+		}
+		for _, kv := range parts[1:] {
+			key, val, ok := strings.Cut(kv, "=")
+			if !ok {
+				return &parseError{Path: dirPath, File: file, Err: fmt.Errorf("invalid entry %q", kv)}
+			}
+			if val == "max" {
+				continue
+			}
+			rate, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return &parseError{Path: dirPath, File: file, Err: err}
+			}
+			td := configs.NewThrottleDevice(major, minor, rate)
+			switch key {
+			case "rbps":
+				r.BlkioThrottleReadBpsDevice = append(r.BlkioThrottleReadBpsDevice, td)
+			case "wbps":
+				r.BlkioThrottleWriteBpsDevice = append(r.BlkioThrottleWriteBpsDevice, td)
+			case "riops":
+				r.BlkioThrottleReadIOPSDevice = append(r.BlkioThrottleReadIOPSDevice, td)
+			case "wiops":
+				r.BlkioThrottleWriteIOPSDevice = append(r.BlkioThrottleWriteIOPSDevice, td)
+			}
+		}
+	}
+
+	return nil
+}
+
+func readCgroup2MapFile(h *cgroups.Host, dirPath string, name string) (map[string][]string, error) {
 	ret := map[string][]string{}
-	f, err := cgroups.OpenFile(dirPath, name, os.O_RDONLY)
+	f, err := h.OpenFile(dirPath, name, os.O_RDONLY)
 	if err != nil {
 		return nil, err
 	}
@@ -120,9 +154,9 @@ func readCgroup2MapFile(dirPath string, name string) (map[string][]string, error
 	return ret, nil
 }
 
-func statIo(dirPath string, stats *cgroups.Stats) error {
+func statIo(h *cgroups.Host, dirPath string, stats *cgroups.Stats) error {
 	const file = "io.stat"
-	values, err := readCgroup2MapFile(dirPath, file)
+	values, err := readCgroup2MapFile(h, dirPath, file)
 	if err != nil {
 		return err
 	}
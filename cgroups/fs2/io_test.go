@@ -67,7 +67,7 @@ func TestStatIo(t *testing.T) {
 	}
 
 	var gotStats cgroups.Stats
-	if err := statIo(fakeCgroupDir, &gotStats); err != nil {
+	if err := statIo(nil, fakeCgroupDir, &gotStats); err != nil {
 		t.Error(err)
 	}
 
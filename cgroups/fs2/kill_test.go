@@ -0,0 +1,38 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestKillUsesCgroupKill(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	killPath := filepath.Join(fakeCgroupDir, "cgroup.kill")
+	if err := os.WriteFile(killPath, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(&configs.Cgroup{Resources: &configs.Resources{}}, fakeCgroupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Kill(unix.SIGKILL); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(killPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1" {
+		t.Fatalf("expected cgroup.kill to contain %q, got %q", "1", data)
+	}
+}
@@ -3,8 +3,11 @@ package fs2
 import (
 	"bufio"
 	"errors"
+	"fmt"
+	"maps"
 	"math"
 	"os"
+	"reflect"
 	"strconv"
 	"strings"
 
@@ -33,10 +36,10 @@ func numToStr(value int64) (ret string) {
 }
 
 func isMemorySet(r *configs.Resources) bool {
-	return r.MemoryReservation != 0 || r.Memory != 0 || r.MemorySwap != 0
+	return cgroups.IsControllerSet("memory", r)
 }
 
-func setMemory(dirPath string, r *configs.Resources) error {
+func setMemory(w cgroups.FileWriter, dirPath string, r *configs.Resources) error {
 	if !isMemorySet(r) {
 		return nil
 	}
@@ -51,13 +54,13 @@ func setMemory(dirPath string, r *configs.Resources) error {
 	}
 	// never write empty string to `memory.swap.max`, it means set to 0.
 	if swapStr != "" {
-		if err := cgroups.WriteFile(dirPath, "memory.swap.max", swapStr); err != nil {
+		if err := w.WriteFile(dirPath, "memory.swap.max", swapStr); err != nil {
 			return err
 		}
 	}
 
 	if val := numToStr(r.Memory); val != "" {
-		if err := cgroups.WriteFile(dirPath, "memory.max", val); err != nil {
+		if err := w.WriteFile(dirPath, "memory.max", val); err != nil {
 			return err
 		}
 	}
@@ -65,7 +68,30 @@ func setMemory(dirPath string, r *configs.Resources) error {
 	// cgroup.Resources.KernelMemory is ignored
 
 	if val := numToStr(r.MemoryReservation); val != "" {
-		if err := cgroups.WriteFile(dirPath, "memory.low", val); err != nil {
+		if err := w.WriteFile(dirPath, "memory.low", val); err != nil {
+			return err
+		}
+	}
+
+	if val := numToStr(r.MemoryHigh); val != "" {
+		if err := w.WriteFile(dirPath, "memory.high", val); err != nil {
+			return err
+		}
+	}
+
+	if val := numToStr(r.MemoryMin); val != "" {
+		if err := w.WriteFile(dirPath, "memory.min", val); err != nil {
+			return err
+		}
+	}
+
+	// memory.oom.group since kernel 4.19
+	if r.MemoryOOMGroup != nil {
+		val := "0"
+		if *r.MemoryOOMGroup {
+			val = "1"
+		}
+		if err := w.WriteFile(dirPath, "memory.oom.group", val); err != nil {
 			return err
 		}
 	}
@@ -73,9 +99,57 @@ func setMemory(dirPath string, r *configs.Resources) error {
 	return nil
 }
 
-func statMemory(dirPath string, stats *cgroups.Stats) error {
+// getMemory is the reverse of setMemory. Files which do not exist
+// (e.g. in the root cgroup, or on older kernels) are skipped.
+func getMemory(h *cgroups.Host, dirPath string, r *configs.Resources) error {
+	for _, f := range []struct {
+		name string
+		val  *int64
+	}{
+		{"memory.max", &r.Memory},
+		{"memory.low", &r.MemoryReservation},
+		{"memory.high", &r.MemoryHigh},
+		{"memory.min", &r.MemoryMin},
+	} {
+		v, err := fscommon.GetCgroupParamLimitFrom(h, dirPath, f.name)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		*f.val = v
+	}
+
+	swap, err := fscommon.GetCgroupParamLimitFrom(h, dirPath, "memory.swap.max")
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case swap == -1, r.Memory == -1:
+		// A swap limit without a memory limit can not be expressed
+		// as a memory+swap limit, so it is reported as unlimited.
+		r.MemorySwap = -1
+	case r.Memory > 0:
+		r.MemorySwap = r.Memory + swap
+	}
+
+	oomGroup, err := fscommon.GetCgroupParamUintFrom(h, dirPath, "memory.oom.group")
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		v := oomGroup == 1
+		r.MemoryOOMGroup = &v
+	}
+
+	return nil
+}
+
+func statMemory(h *cgroups.Host, dirPath string, stats *cgroups.Stats) error {
 	const file = "memory.stat"
-	statsFile, err := cgroups.OpenFile(dirPath, file, os.O_RDONLY)
+	statsFile, err := h.OpenFile(dirPath, file, os.O_RDONLY)
 	if err != nil {
 		return err
 	}
@@ -93,22 +167,38 @@ func statMemory(dirPath string, stats *cgroups.Stats) error {
 		return &parseError{Path: dirPath, File: file, Err: err}
 	}
 	stats.MemoryStats.Cache = stats.MemoryStats.Stats["file"]
+	stats.MemoryStats.StatsV2 = memoryStatV2(stats.MemoryStats.Stats)
 	// Unlike cgroup v1 which has memory.use_hierarchy binary knob,
 	// cgroup v2 is always hierarchical.
 	stats.MemoryStats.UseHierarchy = true
 
-	memoryUsage, err := getMemoryDataV2(dirPath, "")
+	// memory.numa_stat is absent in the root cgroup,
+	// and on older kernels.
+	if err := statMemoryNUMA(h, dirPath, &stats.MemoryStats); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	// memory.events is absent in the root cgroup, and
+	// memory.events.local is only available since kernel 5.2.
+	if err := statMemoryEvents(h, dirPath, "memory.events", &stats.MemoryStats.Events.MemoryEventsInner); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := statMemoryEvents(h, dirPath, "memory.events.local", &stats.MemoryStats.Events.Local); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	memoryUsage, err := getMemoryDataV2(h, dirPath, "")
 	if err != nil {
-		if errors.Is(err, unix.ENOENT) && dirPath == UnifiedMountpoint {
+		if errors.Is(err, unix.ENOENT) && h.IsRoot(dirPath) {
 			// The root cgroup does not have memory.{current,max,peak}
 			// so emulate those using data from /proc/meminfo and
-			// /sys/fs/cgroup/memory.stat
+			// the root memory.stat
 			return rootStatsFromMeminfo(stats)
 		}
 		return err
 	}
 	stats.MemoryStats.Usage = memoryUsage
-	swapOnlyUsage, err := getMemoryDataV2(dirPath, "swap")
+	swapOnlyUsage, err := getMemoryDataV2(h, dirPath, "swap")
 	if err != nil {
 		return err
 	}
@@ -129,7 +219,147 @@ func statMemory(dirPath string, stats *cgroups.Stats) error {
 	return nil
 }
 
-func getMemoryDataV2(path, name string) (cgroups.MemoryData, error) {
+// memoryStatV2Fields maps the memory.stat keys to the indexes of the
+// cgroups.MemoryStatV2 fields, which have the keys as their json tags.
+var memoryStatV2Fields = func() map[string]int {
+	t := reflect.TypeOf(cgroups.MemoryStatV2{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		fields[t.Field(i).Tag.Get("json")] = i
+	}
+	return fields
+}()
+
+// memoryStatV2 returns the memory.stat values in typed form.
+func memoryStatV2(stats map[string]uint64) *cgroups.MemoryStatV2 {
+	s := &cgroups.MemoryStatV2{}
+	v := reflect.ValueOf(s).Elem()
+	for key, value := range stats {
+		switch key {
+		case "workingset_refault", "workingset_activate", "workingset_restore":
+			// Before kernel 5.9, only the file pages were
+			// tracked, and the keys had no "_file" suffix.
+			key += "_file"
+		}
+		if i, ok := memoryStatV2Fields[key]; ok {
+			v.Field(i).SetUint(value)
+		}
+	}
+	return s
+}
+
+// statMemoryNUMA parses memory.numa_stat into stats.PageUsageByNUMA, in the
+// same form as on cgroup v1: the values are converted from bytes to pages,
+// and Total is the sum of File, Anon and Unevictable. As the statistics are
+// hierarchical on cgroup v2, Hierarchical is the same as the top level.
+func statMemoryNUMA(h *cgroups.Host, dirPath string, stats *cgroups.MemoryStats) error {
+	const file = "memory.numa_stat"
+	f, err := h.OpenFile(dirPath, file, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// The file looks like this:
+	//
+	// anon N0=<node 0 bytes> N1=<node 1 bytes> ...
+	// file N0=<node 0 bytes> N1=<node 1 bytes> ...
+	// ...
+	pageSize := uint64(os.Getpagesize())
+	var usage cgroups.PageUsageByNUMAInner
+	usage.Total.Nodes = make(map[uint8]uint64)
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var field *cgroups.PageStats
+		columns := strings.Fields(sc.Text())
+		if len(columns) == 0 {
+			continue
+		}
+		switch columns[0] {
+		case "anon":
+			field = &usage.Anon
+		case "file":
+			field = &usage.File
+		case "unevictable":
+			field = &usage.Unevictable
+		default:
+			continue
+		}
+		field.Nodes = make(map[uint8]uint64)
+		for _, column := range columns[1:] {
+			key, val, ok := strings.Cut(column, "=")
+			if !ok || len(key) < 2 || key[0] != 'N' {
+				return &parseError{Path: dirPath, File: file, Err: fmt.Errorf("malformed line: %s", sc.Text())}
+			}
+			n, err := strconv.ParseUint(key[1:], 10, 8)
+			if err != nil {
+				return &parseError{Path: dirPath, File: file, Err: err}
+			}
+			bytes, err := strconv.ParseUint(val, 10, 64)
+			if err != nil {
+				return &parseError{Path: dirPath, File: file, Err: err}
+			}
+			pages := bytes / pageSize
+			field.Nodes[uint8(n)] = pages
+			field.Total += pages
+			usage.Total.Nodes[uint8(n)] += pages
+			usage.Total.Total += pages
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return &parseError{Path: dirPath, File: file, Err: err}
+	}
+
+	stats.PageUsageByNUMA.PageUsageByNUMAInner = usage
+	stats.PageUsageByNUMA.Hierarchical = cgroups.PageUsageByNUMAInner{
+		Total:       clonePageStats(usage.Total),
+		File:        clonePageStats(usage.File),
+		Anon:        clonePageStats(usage.Anon),
+		Unevictable: clonePageStats(usage.Unevictable),
+	}
+	return nil
+}
+
+func clonePageStats(s cgroups.PageStats) cgroups.PageStats {
+	return cgroups.PageStats{Total: s.Total, Nodes: maps.Clone(s.Nodes)}
+}
+
+// statMemoryEvents parses a memory.events or memory.events.local file.
+func statMemoryEvents(h *cgroups.Host, dirPath, file string, events *cgroups.MemoryEventsInner) error {
+	f, err := h.OpenFile(dirPath, file, os.O_RDONLY)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		t, v, err := fscommon.ParseKeyValue(sc.Text())
+		if err != nil {
+			return &parseError{Path: dirPath, File: file, Err: err}
+		}
+		switch t {
+		case "low":
+			events.Low = v
+		case "high":
+			events.High = v
+		case "max":
+			events.Max = v
+		case "oom":
+			events.OOM = v
+		case "oom_kill":
+			events.OOMKill = v
+		case "oom_group_kill":
+			events.OOMGroupKill = v
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return &parseError{Path: dirPath, File: file, Err: err}
+	}
+	return nil
+}
+
+func getMemoryDataV2(h *cgroups.Host, path, name string) (cgroups.MemoryData, error) {
 	memoryData := cgroups.MemoryData{}
 
 	moduleName := "memory"
@@ -140,7 +370,7 @@ func getMemoryDataV2(path, name string) (cgroups.MemoryData, error) {
 	limit := moduleName + ".max"
 	maxUsage := moduleName + ".peak"
 
-	value, err := fscommon.GetCgroupParamUint(path, usage)
+	value, err := fscommon.GetCgroupParamUintFrom(h, path, usage)
 	if err != nil {
 		if name != "" && os.IsNotExist(err) {
 			// Ignore EEXIST as there's no swap accounting
@@ -152,7 +382,7 @@ func getMemoryDataV2(path, name string) (cgroups.MemoryData, error) {
 	}
 	memoryData.Usage = value
 
-	value, err = fscommon.GetCgroupParamUint(path, limit)
+	value, err = fscommon.GetCgroupParamUintFrom(h, path, limit)
 	if err != nil {
 		return cgroups.MemoryData{}, err
 	}
@@ -160,7 +390,7 @@ func getMemoryDataV2(path, name string) (cgroups.MemoryData, error) {
 
 	// `memory.peak` since kernel 5.19
 	// `memory.swap.peak` since kernel 6.5
-	value, err = fscommon.GetCgroupParamUint(path, maxUsage)
+	value, err = fscommon.GetCgroupParamUintFrom(h, path, maxUsage)
 	if err != nil && !os.IsNotExist(err) {
 		return cgroups.MemoryData{}, err
 	}
@@ -232,3 +462,44 @@ func rootStatsFromMeminfo(stats *cgroups.Stats) error {
 
 	return nil
 }
+
+// Reclaim makes the kernel reclaim up to bytes of the memory of the
+// cgroup at dirPath using memory.reclaim, with the swappiness overridden
+// if not nil. It returns the decrease of memory.current.
+func Reclaim(dirPath string, bytes uint64, swappiness *int) (uint64, error) {
+	return reclaim(nil, dirPath, bytes, swappiness)
+}
+
+func reclaim(h *cgroups.Host, dirPath string, bytes uint64, swappiness *int) (uint64, error) {
+	if bytes == 0 {
+		return 0, errors.New("the amount of memory to reclaim must be non-zero")
+	}
+	req := strconv.FormatUint(bytes, 10)
+	if swappiness != nil {
+		if *swappiness < 0 || *swappiness > 200 {
+			return 0, fmt.Errorf("invalid swappiness value: %d (valid range is 0-200)", *swappiness)
+		}
+		// Only supported by newer kernels, older ones return EINVAL.
+		req += " swappiness=" + strconv.Itoa(*swappiness)
+	}
+	before, err := fscommon.GetCgroupParamUintFrom(h, dirPath, "memory.current")
+	if err != nil {
+		return 0, err
+	}
+	// EAGAIN means less than the requested amount was reclaimed,
+	// which is reported by the returned value.
+	if err := h.WriteFile(dirPath, "memory.reclaim", req); err != nil && !errors.Is(err, unix.EAGAIN) {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, fmt.Errorf("memory.reclaim is not supported (kernel 5.19+ is required): %w", err)
+		}
+		return 0, err
+	}
+	after, err := fscommon.GetCgroupParamUintFrom(h, dirPath, "memory.current")
+	if err != nil {
+		return 0, err
+	}
+	if after > before {
+		return 0, nil
+	}
+	return before - after, nil
+}
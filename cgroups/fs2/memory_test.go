@@ -1,12 +1,15 @@
 package fs2
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
 )
 
 const exampleMemoryStatData = `anon 790425600
@@ -66,7 +69,7 @@ func TestStatMemoryPodCgroupNotFound(t *testing.T) {
 
 	// use a fake root path to mismatch the file we wrote.
 	// this triggers the non-root path which should fail to find memory.current.
-	err := statMemory(fakeCgroupDir, gotStats)
+	err := statMemory(nil, fakeCgroupDir, gotStats)
 	if err == nil {
 		t.Errorf("expected error when statting memory for cgroupv2 root, but was nil")
 	}
@@ -101,7 +104,7 @@ func TestStatMemoryPodCgroup(t *testing.T) {
 	gotStats := cgroups.NewStats()
 
 	// use a fake root path to trigger the pod cgroup lookup.
-	err := statMemory(fakeCgroupDir, gotStats)
+	err := statMemory(nil, fakeCgroupDir, gotStats)
 	if err != nil {
 		t.Errorf("expected no error when statting memory for cgroupv2 root, but got %#+v", err)
 	}
@@ -125,6 +128,164 @@ func TestStatMemoryPodCgroup(t *testing.T) {
 	}
 }
 
+func TestStatMemoryEvents(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	files := map[string]string{
+		"memory.stat":    exampleMemoryStatData,
+		"memory.current": "123456789",
+		"memory.max":     "999999999",
+		"memory.events": `low 1
+high 2
+max 3
+oom 4
+oom_kill 5
+oom_group_kill 6
+`,
+		"memory.events.local": `low 0
+high 2
+max 0
+oom 0
+oom_kill 1
+oom_group_kill 0
+`,
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(fakeCgroupDir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gotStats := cgroups.NewStats()
+	if err := statMemory(nil, fakeCgroupDir, gotStats); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := cgroups.MemoryEvents{
+		MemoryEventsInner: cgroups.MemoryEventsInner{
+			Low:          1,
+			High:         2,
+			Max:          3,
+			OOM:          4,
+			OOMKill:      5,
+			OOMGroupKill: 6,
+		},
+		Local: cgroups.MemoryEventsInner{
+			High:    2,
+			OOMKill: 1,
+		},
+	}
+	if gotStats.MemoryStats.Events != expected {
+		t.Errorf("parsed cgroupv2 memory.events doesn't match expected result: \ngot %+v\nexpected %+v\n", gotStats.MemoryStats.Events, expected)
+	}
+}
+
+func TestStatMemoryV2(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	pageSize := uint64(os.Getpagesize())
+	files := map[string]string{
+		// The keys of kernels before 5.9.
+		"memory.stat": `anon 790425600
+file 6502666240
+workingset_refault 12
+workingset_activate 3
+pgfault 103216687
+unknown_key 42
+`,
+		"memory.current": "123456789",
+		"memory.max":     "max",
+		"memory.numa_stat": fmt.Sprintf(`anon N0=%d N1=%d
+file N0=%d N1=0
+kernel_stack N0=16384 N1=0
+unevictable N0=0 N1=%d
+`, 2*pageSize, 3*pageSize, 5*pageSize, pageSize),
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(fakeCgroupDir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	gotStats := cgroups.NewStats()
+	if err := statMemory(nil, fakeCgroupDir, gotStats); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := cgroups.MemoryStatV2{
+		Anon:                   790425600,
+		File:                   6502666240,
+		WorkingsetRefaultFile:  12,
+		WorkingsetActivateFile: 3,
+		Pgfault:                103216687,
+	}
+	if *gotStats.MemoryStats.StatsV2 != expected {
+		t.Errorf("parsed cgroupv2 memory.stat doesn't match expected result: \ngot %+v\nexpected %+v\n", *gotStats.MemoryStats.StatsV2, expected)
+	}
+
+	expectedNUMA := cgroups.PageUsageByNUMAInner{
+		Total:       cgroups.PageStats{Total: 11, Nodes: map[uint8]uint64{0: 7, 1: 4}},
+		Anon:        cgroups.PageStats{Total: 5, Nodes: map[uint8]uint64{0: 2, 1: 3}},
+		File:        cgroups.PageStats{Total: 5, Nodes: map[uint8]uint64{0: 5, 1: 0}},
+		Unevictable: cgroups.PageStats{Total: 1, Nodes: map[uint8]uint64{0: 0, 1: 1}},
+	}
+	numa := gotStats.MemoryStats.PageUsageByNUMA
+	if !reflect.DeepEqual(numa.PageUsageByNUMAInner, expectedNUMA) {
+		t.Errorf("parsed cgroupv2 memory.numa_stat doesn't match expected result: \ngot %+v\nexpected %+v\n", numa.PageUsageByNUMAInner, expectedNUMA)
+	}
+	if !reflect.DeepEqual(numa.Hierarchical, expectedNUMA) {
+		t.Errorf("expected hierarchical NUMA stats to match, got %+v", numa.Hierarchical)
+	}
+}
+
+func TestStatMemoryNUMAMalformed(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "memory.numa_stat"), []byte("anon N0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	var stats cgroups.MemoryStats
+	if err := statMemoryNUMA(nil, fakeCgroupDir, &stats); err == nil {
+		t.Fatal("expected error, got nil")
+	}
+}
+
+func TestReclaim(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "memory.current"), []byte("8192\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	swappiness := 201
+	if _, err := Reclaim(fakeCgroupDir, 4096, &swappiness); err == nil {
+		t.Fatal("expected error for invalid swappiness, got nil")
+	}
+
+	swappiness = 10
+	reclaimed, err := Reclaim(fakeCgroupDir, 4096, &swappiness)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reclaimed != 0 {
+		t.Errorf("expected nothing to be reclaimed, got %d", reclaimed)
+	}
+	data, err := os.ReadFile(filepath.Join(fakeCgroupDir, "memory.reclaim"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "4096 swappiness=10" {
+		t.Errorf("expected memory.reclaim to be %q, got %q", "4096 swappiness=10", data)
+	}
+}
+
 func TestRootStatsFromMeminfo(t *testing.T) {
 	stats := &cgroups.Stats{
 		MemoryStats: cgroups.MemoryStats{
@@ -153,3 +314,37 @@ func TestRootStatsFromMeminfo(t *testing.T) {
 		t.Errorf("swap limit %d should be at least mem limit %d", stats.MemoryStats.SwapUsage.Limit, stats.MemoryStats.Usage.Limit)
 	}
 }
+
+func TestSetMemoryHighMinOOMGroup(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+
+	oomGroup := true
+	r := &configs.Resources{
+		MemoryHigh:     1024,
+		MemoryMin:      -1,
+		MemoryOOMGroup: &oomGroup,
+	}
+	if err := setMemory(cgroups.Cgroupfs, fakeCgroupDir, r); err != nil {
+		t.Fatal(err)
+	}
+
+	for file, expected := range map[string]string{
+		"memory.high":      "1024",
+		"memory.min":       "max",
+		"memory.oom.group": "1",
+	} {
+		data, err := os.ReadFile(filepath.Join(fakeCgroupDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to contain %q, got %q", file, expected, data)
+		}
+	}
+	// Unset values should not be written.
+	if _, err := os.Stat(filepath.Join(fakeCgroupDir, "memory.max")); !os.IsNotExist(err) {
+		t.Errorf("expected memory.max not to be written, got %v", err)
+	}
+}
@@ -0,0 +1,53 @@
+package fs2
+
+import (
+	"context"
+
+	"github.com/dims/libcontainer/cgroups"
+)
+
+// NotifyOOM returns a channel which receives an event every time the
+// "oom" or "oom_kill" counter in dirPath's memory.events is incremented,
+// i.e. an allocation fails because of memory.max, or a process in the
+// cgroup is killed by the OOM killer (which can also be caused by a
+// global OOM condition). The channel is closed once ctx is done, or the
+// cgroup is removed.
+func NotifyOOM(ctx context.Context, dirPath string) (<-chan cgroups.OOMEvent, error) {
+	return notifyOOM(ctx, nil, dirPath)
+}
+
+func notifyOOM(ctx context.Context, h *cgroups.Host, dirPath string) (<-chan cgroups.OOMEvent, error) {
+	events, err := h.WatchEvents(ctx, dirPath, cgroups.EventOOM, cgroups.EventOOMKill)
+	if err != nil {
+		return nil, err
+	}
+	kills, _ := oomKillCount(h, dirPath)
+
+	ch := make(chan cgroups.OOMEvent)
+	go func() {
+		defer close(ch)
+		for ev := range events {
+			switch ev.Type {
+			case cgroups.EventOOM:
+				// The OOM kill (if any) is reported along with the
+				// OOM condition causing it.
+				if n, err := oomKillCount(h, dirPath); err == nil && n > kills {
+					kills = n
+				}
+			case cgroups.EventOOMKill:
+				if ev.Value <= kills {
+					// Already reported.
+					continue
+				}
+				kills = ev.Value
+			}
+			select {
+			case ch <- cgroups.OOMEvent{OOMKill: kills}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch, nil
+}
@@ -0,0 +1,141 @@
+package fs2
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dims/libcontainer/cgroups"
+)
+
+func TestNotifyOOM(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	eventsPath := filepath.Join(fakeCgroupDir, "memory.events")
+
+	writeEvents := func(oom, oomKill string) {
+		t.Helper()
+		data := "low 0\nhigh 0\nmax 1\noom " + oom + "\noom_kill " + oomKill + "\noom_group_kill 0\n"
+		if err := os.WriteFile(eventsPath, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeEvents("1", "1")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := NotifyOOM(ctx, fakeCgroupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A modification not touching OOM counters should not result
+	// in an event, while the next one should.
+	writeEvents("1", "1")
+	writeEvents("2", "2")
+
+	select {
+	case ev, ok := <-ch:
+		if !ok {
+			t.Fatal("channel closed unexpectedly")
+		}
+		if ev.OOMKill != 2 {
+			t.Errorf("expected OOMKill 2, got %d", ev.OOMKill)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for OOM event")
+	}
+
+	// Removing the file should close the channel.
+	if err := os.Remove(eventsPath); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ev, ok := <-ch:
+		if ok {
+			t.Fatalf("expected channel to be closed, got %+v", ev)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the channel to be closed")
+	}
+}
+
+func TestNotifyOOMWithoutKill(t *testing.T) {
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	eventsPath := filepath.Join(fakeCgroupDir, "memory.events")
+
+	writeEvents := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(eventsPath, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writeEvents("oom 1\noom_kill 1\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := NotifyOOM(ctx, fakeCgroupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An OOM condition with no process killed (e.g. the allocation is
+	// failed instead), one with a process killed (which should result
+	// in a single event), and a kill with no OOM condition in the cgroup.
+	for _, tc := range []struct {
+		data string
+		want uint64
+	}{
+		{"oom 2\noom_kill 1\n", 1},
+		{"oom 3\noom_kill 2\n", 2},
+		{"oom 3\noom_kill 3\n", 3},
+	} {
+		writeEvents(tc.data)
+		select {
+		case ev, ok := <-ch:
+			if !ok {
+				t.Fatal("channel closed unexpectedly")
+			}
+			if ev.OOMKill != tc.want {
+				t.Errorf("expected OOMKill %d, got %d", tc.want, ev.OOMKill)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for OOM event")
+		}
+	}
+}
+
+func TestNotifyOOMCancel(t *testing.T) {
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, "memory.events"), []byte("oom 0\noom_kill 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := NotifyOOM(ctx, fakeCgroupDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Fatal("expected channel to be closed")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the channel to be closed")
+	}
+}
+
+func TestNotifyOOMNoFile(t *testing.T) {
+	cgroups.TestMode = true
+	if _, err := NotifyOOM(context.Background(), t.TempDir()); err == nil {
+		t.Fatal("expected an error for a missing memory.events, got nil")
+	}
+}
@@ -14,15 +14,15 @@ import (
 )
 
 func isPidsSet(r *configs.Resources) bool {
-	return r.PidsLimit != 0
+	return cgroups.IsControllerSet("pids", r)
 }
 
-func setPids(dirPath string, r *configs.Resources) error {
+func setPids(w cgroups.FileWriter, dirPath string, r *configs.Resources) error {
 	if !isPidsSet(r) {
 		return nil
 	}
 	if val := numToStr(r.PidsLimit); val != "" {
-		if err := cgroups.WriteFile(dirPath, "pids.max", val); err != nil {
+		if err := w.WriteFile(dirPath, "pids.max", val); err != nil {
 			return err
 		}
 	}
@@ -30,12 +30,21 @@ func setPids(dirPath string, r *configs.Resources) error {
 	return nil
 }
 
-func statPidsFromCgroupProcs(dirPath string, stats *cgroups.Stats) error {
+// getPids is the reverse of setPids.
+func getPids(h *cgroups.Host, dirPath string, r *configs.Resources) error {
+	var err error
+	if r.PidsLimit, err = fscommon.GetCgroupParamLimitFrom(h, dirPath, "pids.max"); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func statPidsFromCgroupProcs(h *cgroups.Host, dirPath string, stats *cgroups.Stats) error {
 	// if the controller is not enabled, let's read PIDS from cgroups.procs
 	// (or threads if cgroup.threads is enabled)
-	contents, err := cgroups.ReadFile(dirPath, "cgroup.procs")
+	contents, err := h.ReadFile(dirPath, "cgroup.procs")
 	if errors.Is(err, unix.ENOTSUP) {
-		contents, err = cgroups.ReadFile(dirPath, "cgroup.threads")
+		contents, err = h.ReadFile(dirPath, "cgroup.threads")
 	}
 	if err != nil {
 		return err
@@ -46,16 +55,16 @@ func statPidsFromCgroupProcs(dirPath string, stats *cgroups.Stats) error {
 	return nil
 }
 
-func statPids(dirPath string, stats *cgroups.Stats) error {
-	current, err := fscommon.GetCgroupParamUint(dirPath, "pids.current")
+func statPids(h *cgroups.Host, dirPath string, stats *cgroups.Stats) error {
+	current, err := fscommon.GetCgroupParamUintFrom(h, dirPath, "pids.current")
 	if err != nil {
 		if os.IsNotExist(err) {
-			return statPidsFromCgroupProcs(dirPath, stats)
+			return statPidsFromCgroupProcs(h, dirPath, stats)
 		}
 		return err
 	}
 
-	max, err := fscommon.GetCgroupParamUint(dirPath, "pids.max")
+	max, err := fscommon.GetCgroupParamUintFrom(h, dirPath, "pids.max")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,122 @@
+package fs2
+
+import (
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/cgroups/fscommon"
+	"github.com/dims/libcontainer/configs"
+)
+
+// writeOnlyFiles are the cgroup v2 files which can not be read back,
+// so are not saved into a snapshot.
+var writeOnlyFiles = map[string]struct{}{
+	"cgroup.kill":    {},
+	"memory.reclaim": {},
+}
+
+// Snapshot records the current values of the cgroup v2 files in dirPath
+// which are to be modified by setting the resources r, so that they can
+// be restored if the update fails. As device rules are not stored in a
+// file, they are restored by re-applying prev (the resources previously
+// set), if it is not nil and has device rules.
+func Snapshot(dirPath string, r, prev *configs.Resources) (*cgroups.Snapshot, error) {
+	return snapshot(nil, dirPath, r, prev)
+}
+
+func snapshot(h *cgroups.Host, dirPath string, r, prev *configs.Resources) (*cgroups.Snapshot, error) {
+	s := &cgroups.Snapshot{Host: h}
+	save := func(files ...string) error {
+		return s.Save(dirPath, files...)
+	}
+
+	if isPidsSet(r) {
+		if err := save("pids.max"); err != nil {
+			return nil, err
+		}
+	}
+	if isMemorySet(r) {
+		if err := save("memory.swap.max", "memory.max", "memory.low", "memory.high", "memory.min", "memory.oom.group"); err != nil {
+			return nil, err
+		}
+	}
+	if isIoSet(r) {
+		if err := save("io.bfq.weight", "io.weight"); err != nil {
+			return nil, err
+		}
+		var devices []string
+		for _, tds := range [][]*configs.ThrottleDevice{
+			r.BlkioThrottleReadBpsDevice,
+			r.BlkioThrottleWriteBpsDevice,
+			r.BlkioThrottleReadIOPSDevice,
+			r.BlkioThrottleWriteIOPSDevice,
+		} {
+			for _, td := range tds {
+				devices = append(devices, strconv.FormatInt(td.Major, 10)+":"+strconv.FormatInt(td.Minor, 10))
+			}
+		}
+		if err := s.SaveKeyed(dirPath, "io.max", devices, "rbps=max wbps=max riops=max wiops=max"); err != nil {
+			return nil, err
+		}
+	}
+	if isCpuSet(r) {
+		if err := save("cpu.idle", "cpu.weight", "cpu.max.burst", "cpu.max"); err != nil {
+			return nil, err
+		}
+	}
+	if prev != nil && !prev.SkipDevices && len(prev.Devices) > 0 && !r.SkipDevices {
+		s.Add(func() error {
+			return setDevices(h, dirPath, prev)
+		})
+	}
+	if isCpusetSet(r) {
+		if err := save("cpuset.cpus", "cpuset.mems"); err != nil {
+			return nil, err
+		}
+		if r.CpusetPartition != "" {
+			// The file can have the state appended to the type,
+			// so it can not be written back as is.
+			data, err := h.ReadFile(dirPath, "cpuset.cpus.partition")
+			if err == nil {
+				partition, _, _ := parsePartition(data)
+				s.Add(func() error {
+					return h.WriteFile(dirPath, "cpuset.cpus.partition", partition)
+				})
+			} else if !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+		}
+	}
+	for _, hugetlb := range r.HugetlbLimit {
+		prefix := "hugetlb." + hugetlb.Pagesize
+		if err := save(prefix+".max", prefix+".rsvd.max"); err != nil {
+			return nil, err
+		}
+	}
+	if err := fscommon.RdmaSnapshot(s, dirPath, r); err != nil {
+		return nil, err
+	}
+	if r.Freezer != configs.Undefined {
+		if err := save("cgroup.freeze"); err != nil {
+			return nil, err
+		}
+	}
+	for k := range r.Unified {
+		// Invalid names are rejected by setUnified.
+		if strings.Contains(k, "/") {
+			continue
+		}
+		if _, ok := writeOnlyFiles[k]; ok {
+			// Nothing to restore.
+			continue
+		}
+		if err := save(k); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
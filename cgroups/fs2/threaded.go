@@ -0,0 +1,87 @@
+package fs2
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+// ValidateThreaded checks that the cgroup at path can be made threaded
+// with the resources r, as per the kernel's constraints: only threaded
+// controllers can be used in it, and its parent (which becomes the
+// "domain threaded" root of the threaded subtree, unless it is threaded
+// itself) can not have domain controllers enabled for its children.
+// It also checks that the cgroup has no domain siblings, which would
+// turn "domain invalid" (i.e. unusable) once it is made threaded.
+func ValidateThreaded(path string, r *configs.Resources) error {
+	return validateThreaded(cgroups.DefaultHost(), path, r, nil)
+}
+
+// validateThreaded is like ValidateThreaded, with the controllers to be
+// enabled for the children of the parent (see threadedControllers) on
+// top of the ones already enabled.
+func validateThreaded(h *cgroups.Host, path string, r *configs.Resources, enable []string) error {
+	if ctrs := cgroups.DomainControllers(r); len(ctrs) > 0 {
+		return fmt.Errorf("cannot make cgroup %s threaded: controllers %s are not threaded", path, strings.Join(ctrs, ", "))
+	}
+	parent := filepath.Dir(path)
+	if h.IsRoot(parent) {
+		return nil
+	}
+	data, err := h.ReadFile(parent, "cgroup.subtree_control")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	// The parent is to be created if it does not exist.
+	var ctrs []string
+	for _, c := range append(strings.Fields(data), enable...) {
+		if !cgroups.IsThreadedController(c) {
+			ctrs = append(ctrs, c)
+		}
+	}
+	if len(ctrs) > 0 {
+		return fmt.Errorf("cannot make cgroup %s threaded: its parent has domain controllers %s enabled", path, strings.Join(ctrs, ", "))
+	}
+	siblings, err := os.ReadDir(parent)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	for _, s := range siblings {
+		dir := filepath.Join(parent, s.Name())
+		if !s.IsDir() || dir == filepath.Clean(path) {
+			continue
+		}
+		if t, _ := h.ReadFile(dir, "cgroup.type"); strings.TrimSpace(t) == "domain" {
+			return fmt.Errorf("cannot make cgroup %s threaded: its sibling %s is a domain cgroup", path, dir)
+		}
+	}
+	return nil
+}
+
+// threadedControllers returns the threaded controllers out of ctrs,
+// which are the ones that can be enabled in the parent of a threaded
+// cgroup.
+func threadedControllers(ctrs []string) []string {
+	var threaded []string
+	for _, c := range ctrs {
+		if cgroups.IsThreadedController(c) {
+			threaded = append(threaded, c)
+		}
+	}
+	return threaded
+}
+
+// makeThreaded turns the cgroup at path into a threaded one. The checks
+// of validateThreaded are to be done first, as the kernel lets domain
+// siblings turn "domain invalid" instead of failing.
+func makeThreaded(w cgroups.FileWriter, path string) error {
+	if err := w.WriteFile(path, "cgroup.type", "threaded"); err != nil {
+		return fmt.Errorf("unable to make cgroup %s threaded: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package fs2
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/configs"
+)
+
+func TestValidateThreaded(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	parent := t.TempDir()
+	path := filepath.Join(parent, "threads")
+
+	threaded := &configs.Resources{CpuWeight: 50, PidsLimit: 10}
+	if err := ValidateThreaded(path, &configs.Resources{Memory: 1073741824}); err == nil {
+		t.Error("expected an error for a domain controller")
+	}
+	// The parent is to be created.
+	if err := ValidateThreaded(path, threaded); err != nil {
+		t.Error(err)
+	}
+
+	for data, isErr := range map[string]bool{
+		"":             false,
+		"cpu pids\n":   false,
+		"cpu memory\n": true,
+	} {
+		if err := os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		err := ValidateThreaded(path, threaded)
+		if isErr && err == nil {
+			t.Errorf("subtree_control %q: expected error, got nil", data)
+		}
+		if !isErr && err != nil {
+			t.Errorf("subtree_control %q: expected nil, got error %v", data, err)
+		}
+	}
+}
+
+func TestCreateThreadedCgroupPath(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu io memory pids\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := cgroups.NewDirHost(root, cgroups.Unified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Neither the parent nor the cgroup exist yet.
+	path := filepath.Join(root, "parent", "threads")
+	c := &configs.Cgroup{Threaded: true, Resources: &configs.Resources{PidsLimit: 10}}
+	if err := createCgroupPath(h, h, path, c); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range []struct{ dir, file, expected string }{
+		{root, "cgroup.subtree_control", "+cpu +io +memory +pids"},
+		// Only the threaded controllers are enabled in the parent.
+		{filepath.Join(root, "parent"), "cgroup.subtree_control", "+cpu +pids"},
+		{path, "cgroup.type", "threaded"},
+	} {
+		data, err := h.ReadFile(f.dir, f.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data != f.expected {
+			t.Errorf("expected %s of %s to be %q, got %q", f.file, f.dir, f.expected, data)
+		}
+	}
+
+	// Threaded siblings are fine, but domain ones are not, as they would
+	// turn "domain invalid".
+	if err := h.WriteFile(filepath.Join(root, "parent"), "cgroup.subtree_control", "cpu pids"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createCgroupPath(h, h, filepath.Join(root, "parent", "more"), c); err != nil {
+		t.Fatal(err)
+	}
+	domain := filepath.Join(root, "parent", "domain")
+	if err := os.Mkdir(domain, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.WriteFile(domain, "cgroup.type", "domain\n"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createCgroupPath(h, h, filepath.Join(root, "parent", "others"), c); err == nil {
+		t.Fatal("expected an error for a cgroup with domain siblings")
+	}
+	if err := os.RemoveAll(domain); err != nil {
+		t.Fatal(err)
+	}
+
+	// A parent with domain controllers enabled is rejected.
+	if err := h.WriteFile(filepath.Join(root, "parent"), "cgroup.subtree_control", "cpu memory"); err != nil {
+		t.Fatal(err)
+	}
+	if err := createCgroupPath(h, h, filepath.Join(root, "parent", "more"), c); err == nil {
+		t.Fatal("expected an error for a parent with domain controllers")
+	}
+}
+
+func TestThreads(t *testing.T) {
+	// We're using a fake cgroupfs.
+	cgroups.TestMode = true
+	fakeCgroupDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(fakeCgroupDir, cgroups.CgroupThreads), []byte("1234\n1235\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &manager{config: &configs.Cgroup{}, dirPath: fakeCgroupDir}
+	tids, err := m.GetThreads()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []int{1234, 1235}; !reflect.DeepEqual(tids, expected) {
+		t.Errorf("expected threads %v, got %v", expected, tids)
+	}
+
+	if err := m.AddThread(1236); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(fakeCgroupDir, cgroups.CgroupThreads))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "1236" {
+		t.Errorf("expected thread 1236 to be written, got %q", data)
+	}
+}
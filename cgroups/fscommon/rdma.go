@@ -45,9 +45,9 @@ func parseRdmaKV(raw string, entry *cgroups.RdmaEntry) error {
 
 // readRdmaEntries reads and converts array of rawstrings to RdmaEntries from file.
 // example entry: mlx4_0 hca_handle=2 hca_object=2000
-func readRdmaEntries(dir, file string) ([]cgroups.RdmaEntry, error) {
+func readRdmaEntries(h *cgroups.Host, dir, file string) ([]cgroups.RdmaEntry, error) {
 	rdmaEntries := make([]cgroups.RdmaEntry, 0)
-	fd, err := cgroups.OpenFile(dir, file, unix.O_RDONLY)
+	fd, err := h.OpenFile(dir, file, unix.O_RDONLY)
 	if err != nil {
 		return nil, err
 	}
@@ -75,14 +75,19 @@ func readRdmaEntries(dir, file string) ([]cgroups.RdmaEntry, error) {
 
 // RdmaGetStats returns rdma stats such as totalLimit and current entries.
 func RdmaGetStats(path string, stats *cgroups.Stats) error {
-	currentEntries, err := readRdmaEntries(path, "rdma.current")
+	return RdmaGetStatsFrom(nil, path, stats)
+}
+
+// RdmaGetStatsFrom is like RdmaGetStats, but reads the files of the host h.
+func RdmaGetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error {
+	currentEntries, err := readRdmaEntries(h, path, "rdma.current")
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			err = nil
 		}
 		return err
 	}
-	maxEntries, err := readRdmaEntries(path, "rdma.max")
+	maxEntries, err := readRdmaEntries(h, path, "rdma.max")
 	if err != nil {
 		return err
 	}
@@ -112,10 +117,27 @@ func createCmdString(device string, limits configs.LinuxRdma) string {
 
 // RdmaSet sets RDMA resources.
 func RdmaSet(path string, r *configs.Resources) error {
+	return RdmaSetTo(cgroups.Cgroupfs, path, r)
+}
+
+// RdmaSetTo is like RdmaSet, but uses w to write the cgroup files.
+func RdmaSetTo(w cgroups.FileWriter, path string, r *configs.Resources) error {
 	for device, limits := range r.Rdma {
-		if err := cgroups.WriteFile(path, "rdma.max", createCmdString(device, limits)); err != nil {
+		if err := w.WriteFile(path, "rdma.max", createCmdString(device, limits)); err != nil {
 			return err
 		}
 	}
 	return nil
 }
+
+// RdmaSnapshot records the RDMA resources to be modified by RdmaSet.
+func RdmaSnapshot(s *cgroups.Snapshot, path string, r *configs.Resources) error {
+	if len(r.Rdma) == 0 {
+		return nil
+	}
+	devices := make([]string, 0, len(r.Rdma))
+	for device := range r.Rdma {
+		devices = append(devices, device)
+	}
+	return s.SaveKeyed(path, "rdma.max", devices, "hca_handle=max hca_object=max")
+}
@@ -41,7 +41,7 @@ func TestRdmaSet(t *testing.T) {
 	}
 
 	// The default rdma.max must be written.
-	rdmaEntries, err := readRdmaEntries(testCgroupPath, "rdma.max")
+	rdmaEntries, err := readRdmaEntries(nil, testCgroupPath, "rdma.max")
 	if err != nil {
 		t.Fatal(err)
 	}
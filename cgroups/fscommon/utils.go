@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"os"
 	"path"
 	"strconv"
 	"strings"
@@ -76,7 +77,12 @@ func ParseKeyValue(t string) (string, uint64, error) {
 // and returns a value of the specified key. ParseUint is used for value
 // conversion.
 func GetValueByKey(path, file, key string) (uint64, error) {
-	content, err := cgroups.ReadFile(path, file)
+	return GetValueByKeyFrom(nil, path, file, key)
+}
+
+// GetValueByKeyFrom is like GetValueByKey, but reads the file of the host h.
+func GetValueByKeyFrom(h *cgroups.Host, path, file, key string) (uint64, error) {
+	content, err := h.ReadFile(path, file)
 	if err != nil {
 		return 0, err
 	}
@@ -99,7 +105,12 @@ func GetValueByKey(path, file, key string) (uint64, error) {
 // GetCgroupParamUint reads a single uint64 value from the specified cgroup file.
 // If the value read is "max", the math.MaxUint64 is returned.
 func GetCgroupParamUint(path, file string) (uint64, error) {
-	contents, err := GetCgroupParamString(path, file)
+	return GetCgroupParamUintFrom(nil, path, file)
+}
+
+// GetCgroupParamUintFrom is like GetCgroupParamUint, but reads the file of the host h.
+func GetCgroupParamUintFrom(h *cgroups.Host, path, file string) (uint64, error) {
+	contents, err := GetCgroupParamStringFrom(h, path, file)
 	if err != nil {
 		return 0, err
 	}
@@ -115,10 +126,35 @@ func GetCgroupParamUint(path, file string) (uint64, error) {
 	return res, nil
 }
 
+// GetCgroupParamLimit reads a limit value from the specified cgroup file,
+// returning it in the format used by configs.Resources, i.e. -1 means
+// "unlimited". Both "max" (cgroup v2) and the huge page-aligned values
+// used by cgroup v1 to denote no limit are converted to -1.
+func GetCgroupParamLimit(path, file string) (int64, error) {
+	return GetCgroupParamLimitFrom(nil, path, file)
+}
+
+// GetCgroupParamLimitFrom is like GetCgroupParamLimit, but reads the file of the host h.
+func GetCgroupParamLimitFrom(h *cgroups.Host, path, file string) (int64, error) {
+	value, err := GetCgroupParamUintFrom(h, path, file)
+	if err != nil {
+		return 0, err
+	}
+	if value >= uint64(math.MaxInt64)&^uint64(os.Getpagesize()-1) {
+		return -1, nil
+	}
+	return int64(value), nil
+}
+
 // GetCgroupParamInt reads a single int64 value from specified cgroup file.
 // If the value read is "max", the math.MaxInt64 is returned.
 func GetCgroupParamInt(path, file string) (int64, error) {
-	contents, err := cgroups.ReadFile(path, file)
+	return GetCgroupParamIntFrom(nil, path, file)
+}
+
+// GetCgroupParamIntFrom is like GetCgroupParamInt, but reads the file of the host h.
+func GetCgroupParamIntFrom(h *cgroups.Host, path, file string) (int64, error) {
+	contents, err := h.ReadFile(path, file)
 	if err != nil {
 		return 0, err
 	}
@@ -136,10 +172,64 @@ func GetCgroupParamInt(path, file string) (int64, error) {
 
 // GetCgroupParamString reads a string from the specified cgroup file.
 func GetCgroupParamString(path, file string) (string, error) {
-	contents, err := cgroups.ReadFile(path, file)
+	return GetCgroupParamStringFrom(nil, path, file)
+}
+
+// GetCgroupParamStringFrom is like GetCgroupParamString, but reads the file of the host h.
+func GetCgroupParamStringFrom(h *cgroups.Host, path, file string) (string, error) {
+	contents, err := h.ReadFile(path, file)
 	if err != nil {
 		return "", err
 	}
 
 	return strings.TrimSpace(contents), nil
 }
+
+// GetCgroupParamList reads a list of numbers in the cpuset list format
+// (such as "0-3,8") from the specified cgroup file.
+func GetCgroupParamList(path, file string) ([]uint16, error) {
+	return GetCgroupParamListFrom(nil, path, file)
+}
+
+// GetCgroupParamListFrom is like GetCgroupParamList, but reads the file of the host h.
+func GetCgroupParamListFrom(h *cgroups.Host, path, file string) ([]uint16, error) {
+	var extracted []uint16
+	fileContent, err := GetCgroupParamStringFrom(h, path, file)
+	if err != nil {
+		return extracted, err
+	}
+	if len(fileContent) == 0 {
+		return extracted, &ParseError{Path: path, File: file, Err: errors.New("empty file")}
+	}
+
+	for _, s := range strings.Split(fileContent, ",") {
+		sp := strings.SplitN(s, "-", 3)
+		switch len(sp) {
+		case 3:
+			return extracted, &ParseError{Path: path, File: file, Err: errors.New("extra dash")}
+		case 2:
+			min, err := strconv.ParseUint(sp[0], 10, 16)
+			if err != nil {
+				return extracted, &ParseError{Path: path, File: file, Err: err}
+			}
+			max, err := strconv.ParseUint(sp[1], 10, 16)
+			if err != nil {
+				return extracted, &ParseError{Path: path, File: file, Err: err}
+			}
+			if min > max {
+				return extracted, &ParseError{Path: path, File: file, Err: errors.New("invalid values, min > max")}
+			}
+			for i := min; i <= max; i++ {
+				extracted = append(extracted, uint16(i))
+			}
+		case 1:
+			value, err := strconv.ParseUint(s, 10, 16)
+			if err != nil {
+				return extracted, &ParseError{Path: path, File: file, Err: err}
+			}
+			extracted = append(extracted, uint16(value))
+		}
+	}
+
+	return extracted, nil
+}
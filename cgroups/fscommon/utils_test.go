@@ -93,3 +93,28 @@ func TestGetCgroupParamsInt(t *testing.T) {
 		t.Fatal("Expecting error, got none")
 	}
 }
+
+func TestGetCgroupParamLimit(t *testing.T) {
+	tempDir := t.TempDir()
+	tempFile := filepath.Join(tempDir, cgroupFile)
+
+	for data, expected := range map[string]int64{
+		"2048\n":                 2048,
+		"0":                      0,
+		"max\n":                  -1,
+		"9223372036854771712\n":  -1, // cgroup v1 "no limit" with 4k pages
+		"9223372036854775807\n":  -1,
+		"18446744073709551615\n": -1,
+	} {
+		if err := os.WriteFile(tempFile, []byte(data), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		value, err := GetCgroupParamLimit(tempDir, cgroupFile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != expected {
+			t.Errorf("%q: expected %d, got %d", data, expected, value)
+		}
+	}
+}
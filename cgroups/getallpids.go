@@ -1,13 +1,19 @@
 package cgroups
 
 import (
+	"errors"
 	"io/fs"
+	"os"
 	"path/filepath"
 )
 
 // GetAllPids returns all pids from the cgroup identified by path, and all its
 // sub-cgroups.
 func GetAllPids(path string) ([]int, error) {
+	return getAllPids(nil, path)
+}
+
+func getAllPids(b Backend, path string) ([]int, error) {
 	var pids []int
 	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, iErr error) error {
 		if iErr != nil {
@@ -16,7 +22,7 @@ func GetAllPids(path string) ([]int, error) {
 		if !d.IsDir() {
 			return nil
 		}
-		cPids, err := readProcsFile(p)
+		cPids, err := readProcsFile(b, p, CgroupProcesses)
 		if err != nil {
 			return err
 		}
@@ -25,3 +31,41 @@ func GetAllPids(path string) ([]int, error) {
 	})
 	return pids, err
 }
+
+// StatsTree is the statistics of a cgroup and all its sub-cgroups, as
+// returned by Manager.GetStatsTree, keyed by the cgroup path relative to
+// the top cgroup ("." for the top cgroup itself, "a/b" for its sub-cgroup
+// b of a).
+type StatsTree map[string]*Stats
+
+// GetSubCgroups returns the paths of the cgroup identified by path and all
+// its sub-cgroups, relative to path ("." being the first one). The cgroup
+// directories are read one at a time, so the number of files kept open
+// does not depend on the size of the subtree. The sub-cgroups removed
+// during the walk are skipped.
+func GetSubCgroups(path string) ([]string, error) {
+	var paths []string
+	err := filepath.WalkDir(path, func(p string, d fs.DirEntry, iErr error) error {
+		rel, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		if iErr != nil {
+			if p == path || !errors.Is(iErr, os.ErrNotExist) {
+				return iErr
+			}
+			// The sub-cgroup was removed in the meantime, possibly
+			// after being listed.
+			if n := len(paths); n > 0 && paths[n-1] == rel {
+				paths = paths[:n-1]
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	return paths, err
+}
@@ -1,6 +1,9 @@
 package cgroups
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 )
 
@@ -15,3 +18,49 @@ func BenchmarkGetAllPids(b *testing.B) {
 	}
 	b.Logf("iter: %d, total: %d", b.N, total)
 }
+
+func TestGetSubCgroupsRemoved(t *testing.T) {
+	root := t.TempDir()
+	for _, d := range []string{"a/b", "c"} {
+		if err := os.MkdirAll(filepath.Join(root, d), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Keep removing and recreating a sub-cgroup (with a sub-cgroup of
+	// its own) while walking, so that it is gone at some point during
+	// the walks.
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		dir := filepath.Join(root, "c", "d")
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			_ = os.MkdirAll(filepath.Join(dir, "e"), 0o755)
+			_ = os.RemoveAll(dir)
+		}
+	}()
+	defer func() {
+		close(stop)
+		<-done
+	}()
+
+	for i := 0; i < 2000; i++ {
+		paths, err := GetSubCgroups(root)
+		if err != nil {
+			t.Fatalf("walk %d: %v", i, err)
+		}
+		if len(paths) < 4 || paths[0] != "." {
+			t.Fatalf("walk %d: expected at least ., a, a/b and c, got %v", i, paths)
+		}
+	}
+
+	if _, err := GetSubCgroups(filepath.Join(root, "nonexistent")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ErrNotExist for a missing cgroup, got %v", err)
+	}
+}
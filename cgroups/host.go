@@ -0,0 +1,255 @@
+package cgroups
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// Backend performs the file operations on the cgroup filesystem of a Host.
+type Backend interface {
+	// OpenFile opens the cgroup file at path with given flags.
+	OpenFile(path string, flags int) (*os.File, error)
+	// Rmdir removes the cgroup directory at path. Like unix.Rmdir,
+	// it returns a bare errno, and fails with EBUSY if the cgroup
+	// has sub-cgroups.
+	Rmdir(path string) error
+}
+
+// Host is a cgroup filesystem: its mount root, the cgroup mode, and the
+// backend used for the file operations on it. Besides the host's own
+// cgroupfs (see DefaultHost), it can be one mounted elsewhere (such as
+// the host's cgroupfs bind-mounted into a monitoring container, see
+// NewHost), or a tree of regular files for testing (see NewDirHost).
+//
+// A Host is used by the managers created for it (see manager.NewWithHost),
+// and implements FileWriter. The methods of a nil *Host operate on the
+// default host.
+type Host struct {
+	// Root is the mount point of the cgroup filesystem. For cgroup v1,
+	// it is the directory containing the per-controller hierarchies.
+	Root string
+	// Mode is the cgroup mode.
+	Mode Mode
+	// Backend performs the file operations. If nil, the files are
+	// opened in the same way as for the default host.
+	Backend Backend
+}
+
+// DefaultHost returns the host's cgroup filesystem at /sys/fs/cgroup.
+func DefaultHost() *Host {
+	return &Host{Root: unifiedMountpoint, Mode: getMode()}
+}
+
+// NewHost returns the cgroup filesystem mounted at root,
+// detecting its cgroup mode.
+func NewHost(root string) (*Host, error) {
+	root, err := checkRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if root == unifiedMountpoint {
+		return DefaultHost(), nil
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(root, &st); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: root, Err: err}
+	}
+	mode := Legacy
+	if st.Type == unix.CGROUP2_SUPER_MAGIC {
+		mode = Unified
+	} else if err := unix.Statfs(filepath.Join(root, "unified"), &st); err == nil && st.Type == unix.CGROUP2_SUPER_MAGIC {
+		mode = Hybrid
+	}
+	return &Host{Root: root, Mode: mode, Backend: cgroupfsBackend{}}, nil
+}
+
+// NewDirHost returns a Host backed by a tree of regular files at root
+// (such as a temporary directory), which emulates a cgroup filesystem
+// in the given mode: the files written to are created as needed, and
+// removing a cgroup removes its files. No privileges are needed to use
+// it, which makes it suitable for testing managers.
+//
+// As the files are not checked to be on a cgroup filesystem, root can
+// neither be on one nor contain /sys/fs/cgroup.
+func NewDirHost(root string, mode Mode) (*Host, error) {
+	if mode < Legacy || mode > Unified {
+		return nil, fmt.Errorf("invalid cgroup mode %d", mode)
+	}
+	root, err := checkRoot(root)
+	if err != nil {
+		return nil, err
+	}
+	if root == unifiedMountpoint {
+		return nil, fmt.Errorf("cgroup root %s is the host's cgroup filesystem", root)
+	}
+	var st unix.Statfs_t
+	if err := unix.Statfs(root, &st); err != nil {
+		return nil, &os.PathError{Op: "statfs", Path: root, Err: err}
+	}
+	if st.Type == unix.CGROUP_SUPER_MAGIC || st.Type == unix.CGROUP2_SUPER_MAGIC {
+		return nil, fmt.Errorf("cgroup root %s is on a cgroup filesystem", root)
+	}
+	return &Host{Root: root, Mode: mode, Backend: dirBackend{}}, nil
+}
+
+// checkRoot cleans the root of a Host, which must be an absolute path,
+// and can not contain the host's cgroup filesystem.
+func checkRoot(root string) (string, error) {
+	if !filepath.IsAbs(root) {
+		return "", fmt.Errorf("cgroup root %q is not an absolute path", root)
+	}
+	root = filepath.Clean(root)
+	if root != unifiedMountpoint && (root == "/" || strings.HasPrefix(unifiedMountpoint, root+"/")) {
+		return "", fmt.Errorf("cgroup root %s contains %s", root, unifiedMountpoint)
+	}
+	return root, nil
+}
+
+func (h *Host) backend() Backend {
+	if h == nil {
+		return nil
+	}
+	return h.Backend
+}
+
+// IsRoot returns whether path is the root cgroup of h (for cgroup v2).
+func (h *Host) IsRoot(path string) bool {
+	root := unifiedMountpoint
+	if h != nil {
+		root = h.Root
+	}
+	return filepath.Clean(path) == root
+}
+
+// OpenFile is like the OpenFile function, for a cgroup file of h.
+func (h *Host) OpenFile(dir, file string, flags int) (*os.File, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no directory specified for %s", file)
+	}
+	return openFile(h.backend(), dir, file, flags)
+}
+
+// ReadFile is like the ReadFile function, for a cgroup file of h.
+func (h *Host) ReadFile(dir, file string) (string, error) {
+	return readFile(h.backend(), dir, file)
+}
+
+// WriteFile is like the WriteFile function, for a cgroup file of h.
+func (h *Host) WriteFile(dir, file, data string) error {
+	return writeFile(h.backend(), dir, file, data)
+}
+
+// PathExists is like the PathExists function, for a cgroup
+// directory or file of h.
+func (h *Host) PathExists(path string) bool {
+	b := h.backend()
+	if b == nil {
+		return PathExists(path)
+	}
+	f, err := b.OpenFile(path, unix.O_PATH|unix.O_CLOEXEC)
+	if err != nil {
+		return false
+	}
+	f.Close()
+	return true
+}
+
+// Mkdir creates a cgroup directory of h (see FileWriter).
+func (h *Host) Mkdir(path string) error {
+	return os.Mkdir(path, 0o755)
+}
+
+// RemovePath is like the RemovePath function, for a cgroup of h.
+func (h *Host) RemovePath(path string) error {
+	return removePath(h.backend(), path)
+}
+
+// RemovePaths is like the RemovePaths function, for cgroups of h.
+func (h *Host) RemovePaths(paths map[string]string) error {
+	return removePaths(h.backend(), paths)
+}
+
+// GetPids is like the GetPids function, for a cgroup of h.
+func (h *Host) GetPids(dir string) ([]int, error) {
+	return readProcsFile(h.backend(), dir, CgroupProcesses)
+}
+
+// GetAllPids is like the GetAllPids function, for a cgroup of h.
+func (h *Host) GetAllPids(path string) ([]int, error) {
+	return getAllPids(h.backend(), path)
+}
+
+// GetThreads is like the GetThreads function, for a cgroup of h.
+func (h *Host) GetThreads(dir string) ([]int, error) {
+	return readProcsFile(h.backend(), dir, CgroupThreads)
+}
+
+// WriteCgroupProc is like the WriteCgroupProc function, for a cgroup of h.
+func (h *Host) WriteCgroupProc(dir string, pid int) error {
+	return writeCgroupProcs(h.backend(), dir, CgroupProcesses, pid)
+}
+
+// WriteCgroupThread is like the WriteCgroupThread function, for a cgroup of h.
+func (h *Host) WriteCgroupThread(dir string, tid int) error {
+	return writeCgroupProcs(h.backend(), dir, CgroupThreads, tid)
+}
+
+// WatchEvents is like the WatchEvents function, for a cgroup of h.
+func (h *Host) WatchEvents(ctx context.Context, dirPath string, types ...EventType) (<-chan Event, error) {
+	return watchEvents(ctx, h.backend(), dirPath, types...)
+}
+
+// WaitEmpty is like the WaitEmpty function, for a cgroup of h.
+func (h *Host) WaitEmpty(ctx context.Context, dirPath string) error {
+	return waitEmpty(ctx, h.backend(), dirPath)
+}
+
+// cgroupfsBackend is the Backend of a cgroupfs mounted elsewhere
+// than /sys/fs/cgroup.
+type cgroupfsBackend struct{}
+
+func (cgroupfsBackend) OpenFile(path string, flags int) (*os.File, error) {
+	return openFallback(path, flags, 0)
+}
+
+func (cgroupfsBackend) Rmdir(path string) error {
+	return unix.Rmdir(path)
+}
+
+// dirBackend is the Backend of a tree of regular files (see NewDirHost).
+type dirBackend struct{}
+
+func (dirBackend) OpenFile(path string, flags int) (*os.File, error) {
+	switch flags & (os.O_WRONLY | os.O_RDWR) {
+	case os.O_WRONLY:
+		flags |= os.O_TRUNC | os.O_CREATE
+	case os.O_RDWR:
+		// The value written is read back (e.g. cgroup.freeze),
+		// so the file is not truncated.
+		flags |= os.O_CREATE
+	}
+	return os.OpenFile(path, flags, 0o600)
+}
+
+func (dirBackend) Rmdir(path string) error {
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		var pe *os.PathError
+		if errors.As(err, &pe) {
+			return pe.Err
+		}
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			return unix.EBUSY
+		}
+	}
+	return os.RemoveAll(path)
+}
@@ -0,0 +1,48 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDirHost(t *testing.T) {
+	root := t.TempDir()
+	h, err := NewDirHost(root, Unified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Join(root, "a")
+	if h.IsRoot(dir) || !h.IsRoot(root+"/") {
+		t.Fatalf("expected %s (only) to be the root cgroup", root)
+	}
+
+	// Files are created on write, as in TestMode.
+	if err := os.MkdirAll(filepath.Join(dir, "b"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.WriteFile(dir, "pids.max", "10"); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := h.ReadFile(dir, "pids.max"); err != nil || data != "10" {
+		t.Fatalf("expected pids.max to be 10, got %q (%v)", data, err)
+	}
+	// The cgroup is removed along with its files and sub-cgroups.
+	if err := h.RemovePath(dir); err != nil {
+		t.Fatal(err)
+	}
+	if PathExists(dir) {
+		t.Fatalf("expected %s to be removed", dir)
+	}
+}
+
+func TestDirHostRoot(t *testing.T) {
+	for _, root := range []string{"", "tmp", "/", "/sys", "/sys/fs/", "/sys/fs/cgroup"} {
+		if _, err := NewDirHost(root, Unified); err == nil {
+			t.Errorf("expected an error for root %q", root)
+		}
+	}
+	if _, err := NewDirHost(t.TempDir(), Mode(42)); err == nil {
+		t.Error("expected an error for an invalid mode")
+	}
+}
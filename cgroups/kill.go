@@ -0,0 +1,61 @@
+package cgroups
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/configs"
+)
+
+// ErrNoFreezer is returned by FreezeAndKill if the cgroup can not be frozen.
+var ErrNoFreezer = errors.New("unable to signal the processes of a cgroup without freezing it: freezer not supported")
+
+// FreezeAndKill sends sig to every process in the cgroup managed by m,
+// including its sub-cgroups. To make sure no process escapes by forking
+// while the signal is being sent, the cgroup is frozen first, and thawed
+// afterwards (unless it was frozen before and sig is not SIGKILL, which
+// is not delivered to frozen processes on cgroup v1). If freezing is not
+// supported (i.e. the freezer state is Undefined), ErrNoFreezer is
+// returned, as the processes could escape by forking.
+//
+// It is used to implement Manager.Kill when cgroup.kill is not available
+// (cgroup v1, or kernel < 5.14), or the signal is not SIGKILL.
+func FreezeAndKill(m Manager, sig unix.Signal) error {
+	prevState, err := m.GetFreezerState()
+	if err != nil {
+		return err
+	}
+	if prevState == configs.Undefined {
+		return ErrNoFreezer
+	}
+	if err := m.Freeze(configs.Frozen); err != nil {
+		return fmt.Errorf("unable to freeze cgroup before signalling: %w", err)
+	}
+
+	err = signalAll(m, sig)
+
+	if prevState != configs.Frozen || sig == unix.SIGKILL {
+		if thawErr := m.Freeze(configs.Thawed); thawErr != nil && err == nil {
+			err = fmt.Errorf("unable to thaw cgroup after signalling: %w", thawErr)
+		}
+	}
+	return err
+}
+
+// signalAll sends sig to every process in the cgroup managed by m,
+// including its sub-cgroups.
+func signalAll(m Manager, sig unix.Signal) error {
+	pids, err := m.GetAllPids()
+	if err != nil {
+		return err
+	}
+	for _, pid := range pids {
+		// A process may have already exited.
+		if err := unix.Kill(pid, sig); err != nil && !errors.Is(err, unix.ESRCH) {
+			return fmt.Errorf("unable to signal pid %d: %w", pid, err)
+		}
+	}
+	return nil
+}
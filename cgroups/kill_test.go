@@ -0,0 +1,91 @@
+package cgroups_test
+
+import (
+	"errors"
+	"os/exec"
+	"reflect"
+	"testing"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/cgroups/fake"
+	"github.com/dims/libcontainer/configs"
+)
+
+// freezerCalls returns the states passed to m.Freeze, and the listings
+// of the processes (GetAllPids), in order.
+func freezerCalls(m *fake.Manager) []interface{} {
+	var calls []interface{}
+	for _, c := range m.Calls() {
+		switch c.Method {
+		case "Freeze":
+			calls = append(calls, c.Args[0])
+		case "GetAllPids":
+			calls = append(calls, c.Method)
+		}
+	}
+	return calls
+}
+
+func TestFreezeAndKill(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		sig      unix.Signal
+		setup    func(m *fake.Manager)
+		expected []interface{}
+		err      error
+	}{
+		{
+			name:     "thawed",
+			expected: []interface{}{configs.Frozen, "GetAllPids", configs.Thawed},
+		},
+		{
+			name: "frozen",
+			setup: func(m *fake.Manager) {
+				_ = m.Freeze(configs.Frozen)
+			},
+			// Left frozen.
+			expected: []interface{}{configs.Frozen, configs.Frozen, "GetAllPids"},
+		},
+		{
+			name: "frozen sigkill",
+			sig:  unix.SIGKILL,
+			setup: func(m *fake.Manager) {
+				_ = m.Freeze(configs.Frozen)
+			},
+			// Thawed, for SIGKILL to be delivered.
+			expected: []interface{}{configs.Frozen, configs.Frozen, "GetAllPids", configs.Thawed},
+		},
+		{
+			name:  "no freezer",
+			setup: (*fake.Manager).DisableFreezer,
+			err:   cgroups.ErrNoFreezer,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cmd := exec.Command("sleep", "60")
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				_ = cmd.Process.Kill()
+				_ = cmd.Wait()
+			})
+			m := fake.New(&configs.Cgroup{Path: "/test", Resources: &configs.Resources{}})
+			if err := m.Apply(cmd.Process.Pid); err != nil {
+				t.Fatal(err)
+			}
+			if tc.setup != nil {
+				tc.setup(m)
+			}
+			// Signal 0 only checks the process exists.
+			if err := cgroups.FreezeAndKill(m, tc.sig); !errors.Is(err, tc.err) {
+				t.Fatalf("expected error %v, got %v", tc.err, err)
+			}
+			if calls := freezerCalls(m); !reflect.DeepEqual(calls, tc.expected) {
+				t.Fatalf("expected %v, got %v", tc.expected, calls)
+			}
+		})
+	}
+}
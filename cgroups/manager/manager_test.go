@@ -1,8 +1,12 @@
 package manager
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/dims/libcontainer/cgroups"
 	"github.com/dims/libcontainer/cgroups/systemd"
 	"github.com/dims/libcontainer/configs"
 )
@@ -40,16 +44,135 @@ func testNilResources(t *testing.T, systemd bool) {
 			t.Fatal(err)
 		}
 	}
+	_, _ = mgr.PlanApply(-1)
 	_ = mgr.Apply(-1)
+	_, _ = mgr.PlanSet(nil)
 	_ = mgr.Set(nil)
 	_ = mgr.Freeze(configs.Thawed)
 	_ = mgr.Exists()
 	_, _ = mgr.GetAllPids()
 	_, _ = mgr.GetCgroups()
+	_, _ = mgr.GetResources()
+	if child, err := mgr.NewChild("child", nil); err == nil {
+		_ = child.Destroy()
+	}
 	_, _ = mgr.GetFreezerState()
 	_ = mgr.Path("")
 	_ = mgr.GetPaths()
 	_, _ = mgr.GetStats()
+	_, _ = mgr.GetStatsTree()
 	_, _ = mgr.OOMKillCount()
+	_, _ = mgr.Reclaim(1, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if ch, err := mgr.NotifyOOM(ctx); err == nil {
+		for range ch { //nolint:revive // Wait for the channel to be closed.
+		}
+	}
 	_ = mgr.Destroy()
 }
+
+func TestNewWithHost(t *testing.T) {
+	for _, tc := range []struct {
+		mode  cgroups.Mode
+		dirs  []string
+		files map[string]string
+		pids  string // the cgroup directory of the pids controller
+	}{
+		{
+			mode: cgroups.Unified,
+			dirs: []string{"test"},
+			files: map[string]string{
+				"cgroup.controllers":      "cpu memory pids",
+				"cgroup.subtree_control":  "",
+				"test/cgroup.controllers": "pids",
+			},
+			pids: "test",
+		},
+		{
+			mode: cgroups.Legacy,
+			dirs: []string{"memory", "pids"},
+			pids: "pids/test",
+		},
+	} {
+		t.Run(tc.mode.String(), func(t *testing.T) {
+			root := t.TempDir()
+			for _, d := range tc.dirs {
+				if err := os.Mkdir(filepath.Join(root, d), 0o755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			for f, data := range tc.files {
+				if err := os.WriteFile(filepath.Join(root, f), []byte(data), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			h, err := cgroups.NewDirHost(root, tc.mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cg := &configs.Cgroup{
+				Path:      "/test",
+				Resources: &configs.Resources{SkipDevices: true},
+			}
+			mgr, err := NewWithHost(h, cg, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := mgr.Apply(-1); err != nil {
+				t.Fatal(err)
+			}
+			if err := mgr.Set(&configs.Resources{PidsLimit: 10, SkipDevices: true}); err != nil {
+				t.Fatal(err)
+			}
+			dir := filepath.Join(root, tc.pids)
+			if data, err := h.ReadFile(dir, "pids.max"); err != nil || data != "10" {
+				t.Fatalf("expected pids.max to be set to 10, got %q (%v)", data, err)
+			}
+			if err := mgr.Destroy(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(dir); !os.IsNotExist(err) {
+				t.Fatalf("expected %s to be removed, got %v", dir, err)
+			}
+
+			cg.Systemd = true
+			if _, err := NewWithHost(h, cg, nil); err == nil {
+				t.Fatal("expected an error for the systemd manager")
+			}
+		})
+	}
+}
+
+func TestThreadManager(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu pids"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h, err := cgroups.NewDirHost(root, cgroups.Unified)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mgr, err := NewWithHost(h, &configs.Cgroup{
+		Path:      "/test/threads",
+		Threaded:  true,
+		Resources: &configs.Resources{SkipDevices: true},
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mgr.Apply(-1); err != nil {
+		t.Fatal(err)
+	}
+	tm, ok := mgr.(cgroups.ThreadManager)
+	if !ok {
+		t.Fatalf("expected %T to implement cgroups.ThreadManager", mgr)
+	}
+	if err := tm.AddThread(1234); err != nil {
+		t.Fatal(err)
+	}
+	if tids, err := tm.GetThreads(); err != nil || len(tids) != 1 || tids[0] != 1234 {
+		t.Fatalf("expected thread 1234, got %v (%v)", tids, err)
+	}
+}
@@ -28,15 +28,17 @@ func New(config *configs.Cgroup) (cgroups.Manager, error) {
 // For cgroup v2, the only key allowed is "" (empty string), and the value
 // is the unified cgroup path.
 func NewWithPaths(config *configs.Cgroup, paths map[string]string) (cgroups.Manager, error) {
-	if config == nil {
-		return nil, errors.New("cgroups/manager.New: config must not be nil")
-	}
+	return NewWithHost(cgroups.DefaultHost(), config, paths)
+}
+
+// newDefault returns the manager for the default host h.
+func newDefault(h *cgroups.Host, config *configs.Cgroup, paths map[string]string) (cgroups.Manager, error) {
 	if config.Systemd && !systemd.IsRunningSystemd() {
 		return nil, errors.New("systemd not running on this host, cannot use systemd cgroups manager")
 	}
 
 	// Cgroup v2 aka unified hierarchy.
-	if cgroups.IsCgroup2UnifiedMode() {
+	if h.Mode == cgroups.Unified {
 		path, err := getUnifiedPath(paths)
 		if err != nil {
 			return nil, fmt.Errorf("manager.NewWithPaths: inconsistent paths: %w", err)
@@ -55,6 +57,39 @@ func NewWithPaths(config *configs.Cgroup, paths map[string]string) (cgroups.Mana
 	return fs.NewManager(config, paths)
 }
 
+// NewWithHost is similar to NewWithPaths, but for the cgroup filesystem of
+// the host h rather than the one at /sys/fs/cgroup (see cgroups.Host), with
+// the cgroup mode of h (rather than the one detected for /sys/fs/cgroup)
+// determining the manager used. The paths, if given, must be under h.Root.
+//
+// The systemd managers can only be used with the default host, which a
+// nil h stands for.
+func NewWithHost(h *cgroups.Host, config *configs.Cgroup, paths map[string]string) (cgroups.Manager, error) {
+	if config == nil {
+		return nil, errors.New("cgroups/manager.New: config must not be nil")
+	}
+	if h == nil {
+		h = cgroups.DefaultHost()
+	}
+	if h.Backend == nil && h.IsRoot("/sys/fs/cgroup") {
+		// The default host.
+		return newDefault(h, config, paths)
+	}
+	if config.Systemd {
+		return nil, fmt.Errorf("systemd cgroups manager can not be used with cgroup root %s", h.Root)
+	}
+
+	if h.Mode == cgroups.Unified {
+		path, err := getUnifiedPath(paths)
+		if err != nil {
+			return nil, fmt.Errorf("manager.NewWithHost: inconsistent paths: %w", err)
+		}
+		return fs2.NewHostManager(h, config, path)
+	}
+
+	return fs.NewHostManager(h, config, paths)
+}
+
 // getUnifiedPath is an implementation detail of libcontainer factory.
 // Historically, it saves cgroup paths as per-subsystem path map (as returned
 // by cm.GetPaths(""), but with v2 we only have one single unified path
@@ -0,0 +1,246 @@
+package cgroups
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// FileWriter makes changes to cgroupfs on behalf of Manager.Set and
+// Manager.Apply. The host's cgroupfs is changed via Cgroupfs (or the
+// *Host of the manager), while a *Plan records the changes instead of
+// making them.
+type FileWriter interface {
+	// Mkdir creates a cgroup directory. Like os.Mkdir, it returns
+	// an error matching os.ErrExist if the directory exists.
+	Mkdir(path string) error
+	// ReadFile reads data from a cgroup file in dir, reflecting
+	// any changes made through the FileWriter.
+	ReadFile(dir, file string) (string, error)
+	// WriteFile writes data to a cgroup file in dir.
+	WriteFile(dir, file, data string) error
+}
+
+type cgroupfs struct{}
+
+func (cgroupfs) Mkdir(path string) error {
+	return os.Mkdir(path, 0o755)
+}
+
+func (cgroupfs) ReadFile(dir, file string) (string, error) {
+	return ReadFile(dir, file)
+}
+
+func (cgroupfs) WriteFile(dir, file, data string) error {
+	return WriteFile(dir, file, data)
+}
+
+// Cgroupfs is the FileWriter which makes changes to the host's cgroupfs.
+var Cgroupfs FileWriter = cgroupfs{}
+
+// OpType is the type of an operation in a Plan.
+type OpType int
+
+const (
+	// OpMkdir creates the cgroup directory Path.
+	OpMkdir OpType = iota + 1
+	// OpWriteFile writes Value to File in the cgroup directory Path.
+	OpWriteFile
+	// OpAttachDeviceFilter attaches a device eBPF program (whose
+	// disassembly is Value) to the cgroup directory Path, replacing
+	// the one attached before.
+	OpAttachDeviceFilter
+	// OpStartUnit starts a transient systemd Unit with Properties.
+	OpStartUnit
+	// OpSetUnitProperties sets Properties of a systemd Unit.
+	OpSetUnitProperties
+)
+
+func (t OpType) String() string {
+	switch t {
+	case OpMkdir:
+		return "mkdir"
+	case OpWriteFile:
+		return "write"
+	case OpAttachDeviceFilter:
+		return "attach-device-filter"
+	case OpStartUnit:
+		return "start-unit"
+	case OpSetUnitProperties:
+		return "set-unit-properties"
+	}
+	return "unknown(" + strconv.Itoa(int(t)) + ")"
+}
+
+// UnitProperty is a systemd unit property, with its value formatted
+// in the GVariant text format (e.g. "uint64 1073741824").
+type UnitProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Op is a single operation in a Plan. Which fields are set depends on Type.
+type Op struct {
+	Type       OpType         `json:"type"`
+	Path       string         `json:"path,omitempty"`
+	File       string         `json:"file,omitempty"`
+	Value      string         `json:"value,omitempty"`
+	Unit       string         `json:"unit,omitempty"`
+	Properties []UnitProperty `json:"properties,omitempty"`
+}
+
+func (op Op) String() string {
+	switch op.Type {
+	case OpMkdir:
+		return op.Type.String() + " " + op.Path
+	case OpWriteFile:
+		return op.Type.String() + " " + filepath.Join(op.Path, op.File) + " " + strconv.Quote(op.Value)
+	case OpAttachDeviceFilter:
+		return op.Type.String() + " " + op.Path
+	}
+	props := make([]string, 0, len(op.Properties))
+	for _, p := range op.Properties {
+		props = append(props, p.Name+"="+p.Value)
+	}
+	return op.Type.String() + " " + op.Unit + " " + strings.Join(props, " ")
+}
+
+// Plan is the list of operations which Manager.Set or Manager.Apply
+// would perform, in order, as returned by Manager.PlanSet and
+// Manager.PlanApply.
+//
+// Plan implements FileWriter by recording the operations instead of
+// performing them. Reads reflect the recorded writes, and the files in
+// a directory which is yet to be created read as empty.
+type Plan struct {
+	Ops []Op
+	// Host is the cgroup filesystem the files not written to in the
+	// plan are read from (the default one if nil).
+	Host *Host
+
+	written map[string]string
+	created map[string]struct{}
+}
+
+// Add appends an operation to the plan.
+func (p *Plan) Add(op Op) {
+	p.Ops = append(p.Ops, op)
+}
+
+// Mkdir records the creation of a cgroup directory,
+// unless it exists already (or is to be created).
+func (p *Plan) Mkdir(dir string) error {
+	if _, ok := p.created[dir]; ok || p.Host.PathExists(dir) {
+		return &os.PathError{Op: "mkdir", Path: dir, Err: os.ErrExist}
+	}
+	if p.created == nil {
+		p.created = make(map[string]struct{})
+	}
+	p.created[dir] = struct{}{}
+	p.Add(Op{Type: OpMkdir, Path: dir})
+	return nil
+}
+
+// MarkCreated records that dir, along with any of its parents which
+// do not exist yet, is created by an operation already in the plan
+// (such as starting a systemd unit).
+func (p *Plan) MarkCreated(dir string) {
+	for ; !p.Host.PathExists(dir); dir = filepath.Dir(dir) {
+		if p.created == nil {
+			p.created = make(map[string]struct{})
+		}
+		p.created[dir] = struct{}{}
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+}
+
+// ReadFile returns the data last written to the file in the plan,
+// or reads it from cgroupfs if there is none.
+func (p *Plan) ReadFile(dir, file string) (string, error) {
+	if data, ok := p.written[path.Join(dir, file)]; ok {
+		return data, nil
+	}
+	if _, ok := p.created[dir]; ok {
+		return "", nil
+	}
+	return p.Host.ReadFile(dir, file)
+}
+
+// WriteFile records a write to a cgroup file. Like a real write, it
+// fails if the file does not exist in an existing directory, so that
+// the callers fall back to the alternatives they would actually use.
+func (p *Plan) WriteFile(dir, file, data string) error {
+	key := path.Join(dir, file)
+	if _, ok := p.written[key]; !ok {
+		if _, ok := p.created[dir]; !ok && !p.Host.PathExists(key) {
+			return &os.PathError{Op: "open", Path: key, Err: os.ErrNotExist}
+		}
+	}
+	if p.written == nil {
+		p.written = make(map[string]string)
+	}
+	p.written[key] = data
+	p.Add(Op{Type: OpWriteFile, Path: dir, File: file, Value: data})
+	return nil
+}
+
+// DryRun returns true, as the changes are only recorded in the plan
+// (see MakesChanges).
+func (p *Plan) DryRun() bool {
+	return true
+}
+
+// WriteCgroupProcTo is like WriteCgroupProc, but uses w to write the pid.
+func WriteCgroupProcTo(w FileWriter, dir string, pid int) error {
+	if p, ok := w.(*Plan); ok {
+		if pid == -1 {
+			return nil
+		}
+		return p.WriteFile(dir, CgroupProcesses, strconv.Itoa(pid))
+	}
+	if h, ok := w.(*Host); ok {
+		return h.WriteCgroupProc(dir, pid)
+	}
+	return WriteCgroupProc(dir, pid)
+}
+
+// FileWriterHost returns the cgroup filesystem w operates on, or nil for
+// the default one, for the operations which can not be done through w.
+func FileWriterHost(w FileWriter) *Host {
+	switch w := w.(type) {
+	case *Host:
+		return w
+	case *Plan:
+		return w.Host
+	}
+	return nil
+}
+
+// MakesChanges returns whether the changes done via w are actually
+// made, so that their results can be read back. It is false for the
+// FileWriters with a DryRun method returning true, such as *Plan.
+func MakesChanges(w FileWriter) bool {
+	d, ok := w.(interface{ DryRun() bool })
+	return !ok || !d.DryRun()
+}
+
+// MkdirAll is like os.MkdirAll, but uses w to create the directories.
+func MkdirAll(w FileWriter, dir string) error {
+	switch w.(type) {
+	case cgroupfs, *Host:
+		return os.MkdirAll(dir, 0o755)
+	}
+	if parent := filepath.Dir(dir); parent != dir {
+		if err := MkdirAll(w, parent); err != nil {
+			return err
+		}
+	}
+	if err := w.Mkdir(dir); err != nil && !os.IsExist(err) {
+		return err
+	}
+	return nil
+}
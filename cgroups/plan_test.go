@@ -0,0 +1,101 @@
+package cgroups
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/sys/unix"
+)
+
+func TestPlan(t *testing.T) {
+	TestMode = true
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte("max\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &Plan{}
+	// Writes reflect the existence of the file, as real ones do.
+	if err := p.WriteFile(dir, "cpu.max", "max"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ENOENT error, got %v", err)
+	}
+	if err := p.WriteFile(dir, "pids.max", "100"); err != nil {
+		t.Fatal(err)
+	}
+	// Reads reflect the planned writes.
+	if data, err := p.ReadFile(dir, "pids.max"); err != nil || data != "100" {
+		t.Fatalf("expected planned pids.max value, got %q (%v)", data, err)
+	}
+
+	if MakesChanges(p) || !MakesChanges(Cgroupfs) {
+		t.Fatal("expected only the plan not to make changes")
+	}
+	if err := p.Mkdir(dir); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected EEXIST error, got %v", err)
+	}
+	child := filepath.Join(dir, "a", "b")
+	if err := MkdirAll(p, child); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Mkdir(child); !errors.Is(err, os.ErrExist) {
+		t.Fatalf("expected EEXIST error for a planned directory, got %v", err)
+	}
+	// The files in a planned directory are empty and can be written.
+	if data, err := p.ReadFile(child, "cpuset.cpus"); err != nil || data != "" {
+		t.Fatalf("expected empty cpuset.cpus, got %q (%v)", data, err)
+	}
+	if err := WriteCgroupProcTo(p, child, 1234); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"write " + filepath.Join(dir, "pids.max") + ` "100"`,
+		"mkdir " + filepath.Join(dir, "a"),
+		"mkdir " + child,
+		"write " + filepath.Join(child, CgroupProcesses) + ` "1234"`,
+	}
+	if len(p.Ops) != len(expected) {
+		t.Fatalf("expected %d operations, got %v", len(expected), p.Ops)
+	}
+	for i, op := range p.Ops {
+		if op.String() != expected[i] {
+			t.Errorf("expected operation %q, got %q", expected[i], op.String())
+		}
+	}
+	// Nothing is changed.
+	if PathExists(filepath.Join(dir, "a")) {
+		t.Error("planned directory was created")
+	}
+	if data, err := ReadFile(dir, "pids.max"); err != nil || data != "max\n" {
+		t.Errorf("expected pids.max to be left as is, got %q (%v)", data, err)
+	}
+}
+
+// emptyBackend is a Backend of a cgroup filesystem with no files.
+type emptyBackend struct{}
+
+func (emptyBackend) OpenFile(path string, _ int) (*os.File, error) {
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+}
+
+func (emptyBackend) Rmdir(_ string) error {
+	return unix.ENOENT
+}
+
+func TestPlanHost(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte("max\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The existence of the files is checked on the host of the plan.
+	p := &Plan{Host: &Host{Root: dir, Mode: Unified, Backend: emptyBackend{}}}
+	if err := p.WriteFile(dir, "pids.max", "100"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected ENOENT error, got %v", err)
+	}
+	if err := p.Mkdir(dir); err != nil {
+		t.Fatal(err)
+	}
+}
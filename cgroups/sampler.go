@@ -0,0 +1,172 @@
+package cgroups
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// Sample is a statistics snapshot taken by a Sampler.
+type Sample struct {
+	Time  time.Time
+	Stats *Stats
+}
+
+// Window is the summary of a value over the samples in a time window,
+// as returned by Sampler.Window.
+type Window struct {
+	// N is the number of samples in the window.
+	N   int
+	Min float64
+	Max float64
+	Avg float64
+}
+
+// Sampler periodically takes statistics snapshots of a cgroup using
+// Manager.GetStats, and keeps the last ones, so that the consumers of
+// the statistics (e.g. several dashboards) share the cgroupfs reads.
+//
+// The samples are only taken after Start is called. The Sampler methods
+// can be called concurrently.
+type Sampler struct {
+	m        Manager
+	interval time.Duration
+
+	start   sync.Once
+	mu      sync.Mutex
+	samples []Sample // ring buffer
+	next    int      // index of the next sample in samples
+	full    bool
+	err     error
+	done    chan struct{}
+}
+
+// NewSampler returns a Sampler which takes a snapshot of the statistics of
+// the cgroup managed by m every interval, keeping the last depth ones.
+// The interval and depth must be positive.
+func NewSampler(m Manager, interval time.Duration, depth int) (*Sampler, error) {
+	if interval <= 0 {
+		return nil, fmt.Errorf("invalid sampling interval %v", interval)
+	}
+	if depth < 1 {
+		return nil, fmt.Errorf("invalid sampling depth %d", depth)
+	}
+	return &Sampler{
+		m:        m,
+		interval: interval,
+		samples:  make([]Sample, depth),
+		done:     make(chan struct{}),
+	}, nil
+}
+
+// Start starts taking samples on a goroutine, until ctx is done. The first
+// sample is taken right away. The calls after the first one do nothing.
+func (s *Sampler) Start(ctx context.Context) {
+	s.start.Do(func() {
+		go s.run(ctx)
+	})
+}
+
+func (s *Sampler) run(ctx context.Context) {
+	defer close(s.done)
+	t := time.NewTicker(s.interval)
+	defer t.Stop()
+	for {
+		s.sample()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// Done returns a channel which is closed once the Sampler
+// has stopped after its context is done.
+func (s *Sampler) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *Sampler) sample() {
+	stats, err := s.m.GetStats()
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+	if err != nil {
+		return
+	}
+	s.samples[s.next] = Sample{Time: now, Stats: stats}
+	s.next++
+	if s.next == len(s.samples) {
+		s.next = 0
+		s.full = true
+	}
+}
+
+// Err returns the error from the last GetStats call, if it failed.
+// The failed calls do not produce samples.
+func (s *Sampler) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Latest returns the last sample, or false if there is none yet.
+func (s *Sampler) Latest() (Sample, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.next == 0 && !s.full {
+		return Sample{}, false
+	}
+	i := s.next - 1
+	if i < 0 {
+		i = len(s.samples) - 1
+	}
+	return s.samples[i], true
+}
+
+// History returns the samples kept, oldest first.
+func (s *Sampler) History() []Sample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.history()
+}
+
+func (s *Sampler) history() []Sample {
+	if !s.full {
+		return append([]Sample(nil), s.samples[:s.next]...)
+	}
+	h := make([]Sample, 0, len(s.samples))
+	h = append(h, s.samples[s.next:]...)
+	return append(h, s.samples[:s.next]...)
+}
+
+// Window returns the minimum, maximum and average of a value, extracted
+// from the statistics by value (e.g. the memory usage), over the samples
+// taken in the last d, or over all the samples kept if d is 0. The value
+// function is called without the Sampler being locked.
+func (s *Sampler) Window(d time.Duration, value func(*Stats) float64) Window {
+	var (
+		w     = Window{Min: math.Inf(1), Max: math.Inf(-1)}
+		sum   float64
+		since = time.Now().Add(-d)
+	)
+	for _, sample := range s.History() {
+		if d > 0 && sample.Time.Before(since) {
+			continue
+		}
+		v := value(sample.Stats)
+		w.N++
+		w.Min = math.Min(w.Min, v)
+		w.Max = math.Max(w.Max, v)
+		sum += v
+	}
+	if w.N == 0 {
+		return Window{}
+	}
+	w.Avg = sum / float64(w.N)
+	return w
+}
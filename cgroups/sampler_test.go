@@ -0,0 +1,103 @@
+package cgroups
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// statsManager is a Manager returning the memory usage increasing by one
+// with every GetStats call, or errors once n reaches failAt.
+type statsManager struct {
+	Manager
+	n      uint64
+	failAt uint64
+}
+
+func (m *statsManager) GetStats() (*Stats, error) {
+	m.n++
+	if m.failAt != 0 && m.n >= m.failAt {
+		return nil, errors.New("injected")
+	}
+	s := NewStats()
+	s.MemoryStats.Usage.Usage = m.n
+	return s, nil
+}
+
+func memoryUsage(s *Stats) float64 {
+	return float64(s.MemoryStats.Usage.Usage)
+}
+
+func TestSamplerRing(t *testing.T) {
+	m := &statsManager{failAt: 6}
+	s, err := NewSampler(m, time.Hour, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Latest(); ok {
+		t.Fatal("expected no sample before the first one is taken")
+	}
+	for i := 0; i < 5; i++ {
+		s.sample()
+	}
+
+	h := s.History()
+	if len(h) != 3 {
+		t.Fatalf("expected 3 samples, got %d", len(h))
+	}
+	for i, sample := range h {
+		if got := sample.Stats.MemoryStats.Usage.Usage; got != uint64(i+3) {
+			t.Errorf("expected sample %d to have usage %d, got %d", i, i+3, got)
+		}
+	}
+	if w := s.Window(0, memoryUsage); w != (Window{N: 3, Min: 3, Max: 5, Avg: 4}) {
+		t.Errorf("unexpected window %+v", w)
+	}
+	// The value function can use the Sampler.
+	w := s.Window(0, func(st *Stats) float64 {
+		latest, _ := s.Latest()
+		return memoryUsage(st) - memoryUsage(latest.Stats)
+	})
+	if w != (Window{N: 3, Min: -2, Max: 0, Avg: -1}) {
+		t.Errorf("unexpected window %+v", w)
+	}
+
+	// A failed call is reported, and keeps the samples.
+	s.sample()
+	if s.Err() == nil {
+		t.Error("expected an error")
+	}
+	if latest, ok := s.Latest(); !ok || latest.Stats.MemoryStats.Usage.Usage != 5 {
+		t.Errorf("expected the latest sample to have usage 5, got %+v", latest)
+	}
+}
+
+func TestSamplerStart(t *testing.T) {
+	if _, err := NewSampler(&statsManager{}, 0, 10); err == nil {
+		t.Fatal("expected an error for a zero interval")
+	}
+	if _, err := NewSampler(&statsManager{}, time.Millisecond, 0); err == nil {
+		t.Fatal("expected an error for a zero depth")
+	}
+	s, err := NewSampler(&statsManager{}, time.Millisecond, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	s.Start(ctx)
+	// Only the first call starts sampling.
+	s.Start(ctx)
+	for {
+		if w := s.Window(time.Minute, memoryUsage); w.N >= 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	select {
+	case <-s.Done():
+	case <-time.After(10 * time.Second):
+		t.Fatal("sampler did not stop")
+	}
+}
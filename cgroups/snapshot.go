@@ -0,0 +1,132 @@
+package cgroups
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// Snapshot records the contents of cgroup files before they are modified,
+// so that they can be restored if an update fails halfway through.
+// The zero value is an empty snapshot, ready to use.
+type Snapshot struct {
+	// Host is the cgroup filesystem of the files (the default one if nil).
+	Host *Host
+
+	saved map[string]struct{}
+	undo  []func() error
+}
+
+// Save records the current contents of the given files in dir, unless
+// they were already recorded. Files which do not exist are skipped.
+func (s *Snapshot) Save(dir string, files ...string) error {
+	for _, file := range files {
+		lines, err := s.read(dir, file)
+		if err != nil {
+			return err
+		}
+		if lines == nil {
+			continue
+		}
+		s.Add(func() error {
+			return s.writeLines(dir, file, lines)
+		})
+	}
+	return nil
+}
+
+// SaveKeyed is like Save, but for a file which has a line per key (such
+// as io.max, which has a line per device), where keys with no value set
+// are not listed. As writing the old lines back does not remove the keys
+// added since, each of keys not currently listed is reset on restore by
+// writing "<key> <reset>" to the file.
+func (s *Snapshot) SaveKeyed(dir, file string, keys []string, reset string) error {
+	lines, err := s.read(dir, file)
+	if err != nil || lines == nil {
+		return err
+	}
+	var entries []string
+	listed := make(map[string]struct{}, len(lines))
+	for _, line := range lines {
+		if key, _, ok := strings.Cut(line, " "); ok {
+			listed[key] = struct{}{}
+			entries = append(entries, line)
+		}
+	}
+	var resets []string
+	for _, key := range keys {
+		if _, ok := listed[key]; !ok {
+			listed[key] = struct{}{}
+			resets = append(resets, key+" "+reset)
+		}
+	}
+	s.Add(func() error {
+		if err := s.writeLines(dir, file, resets); err != nil {
+			return err
+		}
+		return s.writeLines(dir, file, entries)
+	})
+	return nil
+}
+
+// read returns the lines of a file to be recorded, or nil if
+// the file does not exist or was already recorded.
+func (s *Snapshot) read(dir, file string) ([]string, error) {
+	key := path.Join(dir, file)
+	if _, ok := s.saved[key]; ok {
+		return nil, nil
+	}
+	data, err := s.Host.ReadFile(dir, file)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if s.saved == nil {
+		s.saved = make(map[string]struct{})
+	}
+	s.saved[key] = struct{}{}
+	// An empty file results in a single empty line, which
+	// is written back as is (e.g. an empty cpuset.cpus).
+	return strings.Split(strings.TrimSuffix(data, "\n"), "\n"), nil
+}
+
+// Add records a custom function to undo a change which can not be
+// restored by writing back the file contents (e.g. device rules).
+func (s *Snapshot) Add(undo func() error) {
+	s.undo = append(s.undo, undo)
+}
+
+// Restore undoes the recorded changes, in the reverse order they were
+// recorded. As the kernel may reject a value until a related one is
+// restored (e.g. memory.limit_in_bytes can not exceed
+// memory.memsw.limit_in_bytes), the steps which failed are retried
+// once after all the others are done.
+func (s *Snapshot) Restore() error {
+	var failed []func() error
+	for i := len(s.undo) - 1; i >= 0; i-- {
+		if err := s.undo[i](); err != nil {
+			failed = append(failed, s.undo[i])
+		}
+	}
+	var errs []error
+	for _, undo := range failed {
+		if err := undo(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// writeLines writes the lines to a cgroup file one by one, as the
+// kernel only accepts a single entry (e.g. a device limit) per write.
+func (s *Snapshot) writeLines(dir, file string, lines []string) error {
+	for _, line := range lines {
+		if err := s.Host.WriteFile(dir, file, line+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package cgroups
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	TestMode = true
+	dir := t.TempDir()
+
+	for file, data := range map[string]string{
+		"pids.max": "max\n",
+		"io.max":   "8:0 rbps=1024 wbps=max riops=max wiops=max\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s := &Snapshot{}
+	if err := s.Save(dir, "cpu.max", "pids.max"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SaveKeyed(dir, "io.max", []string{"8:0", "8:16"}, "rbps=max"); err != nil {
+		t.Fatal(err)
+	}
+	// Files are only recorded once.
+	if err := s.Save(dir, "pids.max"); err != nil {
+		t.Fatal(err)
+	}
+
+	var undone bool
+	s.Add(func() error {
+		undone = true
+		return nil
+	})
+
+	if err := WriteFile(dir, "pids.max", "100"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Restore(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !undone {
+		t.Error("expected a custom undo function to be called")
+	}
+	for file, expected := range map[string]string{
+		"pids.max": "max\n",
+		// A fake cgroupfs is rewritten on every write, so only the last
+		// line is left, which shows the new device was reset first.
+		"io.max": "8:0 rbps=1024 wbps=max riops=max wiops=max\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != expected {
+			t.Errorf("expected %s to contain %q, got %q", file, expected, data)
+		}
+	}
+	// cpu.max did not exist, so it is not restored.
+	if _, err := os.Stat(filepath.Join(dir, "cpu.max")); !os.IsNotExist(err) {
+		t.Errorf("expected cpu.max not to be created, got %v", err)
+	}
+}
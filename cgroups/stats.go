@@ -7,6 +7,10 @@ type ThrottlingData struct {
 	ThrottledPeriods uint64 `json:"throttled_periods,omitempty"`
 	// Aggregate time the container was throttled for in nanoseconds.
 	ThrottledTime uint64 `json:"throttled_time,omitempty"`
+	// Number of periods when the container used burst capacity.
+	BurstsPeriods uint64 `json:"bursts_periods,omitempty"`
+	// Aggregate time the container spent in bursts in nanoseconds.
+	BurstTime uint64 `json:"burst_time,omitempty"`
 }
 
 // CpuUsage denotes the usage of a CPU.
@@ -32,9 +36,32 @@ type CpuUsage struct {
 	UsageInUsermode uint64 `json:"usage_in_usermode"`
 }
 
+type PSIData struct {
+	// Share of time, in percent, that tasks were stalled
+	// over the last 10, 60 and 300 seconds.
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	// Total stall time.
+	// Units: microseconds.
+	Total uint64 `json:"total"`
+}
+
+// PSIStats holds Pressure Stall Information, as read from cgroup v2
+// *.pressure files. "Some" is the time at least one task was stalled,
+// "Full" is the time all non-idle tasks were stalled simultaneously.
+type PSIStats struct {
+	Some PSIData `json:"some,omitempty"`
+	Full PSIData `json:"full,omitempty"`
+}
+
 type CpuStats struct {
 	CpuUsage       CpuUsage       `json:"cpu_usage,omitempty"`
 	ThrottlingData ThrottlingData `json:"throttling_data,omitempty"`
+	// CPU pressure (cgroup v2 only).
+	PSI *PSIStats `json:"psi,omitempty"`
+	// IRQ/softirq pressure (cgroup v2 only). Only Full is reported.
+	IRQPSI *PSIStats `json:"irq_psi,omitempty"`
 }
 
 type CPUSetStats struct {
@@ -62,6 +89,9 @@ type CPUSetStats struct {
 	SchedLoadBalance uint64 `json:"sched_load_balance"`
 	// sched_relax_domain_level
 	SchedRelaxDomainLevel int64 `json:"sched_relax_domain_level"`
+	// partition type and state, e.g. "root" or "isolated invalid (...)"
+	// (cgroup v2 only)
+	Partition string `json:"partition,omitempty"`
 }
 
 type MemoryData struct {
@@ -91,6 +121,103 @@ type MemoryStats struct {
 	UseHierarchy bool `json:"use_hierarchy"`
 
 	Stats map[string]uint64 `json:"stats,omitempty"`
+	// memory.stat in typed form (cgroup v2 only)
+	StatsV2 *MemoryStatV2 `json:"stats_v2,omitempty"`
+	// memory cgroup event counters
+	Events MemoryEvents `json:"events,omitempty"`
+	// memory pressure (cgroup v2 only)
+	PSI *PSIStats `json:"psi,omitempty"`
+}
+
+// MemoryEvents holds the memory cgroup event counters. The top level
+// contains the hierarchical counters (memory.events on cgroup v2), and
+// Local contains the counters for this cgroup only (memory.events.local,
+// cgroup v2 and kernel 5.2+ only).
+//
+// On cgroup v1, only Max (memory.failcnt), OOMKill and UnderOOM (both from
+// memory.oom_control) are filled in.
+type MemoryEvents struct {
+	// The hierarchical counters are embedded, so that the ones of
+	// memory.events.local (Local) have the same fields.
+	MemoryEventsInner
+	Local MemoryEventsInner `json:"local,omitempty"`
+	// UnderOOM is true if the cgroup is currently under OOM
+	// (cgroup v1 only, with the OOM killer disabled).
+	UnderOOM bool `json:"under_oom,omitempty"`
+}
+
+// MemoryEventsInner are the counters of a memory.events or
+// memory.events.local file (see MemoryEvents).
+type MemoryEventsInner struct {
+	// number of times the cgroup was reclaimed while under memory.low
+	Low uint64 `json:"low,omitempty"`
+	// number of times processes were throttled and routed to
+	// direct reclaim because memory.high was exceeded
+	High uint64 `json:"high,omitempty"`
+	// number of times the usage was about to go over the limit
+	Max uint64 `json:"max,omitempty"`
+	// number of times the usage hit the limit and allocation failed
+	OOM uint64 `json:"oom,omitempty"`
+	// number of processes killed by the OOM killer
+	OOMKill uint64 `json:"oom_kill,omitempty"`
+	// number of times a group OOM (memory.oom.group) has occurred
+	OOMGroupKill uint64 `json:"oom_group_kill,omitempty"`
+}
+
+// MemoryStatV2 is the content of the cgroup v2 memory.stat file (see
+// Documentation/admin-guide/cgroup-v2.rst). The amounts of memory are in
+// bytes, and the events are counters. The fields not reported by the
+// kernel (e.g. the ones added in newer versions) are 0.
+type MemoryStatV2 struct {
+	Anon                   uint64 `json:"anon"`
+	File                   uint64 `json:"file"`
+	Kernel                 uint64 `json:"kernel"`
+	KernelStack            uint64 `json:"kernel_stack"`
+	Pagetables             uint64 `json:"pagetables"`
+	SecPagetables          uint64 `json:"sec_pagetables"`
+	Percpu                 uint64 `json:"percpu"`
+	Sock                   uint64 `json:"sock"`
+	Vmalloc                uint64 `json:"vmalloc"`
+	Shmem                  uint64 `json:"shmem"`
+	Zswap                  uint64 `json:"zswap"`
+	Zswapped               uint64 `json:"zswapped"`
+	FileMapped             uint64 `json:"file_mapped"`
+	FileDirty              uint64 `json:"file_dirty"`
+	FileWriteback          uint64 `json:"file_writeback"`
+	Swapcached             uint64 `json:"swapcached"`
+	AnonThp                uint64 `json:"anon_thp"`
+	FileThp                uint64 `json:"file_thp"`
+	ShmemThp               uint64 `json:"shmem_thp"`
+	InactiveAnon           uint64 `json:"inactive_anon"`
+	ActiveAnon             uint64 `json:"active_anon"`
+	InactiveFile           uint64 `json:"inactive_file"`
+	ActiveFile             uint64 `json:"active_file"`
+	Unevictable            uint64 `json:"unevictable"`
+	SlabReclaimable        uint64 `json:"slab_reclaimable"`
+	SlabUnreclaimable      uint64 `json:"slab_unreclaimable"`
+	Slab                   uint64 `json:"slab"`
+	WorkingsetRefaultAnon  uint64 `json:"workingset_refault_anon"`
+	WorkingsetRefaultFile  uint64 `json:"workingset_refault_file"`
+	WorkingsetActivateAnon uint64 `json:"workingset_activate_anon"`
+	WorkingsetActivateFile uint64 `json:"workingset_activate_file"`
+	WorkingsetRestoreAnon  uint64 `json:"workingset_restore_anon"`
+	WorkingsetRestoreFile  uint64 `json:"workingset_restore_file"`
+	WorkingsetNodereclaim  uint64 `json:"workingset_nodereclaim"`
+	Pgscan                 uint64 `json:"pgscan"`
+	Pgsteal                uint64 `json:"pgsteal"`
+	PgscanKswapd           uint64 `json:"pgscan_kswapd"`
+	PgscanDirect           uint64 `json:"pgscan_direct"`
+	PgstealKswapd          uint64 `json:"pgsteal_kswapd"`
+	PgstealDirect          uint64 `json:"pgsteal_direct"`
+	Pgfault                uint64 `json:"pgfault"`
+	Pgmajfault             uint64 `json:"pgmajfault"`
+	Pgrefill               uint64 `json:"pgrefill"`
+	Pgactivate             uint64 `json:"pgactivate"`
+	Pgdeactivate           uint64 `json:"pgdeactivate"`
+	Pglazyfree             uint64 `json:"pglazyfree"`
+	Pglazyfreed            uint64 `json:"pglazyfreed"`
+	ThpFaultAlloc          uint64 `json:"thp_fault_alloc"`
+	ThpCollapseAlloc       uint64 `json:"thp_collapse_alloc"`
 }
 
 type PageUsageByNUMA struct {
@@ -123,6 +250,9 @@ type BlkioStatEntry struct {
 	Minor uint64 `json:"minor,omitempty"`
 	Op    string `json:"op,omitempty"`
 	Value uint64 `json:"value,omitempty"`
+	// Device is the name of the block device, e.g. "sda"; only
+	// set by blockdev.Resolver.Decorate.
+	Device string `json:"device,omitempty"`
 }
 
 type BlkioStats struct {
@@ -135,6 +265,8 @@ type BlkioStats struct {
 	IoMergedRecursive       []BlkioStatEntry `json:"io_merged_recursive,omitempty"`
 	IoTimeRecursive         []BlkioStatEntry `json:"io_time_recursive,omitempty"`
 	SectorsRecursive        []BlkioStatEntry `json:"sectors_recursive,omitempty"`
+	// io pressure (cgroup v2 only)
+	PSI *PSIStats `json:"psi,omitempty"`
 }
 
 type HugetlbStats struct {
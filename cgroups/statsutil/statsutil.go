@@ -0,0 +1,200 @@
+// Package statsutil computes rates and derived metrics from the cumulative
+// statistics returned by cgroups.Manager.GetStats.
+package statsutil
+
+import (
+	"errors"
+	"time"
+
+	"github.com/dims/libcontainer/cgroups"
+)
+
+// Rates are the rates and metrics computed by Compute from two statistics
+// snapshots of a cgroup. All the rates are per second.
+type Rates struct {
+	// Interval is the time between the snapshots.
+	Interval time.Duration `json:"interval"`
+	// Reset is set if any of the counters went backwards between the
+	// snapshots, e.g. because the cgroup was re-created. Like Prometheus
+	// does, the value of such a counter in the second snapshot is taken
+	// as its increase, which may make the rate lower than the actual one.
+	Reset bool `json:"reset,omitempty"`
+
+	CPU    CPURates      `json:"cpu"`
+	Memory MemoryMetrics `json:"memory"`
+	IO     IORates       `json:"io"`
+}
+
+// CPURates are the CPU usage rates.
+type CPURates struct {
+	// Usage is the average number of CPUs used, e.g. 1.5 for one and a
+	// half CPUs. It is the CPU percentage divided by 100.
+	Usage float64 `json:"usage"`
+	// User is the average number of CPUs used in user mode.
+	User float64 `json:"user"`
+	// System is the average number of CPUs used in kernel mode.
+	System float64 `json:"system"`
+	// ThrottledRatio is the share of the enforcement periods in which the
+	// cgroup was throttled, from 0 to 1.
+	ThrottledRatio float64 `json:"throttled_ratio"`
+	// ThrottledTime is the time the cgroup was throttled for, in seconds
+	// per second.
+	ThrottledTime float64 `json:"throttled_time"`
+}
+
+// Percent returns the CPU usage in percent of a single CPU.
+func (c CPURates) Percent() float64 {
+	return c.Usage * 100
+}
+
+// MemoryMetrics are the memory metrics derived from a statistics snapshot,
+// with the same meaning on cgroup v1 and v2. All sizes are in bytes.
+type MemoryMetrics struct {
+	// Usage is the memory usage, including the page cache.
+	Usage uint64 `json:"usage"`
+	// WorkingSet is the usage minus the inactive file-backed memory, as
+	// reported by the kubelet (and used for its eviction decisions).
+	WorkingSet uint64 `json:"working_set"`
+	// RSS is the anonymous memory.
+	RSS uint64 `json:"rss"`
+	// Cache is the page cache (file-backed memory).
+	Cache uint64 `json:"cache"`
+	// Swap is the swap usage, not including memory.
+	Swap uint64 `json:"swap"`
+	// PageFaults is the rate of page faults (filled in by Compute only).
+	PageFaults float64 `json:"page_faults"`
+	// MajorPageFaults is the rate of major page faults (filled in by
+	// Compute only).
+	MajorPageFaults float64 `json:"major_page_faults"`
+}
+
+// IORates are the block I/O rates, summed over all the devices.
+type IORates struct {
+	// ReadBytes is the rate of bytes read.
+	ReadBytes float64 `json:"read_bytes"`
+	// WriteBytes is the rate of bytes written.
+	WriteBytes float64 `json:"write_bytes"`
+	// ReadOps is the rate of read operations.
+	ReadOps float64 `json:"read_ops"`
+	// WriteOps is the rate of write operations.
+	WriteOps float64 `json:"write_ops"`
+}
+
+// Compute returns the rates between the statistics snapshots prev and cur
+// of a cgroup, taken interval apart, and the memory metrics of cur.
+func Compute(prev, cur *cgroups.Stats, interval time.Duration) (*Rates, error) {
+	if prev == nil || cur == nil {
+		return nil, errors.New("statsutil: nil stats")
+	}
+	if interval <= 0 {
+		return nil, errors.New("statsutil: interval must be positive")
+	}
+	c := &counter{seconds: interval.Seconds()}
+	r := &Rates{Interval: interval}
+
+	pc, cc := &prev.CpuStats, &cur.CpuStats
+	r.CPU.Usage = c.rate(pc.CpuUsage.TotalUsage, cc.CpuUsage.TotalUsage) / 1e9
+	r.CPU.User = c.rate(pc.CpuUsage.UsageInUsermode, cc.CpuUsage.UsageInUsermode) / 1e9
+	r.CPU.System = c.rate(pc.CpuUsage.UsageInKernelmode, cc.CpuUsage.UsageInKernelmode) / 1e9
+	r.CPU.ThrottledTime = c.rate(pc.ThrottlingData.ThrottledTime, cc.ThrottlingData.ThrottledTime) / 1e9
+	if periods := c.delta(pc.ThrottlingData.Periods, cc.ThrottlingData.Periods); periods > 0 {
+		throttled := c.delta(pc.ThrottlingData.ThrottledPeriods, cc.ThrottlingData.ThrottledPeriods)
+		r.CPU.ThrottledRatio = float64(throttled) / float64(periods)
+	}
+
+	r.Memory = Memory(cur)
+	pm, cm := &prev.MemoryStats, &cur.MemoryStats
+	r.Memory.PageFaults = c.rate(memoryStat(pm, "pgfault"), memoryStat(cm, "pgfault"))
+	r.Memory.MajorPageFaults = c.rate(memoryStat(pm, "pgmajfault"), memoryStat(cm, "pgmajfault"))
+
+	pb, cb := &prev.BlkioStats, &cur.BlkioStats
+	r.IO.ReadBytes = c.ioRate(pb.IoServiceBytesRecursive, cb.IoServiceBytesRecursive, "Read")
+	r.IO.WriteBytes = c.ioRate(pb.IoServiceBytesRecursive, cb.IoServiceBytesRecursive, "Write")
+	r.IO.ReadOps = c.ioRate(pb.IoServicedRecursive, cb.IoServicedRecursive, "Read")
+	r.IO.WriteOps = c.ioRate(pb.IoServicedRecursive, cb.IoServicedRecursive, "Write")
+
+	r.Reset = c.reset
+	return r, nil
+}
+
+// Memory returns the memory metrics of the statistics snapshot s.
+func Memory(s *cgroups.Stats) MemoryMetrics {
+	m := &s.MemoryStats
+	mm := MemoryMetrics{
+		Usage: m.Usage.Usage,
+		// Cache is "cache" on cgroup v1, and "file" on cgroup v2.
+		Cache: m.Cache,
+	}
+	if isV1(m) {
+		mm.RSS = memoryStat(m, "rss")
+	} else {
+		mm.RSS = memoryStat(m, "anon")
+	}
+	if inactive := memoryStat(m, "inactive_file"); inactive < mm.Usage {
+		mm.WorkingSet = mm.Usage - inactive
+	}
+	// SwapUsage is memory+swap on both cgroup v1 and v2 (see fs2.statMemory),
+	// and is 0 on cgroup v1 with no swap accounting.
+	if m.SwapUsage.Usage > mm.Usage {
+		mm.Swap = m.SwapUsage.Usage - mm.Usage
+	}
+	return mm
+}
+
+// isV1 returns whether the memory statistics are from cgroup v1,
+// based on the memory.stat keys.
+func isV1(m *cgroups.MemoryStats) bool {
+	_, ok := m.Stats["cache"]
+	return ok
+}
+
+// memoryStat returns the memory.stat value for key which, on cgroup v1,
+// is the hierarchical one ("total_" prefixed) if available, to match
+// the cgroup v2 semantics.
+func memoryStat(m *cgroups.MemoryStats, key string) uint64 {
+	if isV1(m) {
+		if v, ok := m.Stats["total_"+key]; ok {
+			return v
+		}
+	}
+	return m.Stats[key]
+}
+
+// counter computes the increases and rates of counters.
+type counter struct {
+	seconds float64
+	reset   bool
+}
+
+// delta returns the increase of a counter from prev to cur.
+func (c *counter) delta(prev, cur uint64) uint64 {
+	if cur < prev {
+		c.reset = true
+		return cur
+	}
+	return cur - prev
+}
+
+func (c *counter) rate(prev, cur uint64) float64 {
+	return float64(c.delta(prev, cur)) / c.seconds
+}
+
+// ioRate returns the rate of the per-device entries with the op
+// ("Read" or "Write"), summed over the devices.
+func (c *counter) ioRate(prev, cur []cgroups.BlkioStatEntry, op string) float64 {
+	type device struct{ major, minor uint64 }
+	prevValues := make(map[device]uint64)
+	for _, e := range prev {
+		if e.Op == op {
+			prevValues[device{e.Major, e.Minor}] = e.Value
+		}
+	}
+	var sum uint64
+	for _, e := range cur {
+		if e.Op == op {
+			// A device missing from prev has been added since.
+			sum += c.delta(prevValues[device{e.Major, e.Minor}], e.Value)
+		}
+	}
+	return float64(sum) / c.seconds
+}
@@ -0,0 +1,121 @@
+package statsutil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dims/libcontainer/cgroups"
+)
+
+func TestCompute(t *testing.T) {
+	prev := cgroups.NewStats()
+	prev.CpuStats.CpuUsage.TotalUsage = 1e9
+	prev.CpuStats.CpuUsage.UsageInUsermode = 1e9
+	prev.CpuStats.ThrottlingData = cgroups.ThrottlingData{Periods: 100, ThrottledPeriods: 10, ThrottledTime: 1e9}
+	prev.BlkioStats.IoServiceBytesRecursive = []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 1000},
+		{Major: 8, Minor: 0, Op: "Write", Value: 5000},
+	}
+	prev.MemoryStats.Stats["pgfault"] = 100
+
+	cur := cgroups.NewStats()
+	cur.CpuStats.CpuUsage.TotalUsage = 4e9
+	cur.CpuStats.CpuUsage.UsageInUsermode = 3e9
+	cur.CpuStats.CpuUsage.UsageInKernelmode = 1e9
+	cur.CpuStats.ThrottlingData = cgroups.ThrottlingData{Periods: 120, ThrottledPeriods: 15, ThrottledTime: 2e9}
+	cur.BlkioStats.IoServiceBytesRecursive = []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 3000},
+		// The counter was reset.
+		{Major: 8, Minor: 0, Op: "Write", Value: 200},
+		// The device was added.
+		{Major: 8, Minor: 16, Op: "Read", Value: 1000},
+	}
+	cur.MemoryStats.Stats["pgfault"] = 300
+
+	r, err := Compute(prev, cur, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &Rates{
+		Interval: 2 * time.Second,
+		Reset:    true,
+		CPU: CPURates{
+			Usage:          1.5,
+			User:           1,
+			System:         0.5,
+			ThrottledRatio: 0.25,
+			ThrottledTime:  0.5,
+		},
+		Memory: MemoryMetrics{PageFaults: 100},
+		IO: IORates{
+			ReadBytes:  1500,
+			WriteBytes: 100,
+		},
+	}
+	if *r != *expected {
+		t.Errorf("expected %+v, got %+v", expected, r)
+	}
+	if r.CPU.Percent() != 150 {
+		t.Errorf("expected 150%% CPU usage, got %v", r.CPU.Percent())
+	}
+
+	if _, err := Compute(prev, cur, 0); err == nil {
+		t.Error("expected an error for zero interval")
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testCases := []struct {
+		name     string
+		stats    cgroups.MemoryStats
+		expected MemoryMetrics
+	}{
+		{
+			name: "v1",
+			stats: cgroups.MemoryStats{
+				Cache: 600,
+				Usage: cgroups.MemoryData{Usage: 1000},
+				// memory+swap
+				SwapUsage: cgroups.MemoryData{Usage: 1200},
+				Stats: map[string]uint64{
+					"cache":               600,
+					"rss":                 300,
+					"inactive_file":       100,
+					"total_rss":           400,
+					"total_inactive_file": 200,
+				},
+			},
+			expected: MemoryMetrics{Usage: 1000, WorkingSet: 800, RSS: 400, Cache: 600, Swap: 200},
+		},
+		{
+			name: "v1 without swap accounting",
+			stats: cgroups.MemoryStats{
+				Usage: cgroups.MemoryData{Usage: 1000},
+				Stats: map[string]uint64{"cache": 0, "rss": 1000},
+			},
+			expected: MemoryMetrics{Usage: 1000, WorkingSet: 1000, RSS: 1000},
+		},
+		{
+			name: "v2",
+			stats: cgroups.MemoryStats{
+				Cache:     600,
+				Usage:     cgroups.MemoryData{Usage: 1000},
+				SwapUsage: cgroups.MemoryData{Usage: 1500},
+				Stats: map[string]uint64{
+					"file":          600,
+					"anon":          300,
+					"inactive_file": 200,
+				},
+			},
+			expected: MemoryMetrics{Usage: 1000, WorkingSet: 800, RSS: 300, Cache: 600, Swap: 500},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := Memory(&cgroups.Stats{MemoryStats: tc.stats})
+			if m != tc.expected {
+				t.Errorf("expected %+v, got %+v", tc.expected, m)
+			}
+		})
+	}
+}
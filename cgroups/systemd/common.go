@@ -17,6 +17,7 @@ import (
 	dbus "github.com/godbus/dbus/v5"
 	"github.com/sirupsen/logrus"
 
+	"github.com/dims/libcontainer/cgroups"
 	cgroupdevices "github.com/dims/libcontainer/cgroups/devices"
 	"github.com/dims/libcontainer/configs"
 	"github.com/dims/libcontainer/devices"
@@ -315,6 +316,15 @@ func newProp(name string, units interface{}) systemdDbus.Property {
 	}
 }
 
+// planProperties converts unit properties for use in a cgroups.Plan.
+func planProperties(properties []systemdDbus.Property) []cgroups.UnitProperty {
+	props := make([]cgroups.UnitProperty, 0, len(properties))
+	for _, p := range properties {
+		props = append(props, cgroups.UnitProperty{Name: p.Name, Value: p.Value.String()})
+	}
+	return props
+}
+
 func getUnitName(c *configs.Cgroup) string {
 	// by default, we create a scope unless the user explicitly asks for a slice.
 	if !strings.HasSuffix(c.Name, ".slice") {
@@ -448,6 +458,21 @@ func setUnitProperties(cm *dbusConnManager, name string, properties ...systemdDb
 	})
 }
 
+// rollbackSet undoes a failed Set. The unit properties are reset to the
+// ones previously set (if any), and then the cgroup files are restored
+// from the snapshot s, taken before the update, as systemd may have
+// written to them.
+func rollbackSet(cm *dbusConnManager, unitName string, properties []systemdDbus.Property, s *cgroups.Snapshot) {
+	if len(properties) > 0 {
+		if err := setUnitProperties(cm, unitName, properties...); err != nil {
+			logrus.Warnf("unable to roll back unit %s properties after a failed update: %v", unitName, err)
+		}
+	}
+	if err := s.Restore(); err != nil {
+		logrus.Warnf("unable to roll back cgroup of unit %s after a failed update: %v", unitName, err)
+	}
+}
+
 func getManagerProperty(cm *dbusConnManager, name string) (string, error) {
 	str := ""
 	err := cm.retryOnDisconnect(func(c *systemdDbus.Conn) error {
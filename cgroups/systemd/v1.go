@@ -1,8 +1,9 @@
 package systemd
 
 import (
+	"context"
 	"errors"
-	"os"
+	"fmt"
 	"path/filepath"
 	"reflect"
 	"strings"
@@ -11,6 +12,7 @@ import (
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/godbus/dbus/v5"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 
 	"github.com/dims/libcontainer/cgroups"
 	"github.com/dims/libcontainer/cgroups/fs"
@@ -22,6 +24,9 @@ type legacyManager struct {
 	cgroups *configs.Cgroup
 	paths   map[string]string
 	dbus    *dbusConnManager
+	// applied is a copy of the resources last successfully set,
+	// used to roll back a failed Set.
+	applied *configs.Resources
 }
 
 func NewLegacyManager(cg *configs.Cgroup, paths map[string]string) (cgroups.Manager, error) {
@@ -42,16 +47,18 @@ func NewLegacyManager(cg *configs.Cgroup, paths map[string]string) (cgroups.Mana
 		cgroups: cg,
 		paths:   paths,
 		dbus:    newDbusConnManager(false),
+		applied: cg.Resources.Clone(),
 	}, nil
 }
 
 type subsystem interface {
 	// Name returns the name of the subsystem.
 	Name() string
-	// Returns the stats, as 'stats', corresponding to the cgroup under 'path'.
-	GetStats(path string, stats *cgroups.Stats) error
-	// Set sets cgroup resource limits.
-	Set(path string, r *configs.Resources) error
+	// GetStatsFrom fills in the stats for the subsystem,
+	// reading the files of the host h.
+	GetStatsFrom(h *cgroups.Host, path string, stats *cgroups.Stats) error
+	// SetTo sets cgroup resource limits, using w to write the files.
+	SetTo(w cgroups.FileWriter, path string, r *configs.Resources) error
 }
 
 var errSubsystemDoesNotExist = errors.New("cgroup: subsystem does not exist")
@@ -88,7 +95,10 @@ func genV1ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 			newProp("MemoryLimit", uint64(r.Memory)))
 	}
 
-	if r.CpuShares != 0 {
+	// The shares of an idle cgroup can not be set. Neither r.CpuIdle
+	// nor r.CpuBurst have a systemd unit property equivalent on cgroup
+	// v1, so those are only applied to cgroupfs.
+	if r.CpuShares != 0 && (r.CpuIdle == nil || *r.CpuIdle == 0) {
 		properties = append(properties,
 			newProp("CPUShares", r.CpuShares))
 	}
@@ -160,7 +170,8 @@ func initPaths(c *configs.Cgroup) (map[string]string, error) {
 	return paths, nil
 }
 
-func (m *legacyManager) Apply(pid int) error {
+// unitProperties returns the properties of the unit to be started by Apply.
+func (m *legacyManager) unitProperties(pid int) []systemdDbus.Property {
 	var (
 		c          = m.cgroups
 		unitName   = getUnitName(c)
@@ -168,9 +179,6 @@ func (m *legacyManager) Apply(pid int) error {
 		properties []systemdDbus.Property
 	)
 
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
 	if c.Parent != "" {
 		slice = c.Parent
 	}
@@ -205,19 +213,41 @@ func (m *legacyManager) Apply(pid int) error {
 	properties = append(properties,
 		newProp("DefaultDependencies", false))
 
-	properties = append(properties, c.SystemdProps...)
+	return append(properties, c.SystemdProps...)
+}
+
+func (m *legacyManager) Apply(pid int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	if err := startUnit(m.dbus, unitName, properties, pid == -1); err != nil {
+	properties := m.unitProperties(pid)
+	if err := startUnit(m.dbus, getUnitName(m.cgroups), properties, pid == -1); err != nil {
 		return err
 	}
 
-	if err := m.joinCgroups(pid); err != nil {
+	if err := m.joinCgroups(cgroups.Cgroupfs, pid); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+func (m *legacyManager) PlanApply(pid int) (*cgroups.Plan, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p := &cgroups.Plan{}
+	p.Add(cgroups.Op{
+		Type:       cgroups.OpStartUnit,
+		Unit:       getUnitName(m.cgroups),
+		Properties: planProperties(m.unitProperties(pid)),
+	})
+	if err := m.joinCgroups(p, pid); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 func (m *legacyManager) Destroy() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -234,13 +264,17 @@ func (m *legacyManager) Destroy() error {
 	return stopErr
 }
 
+func (m *legacyManager) Kill(sig unix.Signal) error {
+	return cgroups.FreezeAndKill(m, sig)
+}
+
 func (m *legacyManager) Path(subsys string) string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	return m.paths[subsys]
 }
 
-func (m *legacyManager) joinCgroups(pid int) error {
+func (m *legacyManager) joinCgroups(w cgroups.FileWriter, pid int) error {
 	for _, sys := range legacySubsystems {
 		name := sys.Name()
 		switch name {
@@ -249,16 +283,16 @@ func (m *legacyManager) joinCgroups(pid int) error {
 		case "cpuset":
 			if path, ok := m.paths[name]; ok {
 				s := &fs.CpusetGroup{}
-				if err := s.ApplyDir(path, m.cgroups.Resources, pid); err != nil {
+				if err := s.ApplyDirTo(w, path, m.cgroups.Resources, pid); err != nil {
 					return err
 				}
 			}
 		default:
 			if path, ok := m.paths[name]; ok {
-				if err := os.MkdirAll(path, 0o755); err != nil {
+				if err := cgroups.MkdirAll(w, path); err != nil {
 					return err
 				}
-				if err := cgroups.WriteCgroupProc(path, pid); err != nil {
+				if err := cgroups.WriteCgroupProcTo(w, path, pid); err != nil {
 					return err
 				}
 			}
@@ -322,7 +356,7 @@ func (m *legacyManager) GetStats() (*cgroups.Stats, error) {
 		if path == "" {
 			continue
 		}
-		if err := sys.GetStats(path, stats); err != nil {
+		if err := sys.GetStatsFrom(nil, path, stats); err != nil {
 			return nil, err
 		}
 	}
@@ -330,6 +364,12 @@ func (m *legacyManager) GetStats() (*cgroups.Stats, error) {
 	return stats, nil
 }
 
+func (m *legacyManager) GetStatsTree() (cgroups.StatsTree, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fs.GetStatsTree(m.paths)
+}
+
 // freezeBeforeSet answers whether there is a need to freeze the cgroup before
 // applying its systemd unit properties, and thaw after, while avoiding
 // unnecessary freezer state changes.
@@ -395,19 +435,33 @@ func (m *legacyManager) freezeBeforeSet(unitName string, r *configs.Resources) (
 	return
 }
 
-func (m *legacyManager) Set(r *configs.Resources) error {
+// Set applies the resources r to the unit and its cgroups. If any of the
+// settings fails, both the unit properties and the cgroups are rolled back.
+func (m *legacyManager) Set(r *configs.Resources) (retErr error) {
 	if r == nil {
 		return nil
 	}
 	if r.Unified != nil {
 		return cgroups.ErrV1NoUnified
 	}
+	if r.MemoryHigh != 0 || r.MemoryMin != 0 || r.MemoryOOMGroup != nil {
+		return cgroups.ErrV1NoMemoryV2
+	}
+	if r.CpusetPartition != "" {
+		return cgroups.ErrV1NoPartition
+	}
 	properties, err := genV1ResourcesProperties(r, m.dbus)
 	if err != nil {
 		return err
 	}
 
 	unitName := getUnitName(m.cgroups)
+	// Take the snapshot before the cgroup is (temporarily) frozen below,
+	// so that the freezer state is not rolled back to frozen.
+	s, err := fs.Snapshot(m.paths, r)
+	if err != nil {
+		return fmt.Errorf("unable to save cgroup state: %w", err)
+	}
 	needsFreeze, needsThaw, err := m.freezeBeforeSet(unitName, r)
 	if err != nil {
 		return err
@@ -428,6 +482,20 @@ func (m *legacyManager) Set(r *configs.Resources) error {
 			}
 		}
 	}
+	defer func() {
+		if retErr == nil {
+			return
+		}
+		var prevProperties []systemdDbus.Property
+		if prev := m.applied; prev != nil {
+			props, err := genV1ResourcesProperties(prev, m.dbus)
+			if err != nil {
+				logrus.Warnf("unable to roll back unit %s properties: %v", unitName, err)
+			}
+			prevProperties = props
+		}
+		rollbackSet(m.dbus, unitName, prevProperties, s)
+	}()
 	setErr := setUnitProperties(m.dbus, unitName, properties...)
 	if needsThaw {
 		if err := m.doFreeze(configs.Thawed); err != nil {
@@ -444,14 +512,61 @@ func (m *legacyManager) Set(r *configs.Resources) error {
 		if !ok {
 			continue
 		}
-		if err := sys.Set(path, r); err != nil {
+		if err := sys.SetTo(cgroups.Cgroupfs, path, r); err != nil {
 			return err
 		}
 	}
 
+	m.applied = r.Clone()
 	return nil
 }
 
+func (m *legacyManager) PlanSet(r *configs.Resources) (*cgroups.Plan, error) {
+	p := &cgroups.Plan{}
+	if r == nil {
+		return p, nil
+	}
+	if r.Unified != nil {
+		return nil, cgroups.ErrV1NoUnified
+	}
+	if r.MemoryHigh != 0 || r.MemoryMin != 0 || r.MemoryOOMGroup != nil {
+		return nil, cgroups.ErrV1NoMemoryV2
+	}
+	if r.CpusetPartition != "" {
+		return nil, cgroups.ErrV1NoPartition
+	}
+	properties, err := genV1ResourcesProperties(r, m.dbus)
+	if err != nil {
+		return nil, err
+	}
+	// The container is not frozen while its unit properties are set
+	// (see freezeBeforeSet), as this does not change the end result.
+	p.Add(cgroups.Op{
+		Type:       cgroups.OpSetUnitProperties,
+		Unit:       getUnitName(m.cgroups),
+		Properties: planProperties(properties),
+	})
+	for _, sys := range legacySubsystems {
+		path, ok := m.paths[sys.Name()]
+		if !ok {
+			continue
+		}
+		if err := sys.SetTo(p, path, r); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// NewChild creates a sub-cgroup of the unit's cgroups, which
+// is not a systemd unit itself, and is managed by fs.
+func (m *legacyManager) NewChild(name string, r *configs.Resources) (cgroups.Manager, error) {
+	m.mu.Lock()
+	paths := m.paths
+	m.mu.Unlock()
+	return fs.NewChild(paths, name, r)
+}
+
 func (m *legacyManager) GetPaths() map[string]string {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -462,6 +577,12 @@ func (m *legacyManager) GetCgroups() (*configs.Cgroup, error) {
 	return m.cgroups, nil
 }
 
+func (m *legacyManager) GetResources() (*configs.Resources, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return fs.GetResources(m.paths)
+}
+
 func (m *legacyManager) GetFreezerState() (configs.FreezerState, error) {
 	path, ok := m.paths["freezer"]
 	if !ok {
@@ -478,3 +599,11 @@ func (m *legacyManager) Exists() bool {
 func (m *legacyManager) OOMKillCount() (uint64, error) {
 	return fs.OOMKillCount(m.Path("memory"))
 }
+
+func (m *legacyManager) NotifyOOM(ctx context.Context) (<-chan cgroups.OOMEvent, error) {
+	return fs.NotifyOOM(ctx, m.Path("memory"))
+}
+
+func (m *legacyManager) Reclaim(bytes uint64, swappiness *int) (uint64, error) {
+	return fs.Reclaim(m.Path("memory"), bytes, swappiness)
+}
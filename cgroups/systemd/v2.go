@@ -2,6 +2,7 @@ package systemd
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"math"
@@ -14,6 +15,7 @@ import (
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	securejoin "github.com/cyphar/filepath-securejoin"
 	"github.com/sirupsen/logrus"
+	"golang.org/x/sys/unix"
 
 	"github.com/dims/libcontainer/cgroups"
 	"github.com/dims/libcontainer/cgroups/fs2"
@@ -27,6 +29,9 @@ type unifiedManager struct {
 	path  string
 	dbus  *dbusConnManager
 	fsMgr cgroups.Manager
+	// applied is a copy of the resources last successfully set,
+	// used to roll back a failed Set.
+	applied *configs.Resources
 }
 
 func NewUnifiedManager(config *configs.Cgroup, path string) (cgroups.Manager, error) {
@@ -34,6 +39,7 @@ func NewUnifiedManager(config *configs.Cgroup, path string) (cgroups.Manager, er
 		cgroups: config,
 		path:    path,
 		dbus:    newDbusConnManager(config.Rootless),
+		applied: config.Resources.Clone(),
 	}
 	if err := m.initPath(); err != nil {
 		return nil, err
@@ -197,6 +203,31 @@ func genV2ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 			newProp("MemoryLow", uint64(r.MemoryReservation)))
 	}
 
+	if r.MemoryHigh != 0 {
+		properties = append(properties,
+			newProp("MemoryHigh", uint64(r.MemoryHigh)))
+	}
+	if r.MemoryMin != 0 {
+		properties = append(properties,
+			newProp("MemoryMin", uint64(r.MemoryMin)))
+	}
+	if r.MemoryOOMGroup != nil {
+		// OOMPolicy=kill makes systemd set memory.oom.group to 1. For
+		// scopes, OOMPolicy is only supported since systemd v253, but
+		// the setting is applied to cgroupfs in any case.
+		if sdVer := systemdVersion(cm); sdVer >= 253 {
+			policy := "continue"
+			if *r.MemoryOOMGroup {
+				policy = "kill"
+			}
+			properties = append(properties,
+				newProp("OOMPolicy", policy))
+		} else {
+			logrus.Debugf("systemd v%d is too old to support OOMPolicy"+
+				" (setting will still be applied to cgroupfs)", sdVer)
+		}
+	}
+
 	swap, err := cgroups.ConvertMemorySwapToCgroupV2Value(r.MemorySwap, r.Memory)
 	if err != nil {
 		return nil, err
@@ -206,13 +237,27 @@ func genV2ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 			newProp("MemorySwapMax", uint64(swap)))
 	}
 
-	if r.CpuWeight != 0 {
+	if r.CpuIdle != nil && *r.CpuIdle == 1 {
+		// CPUWeight=idle (sent as 0 over dbus) sets cpu.idle to 1;
+		// it is supported since systemd v252. The weight of an idle
+		// cgroup can not be set, so r.CpuWeight is ignored.
+		if sdVer := systemdVersion(cm); sdVer >= 252 {
+			properties = append(properties,
+				newProp("CPUWeight", uint64(0)))
+		} else {
+			logrus.Debugf("systemd v%d is too old to support CPUWeight=idle"+
+				" (setting will still be applied to cgroupfs)", sdVer)
+		}
+	} else if r.CpuWeight != 0 {
 		properties = append(properties,
 			newProp("CPUWeight", r.CpuWeight))
 	}
 
 	addCpuQuota(cm, &properties, r.CpuQuota, r.CpuPeriod)
 
+	// r.CpuBurst has no systemd unit property equivalent,
+	// so it is only applied to cgroupfs.
+
 	if r.PidsLimit > 0 || r.PidsLimit == -1 {
 		properties = append(properties,
 			newProp("TasksMax", uint64(r.PidsLimit)))
@@ -237,7 +282,8 @@ func genV2ResourcesProperties(r *configs.Resources, cm *dbusConnManager) ([]syst
 	return properties, nil
 }
 
-func (m *unifiedManager) Apply(pid int) error {
+// unitProperties returns the properties of the unit to be started by Apply.
+func (m *unifiedManager) unitProperties(pid int) []systemdDbus.Property {
 	var (
 		c          = m.cgroups
 		unitName   = getUnitName(c)
@@ -282,7 +328,13 @@ func (m *unifiedManager) Apply(pid int) error {
 	properties = append(properties,
 		newProp("DefaultDependencies", false))
 
-	properties = append(properties, c.SystemdProps...)
+	return append(properties, c.SystemdProps...)
+}
+
+func (m *unifiedManager) Apply(pid int) error {
+	c := m.cgroups
+	unitName := getUnitName(c)
+	properties := m.unitProperties(pid)
 
 	if err := startUnit(m.dbus, unitName, properties, pid == -1); err != nil {
 		return fmt.Errorf("unable to start unit %q (properties %+v): %w", unitName, properties, err)
@@ -316,6 +368,23 @@ func (m *unifiedManager) Apply(pid int) error {
 	return nil
 }
 
+// PlanApply returns the operations Apply would perform. Changing the
+// owner of the cgroup (see OwnerUID) is not included in the plan.
+func (m *unifiedManager) PlanApply(pid int) (*cgroups.Plan, error) {
+	p := &cgroups.Plan{}
+	p.Add(cgroups.Op{
+		Type:       cgroups.OpStartUnit,
+		Unit:       getUnitName(m.cgroups),
+		Properties: planProperties(m.unitProperties(pid)),
+	})
+	// The cgroup is created by systemd when the unit is started.
+	p.MarkCreated(m.path)
+	if err := fs2.PlanCreateCgroupPath(p, m.path, m.cgroups); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
 // The kernel exposes a list of files that should be chowned to the delegate
 // uid in /sys/kernel/cgroup/delegate.  If the file is not present
 // (Linux < 4.15), use the initial values mentioned in cgroups(7).
@@ -359,6 +428,10 @@ func (m *unifiedManager) Destroy() error {
 	return nil
 }
 
+func (m *unifiedManager) Kill(sig unix.Signal) error {
+	return m.fsMgr.Kill(sig)
+}
+
 func (m *unifiedManager) Path(_ string) string {
 	return m.path
 }
@@ -433,7 +506,13 @@ func (m *unifiedManager) GetStats() (*cgroups.Stats, error) {
 	return m.fsMgr.GetStats()
 }
 
-func (m *unifiedManager) Set(r *configs.Resources) error {
+func (m *unifiedManager) GetStatsTree() (cgroups.StatsTree, error) {
+	return m.fsMgr.GetStatsTree()
+}
+
+// Set applies the resources r to the unit and its cgroup. If any of the
+// settings fails, both the unit properties and the cgroup are rolled back.
+func (m *unifiedManager) Set(r *configs.Resources) (retErr error) {
 	if r == nil {
 		return nil
 	}
@@ -442,11 +521,86 @@ func (m *unifiedManager) Set(r *configs.Resources) error {
 		return err
 	}
 
-	if err := setUnitProperties(m.dbus, getUnitName(m.cgroups), properties...); err != nil {
+	unitName := getUnitName(m.cgroups)
+	prev := m.applied
+	s, err := fs2.Snapshot(m.path, r, prev)
+	if err != nil {
+		return fmt.Errorf("unable to save cgroup state: %w", err)
+	}
+	defer func() {
+		if retErr == nil {
+			return
+		}
+		var prevProperties []systemdDbus.Property
+		if prev != nil {
+			props, err := genV2ResourcesProperties(prev, m.dbus)
+			if err != nil {
+				logrus.Warnf("unable to roll back unit %s properties: %v", unitName, err)
+			}
+			prevProperties = props
+		}
+		rollbackSet(m.dbus, unitName, prevProperties, s)
+	}()
+
+	if err := setUnitProperties(m.dbus, unitName, properties...); err != nil {
 		return fmt.Errorf("unable to set unit properties: %w", err)
 	}
 
-	return m.fsMgr.Set(r)
+	// The snapshot above covers the cgroup files, too.
+	if err := fs2.SetWithoutRollback(m.fsMgr, r); err != nil {
+		return err
+	}
+	m.applied = r.Clone()
+	return nil
+}
+
+func (m *unifiedManager) PlanSet(r *configs.Resources) (*cgroups.Plan, error) {
+	if r == nil {
+		return &cgroups.Plan{}, nil
+	}
+	properties, err := genV2ResourcesProperties(r, m.dbus)
+	if err != nil {
+		return nil, err
+	}
+	fsPlan, err := m.fsMgr.PlanSet(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &cgroups.Plan{}
+	p.Add(cgroups.Op{
+		Type:       cgroups.OpSetUnitProperties,
+		Unit:       getUnitName(m.cgroups),
+		Properties: planProperties(properties),
+	})
+	p.Ops = append(p.Ops, fsPlan.Ops...)
+	return p, nil
+}
+
+// OpenDir opens the unit's cgroup directory with O_PATH (see
+// cgroups.DirOpener). Note systemd does not start a scope unit
+// without processes, so it can only be used once Apply is done.
+func (m *unifiedManager) OpenDir() (*os.File, error) {
+	return m.fsMgr.(cgroups.DirOpener).OpenDir()
+}
+
+var _ cgroups.ThreadManager = (*unifiedManager)(nil)
+
+// GetThreads returns the thread IDs in the unit's cgroup
+// (see cgroups.ThreadManager).
+func (m *unifiedManager) GetThreads() ([]int, error) {
+	return m.fsMgr.(cgroups.ThreadManager).GetThreads()
+}
+
+// AddThread moves the thread tid into the unit's cgroup
+// (see cgroups.ThreadManager).
+func (m *unifiedManager) AddThread(tid int) error {
+	return m.fsMgr.(cgroups.ThreadManager).AddThread(tid)
+}
+
+// NewChild creates a sub-cgroup of the unit's cgroup, which
+// is not a systemd unit itself, and is managed by fs2.
+func (m *unifiedManager) NewChild(name string, r *configs.Resources) (cgroups.Manager, error) {
+	return m.fsMgr.NewChild(name, r)
 }
 
 func (m *unifiedManager) GetPaths() map[string]string {
@@ -459,6 +613,10 @@ func (m *unifiedManager) GetCgroups() (*configs.Cgroup, error) {
 	return m.cgroups, nil
 }
 
+func (m *unifiedManager) GetResources() (*configs.Resources, error) {
+	return m.fsMgr.GetResources()
+}
+
 func (m *unifiedManager) GetFreezerState() (configs.FreezerState, error) {
 	return m.fsMgr.GetFreezerState()
 }
@@ -470,3 +628,11 @@ func (m *unifiedManager) Exists() bool {
 func (m *unifiedManager) OOMKillCount() (uint64, error) {
 	return m.fsMgr.OOMKillCount()
 }
+
+func (m *unifiedManager) NotifyOOM(ctx context.Context) (<-chan cgroups.OOMEvent, error) {
+	return m.fsMgr.NotifyOOM(ctx)
+}
+
+func (m *unifiedManager) Reclaim(bytes uint64, swappiness *int) (uint64, error) {
+	return m.fsMgr.Reclaim(bytes, swappiness)
+}
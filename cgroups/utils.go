@@ -7,11 +7,13 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/dims/libcontainer/configs"
 	"github.com/dims/libcontainer/userns"
 	"github.com/sirupsen/logrus"
 	"golang.org/x/sys/unix"
@@ -19,6 +21,7 @@ import (
 
 const (
 	CgroupProcesses   = "cgroup.procs"
+	CgroupThreads     = "cgroup.threads"
 	unifiedMountpoint = "/sys/fs/cgroup"
 	hybridMountpoint  = "/sys/fs/cgroup/unified"
 )
@@ -136,8 +139,11 @@ func GetAllSubsystems() ([]string, error) {
 	return subsystems, nil
 }
 
-func readProcsFile(dir string) ([]int, error) {
-	f, err := OpenFile(dir, CgroupProcesses, os.O_RDONLY)
+func readProcsFile(b Backend, dir, file string) ([]int, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no directory specified for %s", file)
+	}
+	f, err := openFile(b, dir, file, os.O_RDONLY)
 	if err != nil {
 		return nil, err
 	}
@@ -228,19 +234,129 @@ func EnterPid(cgroupPaths map[string]string, pid int) error {
 	return nil
 }
 
-func rmdir(path string) error {
-	err := unix.Rmdir(path)
+func rmdir(b Backend, path string) error {
+	rm := unix.Rmdir
+	if b != nil {
+		rm = b.Rmdir
+	}
+	err := rm(path)
 	if err == nil || err == unix.ENOENT { //nolint:errorlint // unix errors are bare
 		return nil
 	}
 	return &os.PathError{Op: "rmdir", Path: path, Err: err}
 }
 
+// CheckChildName returns an error if name can not be used as the name
+// of a sub-cgroup (see Manager.NewChild), i.e. if it is not a single
+// path element.
+func CheckChildName(name string) error {
+	if name == "" || name == "." || name == ".." || strings.Contains(name, "/") {
+		return fmt.Errorf("invalid child cgroup name %q", name)
+	}
+	return nil
+}
+
+// threadedControllers are the cgroup v2 controllers which can be used in
+// threaded cgroups (see "Threads" in Documentation/admin-guide/cgroup-v2.rst).
+var threadedControllers = map[string]struct{}{
+	"cpu":        {},
+	"cpuset":     {},
+	"perf_event": {},
+	"pids":       {},
+}
+
+// IsThreadedController returns whether the cgroup v2 controller
+// can be used in threaded cgroups.
+func IsThreadedController(name string) bool {
+	_, ok := threadedControllers[name]
+	return ok
+}
+
+// controllerSettings are the cgroup v2 controllers, each with a function
+// telling whether resources have settings for it (other than in Unified).
+var controllerSettings = []struct {
+	name  string
+	isSet func(r *configs.Resources) bool
+}{
+	{"pids", func(r *configs.Resources) bool {
+		return r.PidsLimit != 0
+	}},
+	{"memory", func(r *configs.Resources) bool {
+		return r.MemoryReservation != 0 || r.Memory != 0 || r.MemorySwap != 0 ||
+			r.MemoryHigh != 0 || r.MemoryMin != 0 || r.MemoryOOMGroup != nil
+	}},
+	{"io", func(r *configs.Resources) bool {
+		return r.BlkioWeight != 0 || len(r.BlkioWeightDevice) > 0 ||
+			len(r.BlkioThrottleReadBpsDevice) > 0 || len(r.BlkioThrottleWriteBpsDevice) > 0 ||
+			len(r.BlkioThrottleReadIOPSDevice) > 0 || len(r.BlkioThrottleWriteIOPSDevice) > 0
+	}},
+	{"cpu", func(r *configs.Resources) bool {
+		return r.CpuWeight != 0 || r.CpuQuota != 0 || r.CpuPeriod != 0 || r.CpuIdle != nil || r.CpuBurst != nil
+	}},
+	{"cpuset", func(r *configs.Resources) bool {
+		return r.CpusetCpus != "" || r.CpusetMems != "" || r.CpusetPartition != ""
+	}},
+	{"hugetlb", func(r *configs.Resources) bool {
+		return len(r.HugetlbLimit) > 0
+	}},
+	{"rdma", func(r *configs.Resources) bool {
+		return len(r.Rdma) > 0
+	}},
+}
+
+// IsControllerSet returns whether the resources r have settings for the
+// cgroup v2 controller name, not counting the ones in r.Unified.
+func IsControllerSet(name string, r *configs.Resources) bool {
+	for _, c := range controllerSettings {
+		if c.name == name {
+			return c.isSet(r)
+		}
+	}
+	return false
+}
+
+// NeededControllers returns the cgroup v2 controllers needed to set
+// the resources r, including the ones of the r.Unified keys.
+func NeededControllers(r *configs.Resources) []string {
+	if r == nil {
+		return nil
+	}
+	var ctrs []string
+	for _, c := range controllerSettings {
+		if c.isSet(r) {
+			ctrs = append(ctrs, c.name)
+		}
+	}
+	for k := range r.Unified {
+		if c, _, ok := strings.Cut(k, "."); ok && c != "cgroup" && !slices.Contains(ctrs, c) {
+			ctrs = append(ctrs, c)
+		}
+	}
+	return ctrs
+}
+
+// DomainControllers returns the cgroup v2 controllers needed to set the
+// resources r which can not be used in a threaded cgroup (e.g. memory
+// and io).
+func DomainControllers(r *configs.Resources) []string {
+	var ctrs []string
+	for _, c := range NeededControllers(r) {
+		if !IsThreadedController(c) {
+			ctrs = append(ctrs, c)
+		}
+	}
+	return ctrs
+}
+
 // RemovePath aims to remove cgroup path. It does so recursively,
 // by removing any subdirectories (sub-cgroups) first.
 func RemovePath(path string) error {
+	return removePath(nil, path)
+}
+
+func removePath(b Backend, path string) error {
 	// try the fast path first
-	if err := rmdir(path); err == nil {
+	if err := rmdir(b, path); err == nil {
 		return nil
 	}
 
@@ -254,13 +370,13 @@ func RemovePath(path string) error {
 	for _, info := range infos {
 		if info.IsDir() {
 			// We should remove subcgroups dir first
-			if err = RemovePath(filepath.Join(path, info.Name())); err != nil {
+			if err = removePath(b, filepath.Join(path, info.Name())); err != nil {
 				break
 			}
 		}
 	}
 	if err == nil {
-		err = rmdir(path)
+		err = rmdir(b, path)
 	}
 	return err
 }
@@ -270,6 +386,10 @@ func RemovePath(path string) error {
 // If after all there are not removed cgroups - appropriate error will be
 // returned.
 func RemovePaths(paths map[string]string) (err error) {
+	return removePaths(nil, paths)
+}
+
+func removePaths(b Backend, paths map[string]string) (err error) {
 	const retries = 5
 	delay := 10 * time.Millisecond
 	for i := 0; i < retries; i++ {
@@ -278,7 +398,7 @@ func RemovePaths(paths map[string]string) (err error) {
 			delay *= 2
 		}
 		for s, p := range paths {
-			if err := RemovePath(p); err != nil {
+			if err := removePath(b, p); err != nil {
 				// do not log intermediate iterations
 				switch i {
 				case 0:
@@ -377,15 +497,31 @@ func getHugePageSizeFromFilenames(fileNames []string) ([]string, error) {
 
 // GetPids returns all pids, that were added to cgroup at path.
 func GetPids(dir string) ([]int, error) {
-	return readProcsFile(dir)
+	return readProcsFile(nil, dir, CgroupProcesses)
+}
+
+// GetThreads returns the thread IDs in the cgroup at path (cgroup v2 only).
+func GetThreads(dir string) ([]int, error) {
+	return readProcsFile(nil, dir, CgroupThreads)
 }
 
 // WriteCgroupProc writes the specified pid into the cgroup's cgroup.procs file
 func WriteCgroupProc(dir string, pid int) error {
+	return writeCgroupProcs(nil, dir, CgroupProcesses, pid)
+}
+
+// WriteCgroupThread moves the thread tid into the cgroup by writing it to
+// cgroup.threads (cgroup v2 only). Unless the cgroup is threaded, the
+// thread must be in the same cgroup as the rest of its process already.
+func WriteCgroupThread(dir string, tid int) error {
+	return writeCgroupProcs(nil, dir, CgroupThreads, tid)
+}
+
+func writeCgroupProcs(b Backend, dir, procsFile string, pid int) error {
 	// Normally dir should not be empty, one case is that cgroup subsystem
 	// is not mounted, we will get empty dir, and we want it fail here.
 	if dir == "" {
-		return fmt.Errorf("no such directory for %s", CgroupProcesses)
+		return fmt.Errorf("no such directory for %s", procsFile)
 	}
 
 	// Dont attach any pid to the cgroup if -1 is specified as a pid
@@ -393,7 +529,7 @@ func WriteCgroupProc(dir string, pid int) error {
 		return nil
 	}
 
-	file, err := OpenFile(dir, CgroupProcesses, os.O_WRONLY)
+	file, err := openFile(b, dir, procsFile, os.O_WRONLY)
 	if err != nil {
 		return fmt.Errorf("failed to write %v: %w", pid, err)
 	}
@@ -8,6 +8,8 @@ import (
 	"testing"
 
 	"github.com/moby/sys/mountinfo"
+
+	"github.com/dims/libcontainer/configs"
 )
 
 const fedoraMountinfo = `15 35 0:3 / /proc rw,nosuid,nodev,noexec,relatime shared:5 - proc proc rw
@@ -646,3 +648,23 @@ func TestConvertBlkIOToIOWeightValue(t *testing.T) {
 		}
 	}
 }
+
+func TestDomainControllers(t *testing.T) {
+	r := &configs.Resources{
+		CpuWeight:  50,
+		CpusetCpus: "0-1",
+		PidsLimit:  10,
+		Memory:     1073741824,
+		Unified:    map[string]string{"io.weight": "100", "cgroup.freeze": "0"},
+	}
+	ctrs := DomainControllers(r)
+	if expected := []string{"memory", "io"}; !reflect.DeepEqual(ctrs, expected) {
+		t.Errorf("expected domain controllers %q, got %q", expected, ctrs)
+	}
+	if !IsControllerSet("memory", r) || IsControllerSet("io", r) {
+		t.Error("expected only the memory settings, not the unified ones, to be counted")
+	}
+	if ctrs := DomainControllers(nil); ctrs != nil {
+		t.Errorf("expected no domain controllers for nil resources, got %q", ctrs)
+	}
+}
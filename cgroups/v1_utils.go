@@ -23,8 +23,12 @@ const (
 )
 
 var (
-	errUnified     = errors.New("not implemented for cgroup v2 unified hierarchy")
-	ErrV1NoUnified = errors.New("invalid configuration: cannot use unified on cgroup v1")
+	errUnified       = errors.New("not implemented for cgroup v2 unified hierarchy")
+	ErrV1NoUnified   = errors.New("invalid configuration: cannot use unified on cgroup v1")
+	ErrV1NoMemoryV2  = errors.New("invalid configuration: memory.high, memory.min and memory.oom.group are unsupported on cgroup v1")
+	ErrV1NoThreaded  = errors.New("invalid configuration: threaded cgroups are unsupported on cgroup v1")
+	ErrV1NoPartition = errors.New("invalid configuration: cpuset partitions are unsupported on cgroup v1")
+	ErrV1NoReclaim   = errors.New("reclaiming part of the memory of a cgroup is unsupported on cgroup v1")
 
 	readMountinfoOnce sync.Once
 	readMountinfoErr  error
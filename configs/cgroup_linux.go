@@ -1,6 +1,8 @@
 package configs
 
 import (
+	"maps"
+
 	systemdDbus "github.com/coreos/go-systemd/v22/dbus"
 	"github.com/dims/libcontainer/devices"
 )
@@ -42,6 +44,12 @@ type Cgroup struct {
 	// Rootless tells if rootless cgroups should be used.
 	Rootless bool
 
+	// Threaded tells if the cgroup should be made threaded (cgroup v2
+	// only), so that the threads of its processes can be put into
+	// different sub-cgroups. Only the threaded controllers (cpu, cpuset,
+	// perf_event and pids) can be used in a threaded cgroup.
+	Threaded bool `json:"threaded,omitempty"`
+
 	// The host UID that should own the cgroup, or nil to accept
 	// the default ownership.  This should only be set when the
 	// cgroupfs is to be mounted read/write.
@@ -72,6 +80,16 @@ type Resources struct {
 	// CPU period to be used for hardcapping (in usecs). 0 to use system default.
 	CpuPeriod uint64 `json:"cpu_period"`
 
+	// CPU burst capacity (in usecs) which allows the cgroup to exceed
+	// its quota using runtime unused in previous periods.
+	// Maps to cpu.cfs_burst_us on cgroup v1, and cpu.max.burst on v2.
+	CpuBurst *uint64 `json:"cpu_burst,omitempty"`
+
+	// CpuIdle, if set to 1, makes the cgroup SCHED_IDLE (cpu.idle),
+	// so it only gets CPU time no other cgroup wants. The cpu weight
+	// (shares) can not be set for an idle cgroup.
+	CpuIdle *int64 `json:"cpu_idle,omitempty"`
+
 	// How many time CPU will use in realtime scheduling (in usecs).
 	CpuRtRuntime int64 `json:"cpu_rt_quota"`
 
@@ -134,6 +152,25 @@ type Resources struct {
 	// CpuWeight sets a proportional bandwidth limit.
 	CpuWeight uint64 `json:"cpu_weight"`
 
+	// Memory usage throttle limit (in bytes), i.e. memory.high;
+	// set `-1` to remove the limit.
+	MemoryHigh int64 `json:"memory_high,omitempty"`
+
+	// Memory protection (in bytes) which is never reclaimed,
+	// i.e. memory.min.
+	MemoryMin int64 `json:"memory_min,omitempty"`
+
+	// Whether the OOM killer should kill all processes in the cgroup
+	// as a single unit (memory.oom.group); nil means "do not change".
+	MemoryOOMGroup *bool `json:"memory_oom_group,omitempty"`
+
+	// CpusetPartition sets the cpuset partition type of the cgroup
+	// (cpuset.cpus.partition), which is "member", "root" (the CPUs in
+	// CpusetCpus are exclusive to the cgroup) or "isolated" (same as
+	// root, with no load balancing and no unbound kernel work on the
+	// CPUs). Empty means "do not change".
+	CpusetPartition string `json:"cpuset_partition,omitempty"`
+
 	// Unified is cgroupv2-only key-value map.
 	Unified map[string]string `json:"unified"`
 
@@ -156,3 +193,51 @@ type Resources struct {
 	// methods may be relatively slow, thus this flag.
 	SkipFreezeOnSet bool `json:"-"`
 }
+
+// Clone returns a deep copy of r, so that the changes made to r
+// afterwards do not affect it.
+func (r *Resources) Clone() *Resources {
+	if r == nil {
+		return nil
+	}
+	c := *r
+	c.Devices = clonePtrs(r.Devices)
+	c.CpuBurst = clonePtr(r.CpuBurst)
+	c.CpuIdle = clonePtr(r.CpuIdle)
+	c.BlkioWeightDevice = clonePtrs(r.BlkioWeightDevice)
+	c.BlkioThrottleReadBpsDevice = clonePtrs(r.BlkioThrottleReadBpsDevice)
+	c.BlkioThrottleWriteBpsDevice = clonePtrs(r.BlkioThrottleWriteBpsDevice)
+	c.BlkioThrottleReadIOPSDevice = clonePtrs(r.BlkioThrottleReadIOPSDevice)
+	c.BlkioThrottleWriteIOPSDevice = clonePtrs(r.BlkioThrottleWriteIOPSDevice)
+	c.HugetlbLimit = clonePtrs(r.HugetlbLimit)
+	c.MemorySwappiness = clonePtr(r.MemorySwappiness)
+	c.NetPrioIfpriomap = clonePtrs(r.NetPrioIfpriomap)
+	if r.Rdma != nil {
+		c.Rdma = make(map[string]LinuxRdma, len(r.Rdma))
+		for k, v := range r.Rdma {
+			c.Rdma[k] = LinuxRdma{HcaHandles: clonePtr(v.HcaHandles), HcaObjects: clonePtr(v.HcaObjects)}
+		}
+	}
+	c.MemoryOOMGroup = clonePtr(r.MemoryOOMGroup)
+	c.Unified = maps.Clone(r.Unified)
+	return &c
+}
+
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+func clonePtrs[T any](s []*T) []*T {
+	if s == nil {
+		return nil
+	}
+	c := make([]*T, len(s))
+	for i, p := range s {
+		c[i] = clonePtr(p)
+	}
+	return c
+}
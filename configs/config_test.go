@@ -226,3 +226,31 @@ func TestCommandHookRunTimeout(t *testing.T) {
 		t.Error("Expected error to occur but it was nil")
 	}
 }
+
+func TestResourcesClone(t *testing.T) {
+	burst := uint64(1000)
+	handles := uint32(10)
+	r := &configs.Resources{
+		CpuBurst:                   &burst,
+		BlkioThrottleReadBpsDevice: []*configs.ThrottleDevice{configs.NewThrottleDevice(8, 0, 1024)},
+		Rdma:                       map[string]configs.LinuxRdma{"mlx5_0": {HcaHandles: &handles}},
+		Unified:                    map[string]string{"pids.max": "10"},
+	}
+	c := r.Clone()
+	if !reflect.DeepEqual(r, c) {
+		t.Fatalf("expected %+v, got %+v", r, c)
+	}
+
+	*r.CpuBurst = 2000
+	r.BlkioThrottleReadBpsDevice[0].Rate = 2048
+	*r.Rdma["mlx5_0"].HcaHandles = 20
+	r.Unified["pids.max"] = "20"
+	if *c.CpuBurst != 1000 || c.BlkioThrottleReadBpsDevice[0].Rate != 1024 ||
+		*c.Rdma["mlx5_0"].HcaHandles != 10 || c.Unified["pids.max"] != "10" {
+		t.Errorf("expected the clone not to change, got %+v", c)
+	}
+
+	if (*configs.Resources)(nil).Clone() != nil {
+		t.Error("expected the clone of nil to be nil")
+	}
+}
@@ -261,6 +261,15 @@ func (v *ConfigValidator) cgroups(config *configs.Config) error {
 		return fmt.Errorf("cgroup: either Path or Name and Parent should be used, got %+v", c)
 	}
 
+	if c.Threaded {
+		if !cgroups.IsCgroup2UnifiedMode() {
+			return cgroups.ErrV1NoThreaded
+		}
+		if ctrs := cgroups.DomainControllers(c.Resources); len(ctrs) > 0 {
+			return fmt.Errorf("cgroup: threaded cgroup can not use domain controllers %s", strings.Join(ctrs, ", "))
+		}
+	}
+
 	r := c.Resources
 	if r == nil {
 		return nil
@@ -275,11 +284,52 @@ func (v *ConfigValidator) cgroups(config *configs.Config) error {
 		if err != nil {
 			return err
 		}
+		if err := memoryLimits(r); err != nil {
+			return err
+		}
+	} else {
+		if r.MemoryHigh != 0 || r.MemoryMin != 0 || r.MemoryOOMGroup != nil {
+			return cgroups.ErrV1NoMemoryV2
+		}
+		if r.CpusetPartition != "" {
+			return cgroups.ErrV1NoPartition
+		}
 	}
 
 	return nil
 }
 
+// memoryLimits checks that the cgroup v2 memory limits that are set are
+// consistent with each other, i.e. min <= low <= high <= max.
+func memoryLimits(r *configs.Resources) error {
+	limits := []struct {
+		name  string
+		value int64
+	}{
+		{"memory.min", r.MemoryMin},
+		{"memory.low", r.MemoryReservation},
+		{"memory.high", r.MemoryHigh},
+		{"memory.max", r.Memory},
+	}
+	var prev string
+	var prevValue int64
+	for _, l := range limits {
+		// 0 is unset; -1 is unlimited, and thus is never
+		// smaller than any other value.
+		if l.value == 0 {
+			continue
+		}
+		if l.value < -1 {
+			return fmt.Errorf("invalid %s value: %d", l.name, l.value)
+		}
+		if prev != "" && l.value != -1 && (prevValue == -1 || l.value < prevValue) {
+			return fmt.Errorf("invalid memory limits: %s (%d) must not be greater than %s (%d)", prev, prevValue, l.name, l.value)
+		}
+		prev, prevValue = l.name, l.value
+	}
+	return nil
+}
+
 func (v *ConfigValidator) mounts(config *configs.Config) error {
 	for _, m := range config.Mounts {
 		if !filepath.IsAbs(m.Destination) {
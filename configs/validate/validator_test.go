@@ -379,3 +379,40 @@ func TestValidateMounts(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateMemoryLimits(t *testing.T) {
+	testCases := []struct {
+		isErr     bool
+		min, low  int64
+		high, max int64
+	}{
+		{isErr: false},
+		{isErr: false, min: 1, low: 2, high: 3, max: 4},
+		{isErr: false, min: 1, low: 1, high: 1, max: 1},
+		{isErr: false, min: 1, max: 4},
+		{isErr: false, high: 3, max: -1},
+		{isErr: false, low: 2, high: -1, max: -1},
+		{isErr: true, min: 2, low: 1},
+		{isErr: true, low: 3, high: 2},
+		{isErr: true, high: 5, max: 4},
+		{isErr: true, min: 5, max: 4},
+		{isErr: true, high: -1, max: 4},
+		{isErr: true, high: -2},
+	}
+
+	for _, tc := range testCases {
+		r := &configs.Resources{
+			MemoryMin:         tc.min,
+			MemoryReservation: tc.low,
+			MemoryHigh:        tc.high,
+			Memory:            tc.max,
+		}
+		err := memoryLimits(r)
+		if tc.isErr && err == nil {
+			t.Errorf("%+v: expected error, got nil", tc)
+		}
+		if !tc.isErr && err != nil {
+			t.Errorf("%+v: expected nil, got error %v", tc, err)
+		}
+	}
+}
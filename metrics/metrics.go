@@ -0,0 +1,371 @@
+// Package metrics renders container statistics (cgroups.Stats and
+// intelrdt.Stats) in the OpenMetrics text format, for Prometheus and
+// compatible scrapers.
+//
+// The metric names, units and labels are stable. Where cAdvisor has an
+// equivalent metric, the name and labels are the same as cAdvisor's, with
+// the "_total" suffix OpenMetrics requires for counters. All the metrics
+// have the "id" label (the container ID), plus, where applicable:
+//
+//   - "cpu" for the per-CPU usage;
+//   - "failure_type" ("pgfault" or "pgmajfault") and "scope" ("container"
+//     or "hierarchy", i.e. including the sub-cgroups) for the page faults;
+//   - "device" (e.g. "sda"), "major" and "minor" for the block device,
+//     and "operation" (e.g. "Read") for the block I/O. The device name
+//     is empty unless the statistics are decorated with the device names
+//     (see blockdev.Resolver.Decorate);
+//   - "pagesize" (e.g. "2MB") for the hugetlb usage;
+//   - "device" for the RDMA usage;
+//   - "numa_node" for the Intel RDT monitoring, which is the index of
+//     the NUMA node in intelrdt.Stats (the order of mon_data).
+package metrics
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/cgroups/statsutil"
+	"github.com/dims/libcontainer/intelrdt"
+)
+
+// Container is the statistics of a container to be written by Write.
+type Container struct {
+	// ID is the container ID, used as the "id" label.
+	ID string
+	// Cgroup is the cgroup statistics of the container, if any.
+	Cgroup *cgroups.Stats
+	// IntelRdt is the Intel RDT statistics of the container, if any.
+	IntelRdt *intelrdt.Stats
+}
+
+type metricType string
+
+const (
+	counter metricType = "counter"
+	gauge   metricType = "gauge"
+)
+
+// label is a label name and value.
+type label struct{ name, value string }
+
+type sample struct {
+	labels []label
+	value  float64
+}
+
+// family is a metric family. The name of a family with a unit
+// ends with the unit, and the samples of a counter have the
+// "_total" suffix.
+type family struct {
+	name    string
+	typ     metricType
+	unit    string
+	help    string
+	collect func(c *Container, add func(v float64, labels ...label))
+}
+
+// Write writes the metrics of the containers to w in the OpenMetrics text
+// format, ending with "# EOF". The metric families without any samples are
+// omitted.
+func Write(w io.Writer, containers ...Container) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		var samples []sample
+		for i := range containers {
+			c := &containers[i]
+			f.collect(c, func(v float64, labels ...label) {
+				samples = append(samples, sample{
+					labels: append([]label{{"id", c.ID}}, labels...),
+					value:  v,
+				})
+			})
+		}
+		if len(samples) == 0 {
+			continue
+		}
+		bw.WriteString("# TYPE " + f.name + " " + string(f.typ) + "\n")
+		if f.unit != "" {
+			bw.WriteString("# UNIT " + f.name + " " + f.unit + "\n")
+		}
+		bw.WriteString("# HELP " + f.name + " " + f.help + "\n")
+		name := f.name
+		if f.typ == counter {
+			name += "_total"
+		}
+		for _, s := range samples {
+			writeSample(bw, name, s)
+		}
+	}
+	bw.WriteString("# EOF\n")
+	return bw.Flush()
+}
+
+func writeSample(w *bufio.Writer, name string, s sample) {
+	w.WriteString(name)
+	w.WriteByte('{')
+	for i, l := range s.labels {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(l.name + `="` + escape(l.value) + `"`)
+	}
+	w.WriteString("} ")
+	w.WriteString(strconv.FormatFloat(s.value, 'f', -1, 64))
+	w.WriteByte('\n')
+}
+
+var escaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(v string) string {
+	return escaper.Replace(v)
+}
+
+func uintLabel(name string, v uint64) label {
+	return label{name, strconv.FormatUint(v, 10)}
+}
+
+// ns and us are the multipliers to convert nanoseconds
+// and microseconds to seconds.
+const (
+	ns = 1e-9
+	us = 1e-6
+)
+
+// cgroupFamily returns a family collecting the cgroup statistics.
+func cgroupFamily(name string, typ metricType, unit, help string, collect func(s *cgroups.Stats, add func(v float64, labels ...label))) family {
+	return family{name: name, typ: typ, unit: unit, help: help, collect: func(c *Container, add func(v float64, labels ...label)) {
+		if c.Cgroup != nil {
+			collect(c.Cgroup, add)
+		}
+	}}
+}
+
+// value returns a collect function for a single value.
+func value(get func(s *cgroups.Stats) float64) func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+	return func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+		add(get(s))
+	}
+}
+
+// psiFamilies returns the families of the pressure stall information
+// of resource, obtained by get.
+func psiFamilies(resource string, get func(s *cgroups.Stats) *cgroups.PSIStats) []family {
+	psi := func(full bool) func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+		return func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+			p := get(s)
+			if p == nil {
+				return
+			}
+			d := p.Some
+			if full {
+				d = p.Full
+			}
+			add(float64(d.Total) * us)
+		}
+	}
+	return []family{
+		cgroupFamily("container_pressure_"+resource+"_waiting_seconds", counter, "seconds",
+			"Total time at least one task in the container was stalled on "+resource+" (cgroup v2 only).", psi(false)),
+		cgroupFamily("container_pressure_"+resource+"_stalled_seconds", counter, "seconds",
+			"Total time all non-idle tasks in the container were stalled on "+resource+" (cgroup v2 only).", psi(true)),
+	}
+}
+
+// blkioFamily returns the family of the block I/O entries obtained by get.
+func blkioFamily(name, unit, help string, get func(s *cgroups.Stats) []cgroups.BlkioStatEntry) family {
+	return cgroupFamily(name, counter, unit, help, func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+		for _, e := range get(s) {
+			add(float64(e.Value), label{"device", e.Device}, uintLabel("major", e.Major), uintLabel("minor", e.Minor), label{"operation", e.Op})
+		}
+	})
+}
+
+// memoryFailures collects the page faults from memory.stat, where the
+// hierarchical ones have the "total_" prefix on cgroup v1. On cgroup v2,
+// all the values are hierarchical, so they are reported for both scopes.
+func memoryFailures(s *cgroups.Stats, add func(v float64, labels ...label)) {
+	for _, typ := range []string{"pgfault", "pgmajfault"} {
+		v, ok := s.MemoryStats.Stats[typ]
+		if !ok {
+			continue
+		}
+		add(float64(v), label{"failure_type", typ}, label{"scope", "container"})
+		if total, ok := s.MemoryStats.Stats["total_"+typ]; ok {
+			v = total
+		}
+		add(float64(v), label{"failure_type", typ}, label{"scope", "hierarchy"})
+	}
+}
+
+// hugetlbFamily returns the family of the hugetlb value obtained by get,
+// for all the page sizes.
+func hugetlbFamily(name string, typ metricType, unit, help string, get func(s cgroups.HugetlbStats) uint64) family {
+	return cgroupFamily(name, typ, unit, help, func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+		sizes := make([]string, 0, len(s.HugetlbStats))
+		for size := range s.HugetlbStats {
+			sizes = append(sizes, size)
+		}
+		sort.Strings(sizes)
+		for _, size := range sizes {
+			add(float64(get(s.HugetlbStats[size])), label{"pagesize", size})
+		}
+	})
+}
+
+// rdmaFamily returns the family of the RDMA value obtained by get from
+// the entries (current usage or limits) obtained by entries.
+func rdmaFamily(name, help string, entries func(s *cgroups.RdmaStats) []cgroups.RdmaEntry, get func(e cgroups.RdmaEntry) uint32) family {
+	return cgroupFamily(name, gauge, "", help, func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+		for _, e := range entries(&s.RdmaStats) {
+			add(float64(get(e)), label{"device", e.Device})
+		}
+	})
+}
+
+// intelRdtFamily returns the family of the per-NUMA node Intel RDT
+// monitoring value obtained by get.
+func intelRdtFamily(name string, typ metricType, help string, get func(s *intelrdt.Stats) []uint64) family {
+	return family{name: name, typ: typ, unit: "bytes", help: help, collect: func(c *Container, add func(v float64, labels ...label)) {
+		if c.IntelRdt == nil {
+			return
+		}
+		for node, v := range get(c.IntelRdt) {
+			add(float64(v), label{"numa_node", strconv.Itoa(node)})
+		}
+	}}
+}
+
+var families = concat(
+	[]family{
+		cgroupFamily("container_cpu_usage_seconds", counter, "seconds", "Total CPU time consumed.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.CpuStats.CpuUsage.TotalUsage) * ns })),
+		cgroupFamily("container_cpu_user_seconds", counter, "seconds", "Total CPU time consumed in user mode.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.CpuStats.CpuUsage.UsageInUsermode) * ns })),
+		cgroupFamily("container_cpu_system_seconds", counter, "seconds", "Total CPU time consumed in kernel mode.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.CpuStats.CpuUsage.UsageInKernelmode) * ns })),
+		cgroupFamily("container_cpu_percpu_usage_seconds", counter, "seconds", "Total CPU time consumed per CPU (cgroup v1 only).",
+			func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+				for cpu, v := range s.CpuStats.CpuUsage.PercpuUsage {
+					add(float64(v)*ns, label{"cpu", strconv.Itoa(cpu)})
+				}
+			}),
+		cgroupFamily("container_cpu_cfs_periods", counter, "", "Number of elapsed enforcement periods.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.CpuStats.ThrottlingData.Periods) })),
+		cgroupFamily("container_cpu_cfs_throttled_periods", counter, "", "Number of throttled enforcement periods.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.CpuStats.ThrottlingData.ThrottledPeriods) })),
+		cgroupFamily("container_cpu_cfs_throttled_seconds", counter, "seconds", "Total time the container was throttled for.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.CpuStats.ThrottlingData.ThrottledTime) * ns })),
+	},
+	psiFamilies("cpu", func(s *cgroups.Stats) *cgroups.PSIStats { return s.CpuStats.PSI }),
+	[]family{
+		cgroupFamily("container_cpuset_cpus", gauge, "", "Number of CPUs the container is allowed to run on.",
+			func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+				if len(s.CPUSetStats.CPUs) > 0 {
+					add(float64(len(s.CPUSetStats.CPUs)))
+				}
+			}),
+		cgroupFamily("container_cpuset_mems", gauge, "", "Number of memory nodes the container is allowed to allocate memory on.",
+			func(s *cgroups.Stats, add func(v float64, labels ...label)) {
+				if len(s.CPUSetStats.Mems) > 0 {
+					add(float64(len(s.CPUSetStats.Mems)))
+				}
+			}),
+		cgroupFamily("container_memory_usage_bytes", gauge, "bytes", "Current memory usage, including the page cache.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.MemoryStats.Usage.Usage) })),
+		cgroupFamily("container_memory_max_usage_bytes", gauge, "bytes", "Maximum memory usage recorded.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.MemoryStats.Usage.MaxUsage) })),
+		cgroupFamily("container_memory_limit_bytes", gauge, "bytes", "Memory limit.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.MemoryStats.Usage.Limit) })),
+		cgroupFamily("container_memory_working_set_bytes", gauge, "bytes", "Current working set (memory usage minus the inactive file-backed memory).",
+			value(func(s *cgroups.Stats) float64 { return float64(statsutil.Memory(s).WorkingSet) })),
+		cgroupFamily("container_memory_rss_bytes", gauge, "bytes", "Current anonymous memory usage.",
+			value(func(s *cgroups.Stats) float64 { return float64(statsutil.Memory(s).RSS) })),
+		cgroupFamily("container_memory_cache_bytes", gauge, "bytes", "Current page cache usage.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.MemoryStats.Cache) })),
+		cgroupFamily("container_memory_swap_bytes", gauge, "bytes", "Current swap usage.",
+			value(func(s *cgroups.Stats) float64 { return float64(statsutil.Memory(s).Swap) })),
+		cgroupFamily("container_memory_failcnt", counter, "", "Number of times the memory usage hit the limit.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.MemoryStats.Events.Max) })),
+		cgroupFamily("container_memory_failures", counter, "", "Cumulative count of memory allocation failures (page faults).",
+			memoryFailures),
+		cgroupFamily("container_oom_events", counter, "", "Number of processes killed by the OOM killer.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.MemoryStats.Events.OOMKill) })),
+	},
+	psiFamilies("memory", func(s *cgroups.Stats) *cgroups.PSIStats { return s.MemoryStats.PSI }),
+	[]family{
+		cgroupFamily("container_pids_current", gauge, "", "Current number of processes.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.PidsStats.Current) })),
+		cgroupFamily("container_pids_limit", gauge, "", "Maximum number of processes, or 0 if unlimited.",
+			value(func(s *cgroups.Stats) float64 { return float64(s.PidsStats.Limit) })),
+		blkioFamily("container_blkio_io_service_bytes", "bytes", "Number of bytes transferred to and from the block device.",
+			func(s *cgroups.Stats) []cgroups.BlkioStatEntry { return s.BlkioStats.IoServiceBytesRecursive }),
+		blkioFamily("container_blkio_io_serviced", "", "Number of I/O operations performed on the block device.",
+			func(s *cgroups.Stats) []cgroups.BlkioStatEntry { return s.BlkioStats.IoServicedRecursive }),
+	},
+	psiFamilies("io", func(s *cgroups.Stats) *cgroups.PSIStats { return s.BlkioStats.PSI }),
+	[]family{
+		hugetlbFamily("container_hugetlb_usage_bytes", gauge, "bytes", "Current hugetlb usage.",
+			func(s cgroups.HugetlbStats) uint64 { return s.Usage }),
+		hugetlbFamily("container_hugetlb_max_usage_bytes", gauge, "bytes", "Maximum hugetlb usage recorded.",
+			func(s cgroups.HugetlbStats) uint64 { return s.MaxUsage }),
+		hugetlbFamily("container_hugetlb_failures", counter, "", "Number of hugetlb allocation failures.",
+			func(s cgroups.HugetlbStats) uint64 { return s.Failcnt }),
+		rdmaFamily("container_rdma_hca_handles", "Current number of RDMA HCA handles.",
+			func(s *cgroups.RdmaStats) []cgroups.RdmaEntry { return s.RdmaCurrent },
+			func(e cgroups.RdmaEntry) uint32 { return e.HcaHandles }),
+		rdmaFamily("container_rdma_hca_objects", "Current number of RDMA HCA objects.",
+			func(s *cgroups.RdmaStats) []cgroups.RdmaEntry { return s.RdmaCurrent },
+			func(e cgroups.RdmaEntry) uint32 { return e.HcaObjects }),
+		rdmaFamily("container_rdma_hca_handles_limit", "Maximum number of RDMA HCA handles.",
+			func(s *cgroups.RdmaStats) []cgroups.RdmaEntry { return s.RdmaLimit },
+			func(e cgroups.RdmaEntry) uint32 { return e.HcaHandles }),
+		rdmaFamily("container_rdma_hca_objects_limit", "Maximum number of RDMA HCA objects.",
+			func(s *cgroups.RdmaStats) []cgroups.RdmaEntry { return s.RdmaLimit },
+			func(e cgroups.RdmaEntry) uint32 { return e.HcaObjects }),
+		intelRdtFamily("container_intelrdt_mbm_total_bytes", counter, "Total memory bandwidth used, per NUMA node (Intel RDT MBM).",
+			func(s *intelrdt.Stats) []uint64 {
+				if s.MBMStats == nil {
+					return nil
+				}
+				v := make([]uint64, len(*s.MBMStats))
+				for i, n := range *s.MBMStats {
+					v[i] = n.MBMTotalBytes
+				}
+				return v
+			}),
+		intelRdtFamily("container_intelrdt_mbm_local_bytes", counter, "Local memory bandwidth used, per NUMA node (Intel RDT MBM).",
+			func(s *intelrdt.Stats) []uint64 {
+				if s.MBMStats == nil {
+					return nil
+				}
+				v := make([]uint64, len(*s.MBMStats))
+				for i, n := range *s.MBMStats {
+					v[i] = n.MBMLocalBytes
+				}
+				return v
+			}),
+		intelRdtFamily("container_intelrdt_llc_occupancy_bytes", gauge, "Current last level cache occupancy, per NUMA node (Intel RDT CMT).",
+			func(s *intelrdt.Stats) []uint64 {
+				if s.CMTStats == nil {
+					return nil
+				}
+				v := make([]uint64, len(*s.CMTStats))
+				for i, n := range *s.CMTStats {
+					v[i] = n.LLCOccupancy
+				}
+				return v
+			}),
+	},
+)
+
+func concat(fs ...[]family) []family {
+	var all []family
+	for _, f := range fs {
+		all = append(all, f...)
+	}
+	return all
+}
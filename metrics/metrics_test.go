@@ -0,0 +1,122 @@
+package metrics
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/dims/libcontainer/cgroups"
+	"github.com/dims/libcontainer/intelrdt"
+)
+
+var update = flag.Bool("update", false, "update the golden files")
+
+func v1Stats() *cgroups.Stats {
+	s := cgroups.NewStats()
+	s.CpuStats.CpuUsage = cgroups.CpuUsage{
+		TotalUsage:        3500000000,
+		PercpuUsage:       []uint64{2000000000, 1500000000},
+		UsageInUsermode:   2500000000,
+		UsageInKernelmode: 1000000000,
+	}
+	s.CpuStats.ThrottlingData = cgroups.ThrottlingData{Periods: 100, ThrottledPeriods: 5, ThrottledTime: 250000000}
+	s.CPUSetStats = cgroups.CPUSetStats{CPUs: []uint16{0, 1}, Mems: []uint16{0}}
+	s.MemoryStats.Cache = 4096
+	s.MemoryStats.Usage = cgroups.MemoryData{Usage: 16384, MaxUsage: 20480, Failcnt: 2, Limit: 1073741824}
+	s.MemoryStats.SwapUsage = cgroups.MemoryData{Usage: 16384}
+	s.MemoryStats.Stats = map[string]uint64{
+		"cache": 4096, "total_rss": 12288, "total_inactive_file": 1024,
+		"pgfault": 100, "total_pgfault": 300, "pgmajfault": 1, "total_pgmajfault": 3,
+	}
+	s.MemoryStats.Events.Max = 2
+	s.PidsStats = cgroups.PidsStats{Current: 3, Limit: 100}
+	s.BlkioStats.IoServiceBytesRecursive = []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 4096},
+		{Major: 8, Minor: 0, Op: "Write", Value: 8192},
+	}
+	s.BlkioStats.IoServicedRecursive = []cgroups.BlkioStatEntry{
+		{Major: 8, Minor: 0, Op: "Read", Value: 1},
+		{Major: 8, Minor: 0, Op: "Write", Value: 2},
+	}
+	s.HugetlbStats = map[string]cgroups.HugetlbStats{
+		"2MB": {Usage: 2097152, MaxUsage: 4194304, Failcnt: 1},
+		"1GB": {},
+	}
+	s.RdmaStats = cgroups.RdmaStats{
+		RdmaLimit:   []cgroups.RdmaEntry{{Device: "mlx4_0", HcaHandles: 10, HcaObjects: 100}},
+		RdmaCurrent: []cgroups.RdmaEntry{{Device: "mlx4_0", HcaHandles: 1, HcaObjects: 5}},
+	}
+	return s
+}
+
+func v2Stats() *cgroups.Stats {
+	s := cgroups.NewStats()
+	s.CpuStats.CpuUsage = cgroups.CpuUsage{
+		TotalUsage:        1500000000,
+		UsageInUsermode:   1000000000,
+		UsageInKernelmode: 500000000,
+	}
+	s.CpuStats.PSI = &cgroups.PSIStats{Some: cgroups.PSIData{Total: 1500000}, Full: cgroups.PSIData{Total: 500000}}
+	s.MemoryStats.Cache = 8192
+	s.MemoryStats.Usage = cgroups.MemoryData{Usage: 32768, Limit: 268435456}
+	s.MemoryStats.SwapUsage = cgroups.MemoryData{Usage: 36864}
+	s.MemoryStats.Stats = map[string]uint64{"file": 8192, "anon": 24576, "inactive_file": 4096, "pgfault": 200, "pgmajfault": 2}
+	s.MemoryStats.Events.OOMKill = 1
+	s.PidsStats = cgroups.PidsStats{Current: 1}
+	// Decorated with the device names.
+	s.BlkioStats.IoServiceBytesRecursive = []cgroups.BlkioStatEntry{
+		{Major: 259, Minor: 0, Op: "Read", Value: 512, Device: "nvme0n1"},
+	}
+	return s
+}
+
+func TestWrite(t *testing.T) {
+	mbm := []intelrdt.MBMNumaNodeStats{
+		{MBMTotalBytes: 1048576, MBMLocalBytes: 524288},
+		{MBMTotalBytes: 2048, MBMLocalBytes: 1024},
+	}
+	cmt := []intelrdt.CMTNumaNodeStats{{LLCOccupancy: 65536}, {LLCOccupancy: 0}}
+
+	testCases := []struct {
+		golden     string
+		containers []Container
+	}{
+		{
+			golden:     "v1.txt",
+			containers: []Container{{ID: "c1", Cgroup: v1Stats()}},
+		},
+		{
+			golden: "v2_intelrdt.txt",
+			containers: []Container{
+				{ID: "c2", Cgroup: v2Stats(), IntelRdt: &intelrdt.Stats{MBMStats: &mbm, CMTStats: &cmt}},
+				{ID: `with "quotes"`, Cgroup: v2Stats()},
+			},
+		},
+		{
+			golden: "empty.txt",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.golden, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, tc.containers...); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tc.golden)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			expected, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), expected) {
+				t.Errorf("output differs from %s (run with -update to update it):\n%s", golden, buf.String())
+			}
+		})
+	}
+}